@@ -0,0 +1,220 @@
+package assembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The first RAM address handed out to variables, R0 to R15 come before it.
+const variableBase = 16
+
+var predefinedSymbols = map[string]int{
+	"SP":     0,
+	"LCL":    1,
+	"ARG":    2,
+	"THIS":   3,
+	"THAT":   4,
+	"SCREEN": 16384,
+	"KBD":    24576,
+}
+
+func init() {
+	for i := 0; i < 16; i++ {
+		predefinedSymbols["R"+strconv.Itoa(i)] = i
+	}
+}
+
+var destCodes = map[string]string{
+	"":    "000",
+	"M":   "001",
+	"D":   "010",
+	"MD":  "011",
+	"A":   "100",
+	"AM":  "101",
+	"AD":  "110",
+	"AMD": "111",
+}
+
+var jumpCodes = map[string]string{
+	"":    "000",
+	"JGT": "001",
+	"JEQ": "010",
+	"JGE": "011",
+	"JLT": "100",
+	"JNE": "101",
+	"JLE": "110",
+	"JMP": "111",
+}
+
+var compCodes = map[string]string{
+	"0":   "0101010",
+	"1":   "0111111",
+	"-1":  "0111010",
+	"D":   "0001100",
+	"A":   "0110000",
+	"!D":  "0001101",
+	"!A":  "0110001",
+	"-D":  "0001111",
+	"-A":  "0110011",
+	"D+1": "0011111",
+	"A+1": "0110111",
+	"D-1": "0001110",
+	"A-1": "0110010",
+	"D+A": "0000010",
+	"D-A": "0010011",
+	"A-D": "0000111",
+	"D&A": "0000000",
+	"D|A": "0010101",
+	"M":   "1110000",
+	"!M":  "1110001",
+	"-M":  "1110011",
+	"M+1": "1110111",
+	"M-1": "1110010",
+	"D+M": "1000010",
+	"D-M": "1010011",
+	"M-D": "1000111",
+	"D&M": "1000000",
+	"D|M": "1010101",
+	// commutative forms, also accepted by the course's assembler
+	"A+D": "0000010",
+	"A&D": "0000000",
+	"A|D": "0010101",
+	"M+D": "1000010",
+	"M&D": "1000000",
+	"M|D": "1010101",
+}
+
+// instruction is an A or C instruction with the line it was read from.
+type instruction struct {
+	command string
+	line    int
+}
+
+// formatLine removes the comment and all whitespace from a line.
+func formatLine(line string) string {
+	if commentIndex := strings.Index(line, "//"); commentIndex != -1 {
+		line = line[:commentIndex]
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+// isSymbol reports whether s is a valid label or variable name: letters, digits, _ . $ and :
+// not starting with a digit.
+func isSymbol(s string) bool {
+	if s == "" || unicode.IsDigit(rune(s[0])) {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("_.$:", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Assemble translates the Hack assembly read from r into the binary machine code written to w,
+// one 16 character line of 0s and 1s per instruction. Labels are resolved in a first pass,
+// variables are allocated from address 16 in order of first use.
+func Assemble(r io.Reader, w io.Writer) error {
+	symbols := make(map[string]int, len(predefinedSymbols))
+	for symbol, address := range predefinedSymbols {
+		symbols[symbol] = address
+	}
+
+	var instructions []instruction
+	labels := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		command := formatLine(scanner.Text())
+		if command == "" {
+			continue
+		}
+		if command[0] != '(' {
+			instructions = append(instructions, instruction{command, line})
+			continue
+		}
+		label := strings.TrimSuffix(command[1:], ")")
+		if len(label) != len(command)-2 || !isSymbol(label) {
+			return fmt.Errorf("line %d: invalid label %s", line, command)
+		}
+		if _, ok := predefinedSymbols[label]; ok || labels[label] {
+			return fmt.Errorf("line %d: label %s is defined more than once", line, label)
+		}
+		labels[label] = true
+		symbols[label] = len(instructions)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	nextVariable := variableBase
+	for _, inst := range instructions {
+		var code string
+		if inst.command[0] == '@' {
+			value := inst.command[1:]
+			address, err := strconv.Atoi(value)
+			switch {
+			case err == nil:
+				if address < 0 || address > 32767 {
+					return fmt.Errorf("line %d: address %s is out of range, the maximum is 32767", inst.line, value)
+				}
+			case isSymbol(value):
+				var ok bool
+				if address, ok = symbols[value]; !ok {
+					address = nextVariable
+					symbols[value] = address
+					nextVariable++
+				}
+				if address > 32767 {
+					return fmt.Errorf("line %d: label %s is at address %d, out of range, the maximum is 32767", inst.line, value, address)
+				}
+			default:
+				return fmt.Errorf("line %d: invalid address %s", inst.line, value)
+			}
+			code = fmt.Sprintf("%016b", address)
+		} else {
+			var err error
+			if code, err = encodeC(inst.command); err != nil {
+				return fmt.Errorf("line %d: %v", inst.line, err)
+			}
+		}
+		if _, err := bw.WriteString(code + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// encodeC encodes a C instruction of the form dest=comp;jump, dest and jump are optional.
+func encodeC(command string) (string, error) {
+	dest, comp, jump := "", command, ""
+	if i := strings.Index(comp, "="); i != -1 {
+		dest, comp = comp[:i], comp[i+1:]
+	}
+	if i := strings.Index(comp, ";"); i != -1 {
+		comp, jump = comp[:i], comp[i+1:]
+	}
+	destCode, ok := destCodes[dest]
+	if !ok {
+		return "", fmt.Errorf("invalid destination %s", dest)
+	}
+	compCode, ok := compCodes[comp]
+	if !ok {
+		return "", fmt.Errorf("invalid computation %s", comp)
+	}
+	jumpCode, ok := jumpCodes[jump]
+	if !ok {
+		return "", fmt.Errorf("invalid jump %s", jump)
+	}
+	return "111" + compCode + destCode + jumpCode, nil
+}
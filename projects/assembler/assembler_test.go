@@ -0,0 +1,72 @@
+package assembler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	source := `// sums 1 and 2 into sum
+	@1
+	D=A   // inline comment
+(LOOP)
+	@sum
+	M = D + M
+	D=M+D
+	@LOOP
+	D;JGT
+	@R15
+	AMD=M-1;JMP
+	@i
+	@sum
+	@KBD
+`
+	want := []string{
+		"0000000000000001",
+		"1110110000010000",
+		"0000000000010000",
+		"1111000010001000",
+		"1111000010010000",
+		"0000000000000010",
+		"1110001100000001",
+		"0000000000001111",
+		"1111110010111111",
+		"0000000000010001",
+		"0000000000010000",
+		"0110000000000000",
+	}
+	var out strings.Builder
+	if err := Assemble(strings.NewReader(source), &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != strings.Join(want, "\n")+"\n" {
+		t.Errorf("Machine code was incorrect, got:\n%s\nwanted:\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	sources := []struct {
+		source string
+		err    string
+	}{
+		{"@32768", "line 1: address 32768 is out of range, the maximum is 32767"},
+		{"@-1", "line 1: address -1 is out of range, the maximum is 32767"},
+		{"@1x", "line 1: invalid address 1x"},
+		{"\nD=D*A", "line 2: invalid computation D*A"},
+		{"X=D", "line 1: invalid destination X"},
+		{"0;JMPS", "line 1: invalid jump JMPS"},
+		{"(LOOP", "line 1: invalid label (LOOP"},
+		{"(A)\n(A)", "line 2: label A is defined more than once"},
+		{"(SP)", "line 1: label SP is defined more than once"},
+		{"@END\n" + strings.Repeat("D=0\n", 32767) + "(END)", "line 1: label END is at address 32768, out of range, the maximum is 32767"},
+	}
+	for _, source := range sources {
+		err := ""
+		if e := Assemble(strings.NewReader(source.source), &strings.Builder{}); e != nil {
+			err = e.Error()
+		}
+		if err != source.err {
+			t.Errorf("Error for %q was incorrect, got: %s, wanted: %s", source.source, err, source.err)
+		}
+	}
+}
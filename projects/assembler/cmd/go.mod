@@ -0,0 +1,7 @@
+module main
+
+go 1.13
+
+require example.com/assembler v0.0.0
+
+replace example.com/assembler => ../
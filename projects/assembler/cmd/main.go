@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strings"
+
+	"example.com/assembler"
+)
+
+// main assembles the .asm file given as the first argument into a .hack file next to it.
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("usage: assembler file.asm")
+	}
+	path := os.Args[1]
+	in, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(strings.TrimSuffix(path, ".asm") + ".hack")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	w := bufio.NewWriter(out)
+	if err := assembler.Assemble(in, w); err != nil {
+		log.Fatal(path + ":" + err.Error())
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,148 @@
+package build
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"example.com/assembler"
+	"example.com/compiler"
+	"vm/translater"
+)
+
+// osFiles is a copy of the VM code of the Jack OS, linked into every program that does not
+// implement an OS class itself.
+//
+//go:embed os/*.vm
+var osFiles embed.FS
+
+// Options selects the compiler behaviour of a build.
+type Options struct {
+	// Strict type checks assignments, arguments and return values.
+	Strict bool
+	// Precedence evaluates operators by their usual precedence instead of strictly left to right.
+	Precedence bool
+	// Extended accepts extended-Jack.
+	Extended bool
+	// Optimize folds constant subexpressions and reduces operations with a constant operand.
+	Optimize bool
+	// Debug writes the debug information of each class: the source lines as comments in its .vm
+	// file, and its symbol table and source map next to it.
+	Debug bool
+	// Jobs bounds the number of classes compiled at once, 0 compiles one class per CPU.
+	Jobs int
+	// Incremental only compiles the classes that changed since the last incremental build.
+	Incremental bool
+}
+
+// vmFile is a VM file of the program, name is the file name without the .vm extension.
+type vmFile struct {
+	name string
+	read func() (io.ReadCloser, error)
+}
+
+// Build compiles the Jack program in dir and links it with the OS classes it does not implement
+// into dir/<dir>.asm, which is assembled into dir/<dir>.hack.
+func Build(dir string, options Options) error {
+	dir = filepath.Clean(dir)
+	compilerOptions := compiler.Options{
+		Strict:      options.Strict,
+		Precedence:  options.Precedence,
+		Extended:    options.Extended,
+		Optimize:    options.Optimize,
+		Symbols:     options.Debug,
+		Debug:       options.Debug,
+		Jobs:        options.Jobs,
+		Incremental: options.Incremental,
+	}
+	if err := compiler.Compile(dir, compilerOptions); err != nil {
+		return err
+	}
+	files, err := programFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(dir)
+	asmPath := filepath.Join(dir, name+".asm")
+	if err := writeFile(asmPath, func(w io.Writer) error { return translate(files, w) }); err != nil {
+		return err
+	}
+	asm, err := os.Open(asmPath)
+	if err != nil {
+		return err
+	}
+	defer asm.Close()
+	hackPath := filepath.Join(dir, name+".hack")
+	return writeFile(hackPath, func(w io.Writer) error {
+		if err := assembler.Assemble(asm, w); err != nil {
+			return fmt.Errorf("%s:%v", asmPath, err)
+		}
+		return nil
+	})
+}
+
+// programFiles lists the .vm files of dir followed by the OS files of the classes that dir
+// does not implement, each group in lexical order.
+func programFiles(dir string) ([]vmFile, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.vm"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var files []vmFile
+	implemented := make(map[string]bool)
+	for _, path := range paths {
+		path := path
+		name := strings.TrimSuffix(filepath.Base(path), ".vm")
+		implemented[name] = true
+		files = append(files, vmFile{name, func() (io.ReadCloser, error) { return os.Open(path) }})
+	}
+	osPaths, err := fs.Glob(osFiles, "os/*.vm")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range osPaths {
+		path := path
+		name := strings.TrimSuffix(filepath.Base(path), ".vm")
+		if implemented[name] {
+			continue
+		}
+		files = append(files, vmFile{name, func() (io.ReadCloser, error) { return osFiles.Open(path) }})
+	}
+	return files, nil
+}
+
+func translate(files []vmFile, w io.Writer) error {
+	program, err := translater.NewProgram(w)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		r, err := file.read()
+		if err != nil {
+			return err
+		}
+		err = program.Translate(file.name, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile writes the output of write to path, nothing is written if write fails.
+func writeFile(path string, write func(w io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,127 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/cpu"
+)
+
+func writeProgram(t *testing.T, files map[string]string) string {
+	dir := filepath.Join(t.TempDir(), "Prog")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// labelAddress returns the ROM address of a label of assembly code, -1 if it is not defined.
+func labelAddress(asm string, label string) int {
+	address := 0
+	for _, line := range strings.Split(asm, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "("+label+")":
+			return address
+		case line != "" && line[0] != '(' && !strings.HasPrefix(line, "//"):
+			address++
+		}
+	}
+	return -1
+}
+
+func TestBuild(t *testing.T) {
+	dir := writeProgram(t, map[string]string{
+		"Main.jack": `class Main {
+	function void main() {
+		do Output.printInt(Math.multiply(6, 7));
+		do Memory.poke(8000, Math.multiply(6, 7));
+		do Memory.poke(8001, Math.divide(-100, 7));
+		do Memory.poke(8002, Math.sqrt(1000));
+		return;
+	}
+}`,
+		"Array.vm": "function Array.new 0\npush argument 0\ncall Memory.alloc 1\nreturn\n" +
+			"function Array.dispose 0\npush argument 0\ncall Memory.deAlloc 1\nreturn\n",
+	})
+	if err := Build(dir, Options{Optimize: true}); err != nil {
+		t.Fatal(err)
+	}
+	asm, err := os.ReadFile(filepath.Join(dir, "Prog.asm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, label := range []string{"(Main.main)", "(Math.multiply)", "(Output.printInt)", "(Sys.init)"} {
+		if strings.Count(string(asm), label+"\n") != 1 {
+			t.Errorf("Label %s was incorrect, got: %d definitions, wanted: 1", label, strings.Count(string(asm), label+"\n"))
+		}
+	}
+	hack, err := os.ReadFile(filepath.Join(dir, "Prog.hack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom, err := cpu.ReadHack(strings.NewReader(string(hack)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rom) > cpu.RAMSize {
+		t.Fatalf("Program size was incorrect, got: %d instructions, wanted: at most %d", len(rom), cpu.RAMSize)
+	}
+	// the OS initialises and Main.main runs up to the call of Sys.halt, which loops forever
+	halt := labelAddress(string(asm), "Sys.halt")
+	c := cpu.New(rom)
+	for steps := 0; c.PC != halt; steps++ {
+		if steps == 10000000 {
+			t.Fatal("Prog.hack did not reach Sys.halt")
+		}
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	memory := []struct {
+		address int
+		want    int16
+	}{
+		{8000, 42},
+		{8001, -14},
+		{8002, 31},
+	}
+	for _, m := range memory {
+		if got := c.RAM[m.address]; got != m.want {
+			t.Errorf("RAM[%d] was incorrect, got: %d, wanted: %d", m.address, got, m.want)
+		}
+	}
+}
+
+func TestProgramFiles(t *testing.T) {
+	dir := writeProgram(t, map[string]string{"Main.vm": "", "Math.vm": ""})
+	files, err := programFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.name)
+	}
+	want := "Main Math Array Keyboard Memory Output Screen String Sys"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("Files were incorrect, got: %s, wanted: %s", got, want)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	dir := writeProgram(t, map[string]string{"Main.jack": "class Main { function void main() { do Nope.f(); return; } }"})
+	if err := Build(dir, Options{}); err == nil {
+		t.Errorf("Build of a program calling an unknown class was incorrect, got: nil, wanted: an error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Prog.hack")); !os.IsNotExist(err) {
+		t.Errorf("Build of an incorrect program wrote Prog.hack")
+	}
+}
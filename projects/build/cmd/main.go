@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"example.com/build"
+)
+
+// main builds the Jack program in the folder given as the argument into a .hack file.
+func main() {
+	strict := flag.Bool("strict", false, "type check assignments, arguments and return values")
+	precedence := flag.Bool("precedence", false, "evaluate operators by conventional precedence instead of left to right")
+	extended := flag.Bool("extended", false, "accept extended-Jack")
+	optimize := flag.Bool("optimize", false, "fold constant subexpressions and reduce operations with a constant operand")
+	debug := flag.Bool("debug", false, "write debug information next to each .vm file")
+	jobs := flag.Int("j", 0, "number of classes compiled at once, 0 compiles one class per CPU")
+	incremental := flag.Bool("incremental", false, "only compile the classes that changed since the last incremental build")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: build [flags] dir")
+	}
+	options := build.Options{Strict: *strict, Precedence: *precedence, Extended: *extended, Optimize: *optimize, Debug: *debug,
+		Jobs: *jobs, Incremental: *incremental}
+	if err := build.Build(flag.Arg(0), options); err != nil {
+		log.Fatal(err)
+	}
+}
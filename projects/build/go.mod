@@ -0,0 +1,29 @@
+module build
+
+go 1.16
+
+require (
+	example.com/assembler v0.0.0
+	example.com/cache v0.0.0
+	example.com/compiler v0.0.0
+	example.com/cpu v0.0.0
+	example.com/engine v0.0.0
+	example.com/tokenizer v0.0.0
+	example.com/writer v0.0.0
+	vm/interpreter v0.0.0
+	vm/parser v0.0.0
+	vm/translater v0.0.0
+)
+
+replace (
+	example.com/assembler => ../assembler
+	example.com/cache => ../compiler/cache
+	example.com/compiler => ../compiler
+	example.com/cpu => ../cpu
+	example.com/engine => ../compiler/engine
+	example.com/tokenizer => ../compiler/tokenizer
+	example.com/writer => ../compiler/writer
+	vm/interpreter => ../vm/interpreter
+	vm/parser => ../vm/parser
+	vm/translater => ../vm/translater
+)
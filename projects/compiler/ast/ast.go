@@ -0,0 +1,277 @@
+package ast
+
+import "example.com/tokenizer"
+
+// Node is any element of the syntax tree, Pos is the position of its first token.
+type Node interface {
+	Pos() tokenizer.Pos
+}
+
+// Expr is an expression node.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Stmt is a statement node.
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// Ident is a name where it appears in the source: a variable, a constant, a class or a
+// subroutine.
+type Ident struct {
+	NamePos tokenizer.Pos
+	Name    string
+}
+
+// Class is a parsed .jack file. End is the position of the closing brace.
+//
+// The declarations keep the /** */ comment right before them in Doc, as text without the
+// comment delimiters and the stars that start its lines.
+type Class struct {
+	Doc         string
+	ClassPos    tokenizer.Pos
+	Name        *Ident
+	Vars        []*ClassVarDec
+	Constants   []*ConstDec
+	Subroutines []*Subroutine
+	End         tokenizer.Pos
+}
+
+// ClassVarDec declares static or field variables, Kind is "static" or "field".
+type ClassVarDec struct {
+	Doc     string
+	KindPos tokenizer.Pos
+	Kind    string
+	TypePos tokenizer.Pos
+	Type    string
+	Names   []*Ident
+}
+
+// ConstDec declares an extended-Jack class constant.
+type ConstDec struct {
+	Doc      string
+	ConstPos tokenizer.Pos
+	TypePos  tokenizer.Pos
+	Type     string
+	Name     *Ident
+	Value    Expr
+}
+
+// Subroutine is a constructor, function or method, Kind holds which. End is the position of
+// the closing brace, it is zero when the subroutine was cut short by an error.
+type Subroutine struct {
+	Doc        string
+	KindPos    tokenizer.Pos
+	Kind       string
+	ReturnPos  tokenizer.Pos
+	ReturnType string
+	Name       *Ident
+	Params     []*Param
+	Locals     []*VarDec
+	Body       []Stmt
+	End        tokenizer.Pos
+}
+
+type Param struct {
+	TypePos tokenizer.Pos
+	Type    string
+	Name    *Ident
+}
+
+// VarDec declares the local variables of a subroutine.
+type VarDec struct {
+	VarPos  tokenizer.Pos
+	TypePos tokenizer.Pos
+	Type    string
+	Names   []*Ident
+}
+
+// Statements.
+type (
+	// LetStmt is let name = value; or let name[index] = value;. The assignments in the clauses
+	// of a for loop are LetStmts too, Let is then the position of the name.
+	LetStmt struct {
+		Let   tokenizer.Pos
+		Name  *Ident
+		Index Expr
+		Value Expr
+	}
+
+	// IfStmt is an if statement, Else is nil without an else clause. An extended-Jack else if is
+	// an Else holding a single IfStmt.
+	IfStmt struct {
+		If   tokenizer.Pos
+		Cond Expr
+		Then []Stmt
+		Else []Stmt
+	}
+
+	WhileStmt struct {
+		While tokenizer.Pos
+		Cond  Expr
+		Body  []Stmt
+	}
+
+	// ForStmt is an extended-Jack for loop, each clause may be nil.
+	ForStmt struct {
+		For  tokenizer.Pos
+		Init *LetStmt
+		Cond Expr
+		Step *LetStmt
+		Body []Stmt
+	}
+
+	// SwitchStmt is an extended-Jack switch, the default clause, if any, is the last one.
+	SwitchStmt struct {
+		Switch tokenizer.Pos
+		Value  Expr
+		Cases  []*CaseClause
+	}
+
+	// BranchStmt is an extended-Jack break or continue, Keyword holds which.
+	BranchStmt struct {
+		KeywordPos tokenizer.Pos
+		Keyword    string
+	}
+
+	DoStmt struct {
+		Do   tokenizer.Pos
+		Call *CallExpr
+	}
+
+	// ReturnStmt returns Value, which is nil in return;.
+	ReturnStmt struct {
+		Return tokenizer.Pos
+		Value  Expr
+	}
+)
+
+// CaseClause is the group of case labels that share statements, Values is empty for default.
+type CaseClause struct {
+	Case   tokenizer.Pos
+	Values []Expr
+	Body   []Stmt
+}
+
+// Expressions.
+type (
+	IntLit struct {
+		ValuePos tokenizer.Pos
+		Value    int
+	}
+
+	// StringLit is a string constant, Value is the raw text between the quotes.
+	StringLit struct {
+		ValuePos tokenizer.Pos
+		Value    string
+	}
+
+	// CharLit is an extended-Jack character constant, Value is the raw text between the quotes.
+	CharLit struct {
+		ValuePos tokenizer.Pos
+		Value    string
+	}
+
+	// KeywordLit is true, false, null or this.
+	KeywordLit struct {
+		ValuePos tokenizer.Pos
+		Value    string
+	}
+
+	// IndexExpr is name[index].
+	IndexExpr struct {
+		Name  *Ident
+		Index Expr
+	}
+
+	// SelectorExpr is Class.NAME, a constant of another class.
+	SelectorExpr struct {
+		X   *Ident
+		Sel *Ident
+	}
+
+	// CallExpr is name(args) or receiver.name(args). Receiver is a variable or a class, which one
+	// is only known once the scopes are resolved.
+	CallExpr struct {
+		Receiver *Ident
+		Name     *Ident
+		Args     []Expr
+	}
+
+	UnaryExpr struct {
+		OpPos tokenizer.Pos
+		Op    string
+		X     Expr
+	}
+
+	BinaryExpr struct {
+		X     Expr
+		OpPos tokenizer.Pos
+		Op    string
+		Y     Expr
+	}
+
+	ParenExpr struct {
+		Lparen tokenizer.Pos
+		X      Expr
+	}
+)
+
+func (n *Ident) Pos() tokenizer.Pos       { return n.NamePos }
+func (n *Class) Pos() tokenizer.Pos       { return n.ClassPos }
+func (n *ClassVarDec) Pos() tokenizer.Pos { return n.KindPos }
+func (n *ConstDec) Pos() tokenizer.Pos    { return n.ConstPos }
+func (n *Subroutine) Pos() tokenizer.Pos  { return n.KindPos }
+func (n *Param) Pos() tokenizer.Pos       { return n.TypePos }
+func (n *VarDec) Pos() tokenizer.Pos      { return n.VarPos }
+func (n *CaseClause) Pos() tokenizer.Pos  { return n.Case }
+
+func (s *LetStmt) Pos() tokenizer.Pos    { return s.Let }
+func (s *IfStmt) Pos() tokenizer.Pos     { return s.If }
+func (s *WhileStmt) Pos() tokenizer.Pos  { return s.While }
+func (s *ForStmt) Pos() tokenizer.Pos    { return s.For }
+func (s *SwitchStmt) Pos() tokenizer.Pos { return s.Switch }
+func (s *BranchStmt) Pos() tokenizer.Pos { return s.KeywordPos }
+func (s *DoStmt) Pos() tokenizer.Pos     { return s.Do }
+func (s *ReturnStmt) Pos() tokenizer.Pos { return s.Return }
+
+func (e *IntLit) Pos() tokenizer.Pos       { return e.ValuePos }
+func (e *StringLit) Pos() tokenizer.Pos    { return e.ValuePos }
+func (e *CharLit) Pos() tokenizer.Pos      { return e.ValuePos }
+func (e *KeywordLit) Pos() tokenizer.Pos   { return e.ValuePos }
+func (e *IndexExpr) Pos() tokenizer.Pos    { return e.Name.NamePos }
+func (e *SelectorExpr) Pos() tokenizer.Pos { return e.X.NamePos }
+func (e *UnaryExpr) Pos() tokenizer.Pos    { return e.OpPos }
+func (e *BinaryExpr) Pos() tokenizer.Pos   { return e.X.Pos() }
+func (e *ParenExpr) Pos() tokenizer.Pos    { return e.Lparen }
+
+func (e *CallExpr) Pos() tokenizer.Pos {
+	if e.Receiver != nil {
+		return e.Receiver.NamePos
+	}
+	return e.Name.NamePos
+}
+
+func (*LetStmt) stmtNode()    {}
+func (*IfStmt) stmtNode()     {}
+func (*WhileStmt) stmtNode()  {}
+func (*ForStmt) stmtNode()    {}
+func (*SwitchStmt) stmtNode() {}
+func (*BranchStmt) stmtNode() {}
+func (*DoStmt) stmtNode()     {}
+func (*ReturnStmt) stmtNode() {}
+
+func (*Ident) exprNode()        {}
+func (*IntLit) exprNode()       {}
+func (*StringLit) exprNode()    {}
+func (*CharLit) exprNode()      {}
+func (*KeywordLit) exprNode()   {}
+func (*IndexExpr) exprNode()    {}
+func (*SelectorExpr) exprNode() {}
+func (*CallExpr) exprNode()     {}
+func (*UnaryExpr) exprNode()    {}
+func (*BinaryExpr) exprNode()   {}
+func (*ParenExpr) exprNode()    {}
@@ -0,0 +1,34 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+
+	"example.com/cache"
+)
+
+// Declarations returns the subroutine signatures of the class, the shape other classes see when
+// the program is indexed. Constants are left out, their values need the compiler to resolve.
+func (c *Class) Declarations() (*cache.Class, error) {
+	class := cache.NewClass(c.Name.Name)
+	for _, s := range c.Subroutines {
+		kind, _ := cache.ParseSubroutineKind(s.Kind)
+		sub := &cache.Subroutine{Name: s.Name.Name, Kind: kind, ReturnType: s.ReturnType}
+		for _, param := range s.Params {
+			sub.Params = append(sub.Params, cache.Param{Name: param.Name.Name, Type: param.Type})
+		}
+		if err := class.AddSubroutine(sub); err != nil {
+			return class, err
+		}
+	}
+	return class, nil
+}
+
+// Signature returns the declaration of the subroutine as it is written, without its body.
+func (s *Subroutine) Signature() string {
+	params := make([]string, len(s.Params))
+	for i, param := range s.Params {
+		params[i] = param.Type + " " + param.Name.Name
+	}
+	return fmt.Sprintf("%s %s %s(%s)", s.Kind, s.ReturnType, s.Name.Name, strings.Join(params, ", "))
+}
@@ -0,0 +1,483 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"example.com/tokenizer"
+)
+
+// Mode selects the language the parser accepts.
+type Mode uint
+
+const (
+	// Extended accepts extended-Jack, as the compiler's -extended option does.
+	Extended Mode = 1 << iota
+	// Precedence groups the binary operators by their usual precedence instead of strictly left
+	// to right, as the compiler's -precedence option does.
+	Precedence
+)
+
+// parseError is the panic value of a grammar error.
+type parseError struct {
+	err error
+}
+
+type parser struct {
+	scanner *tokenizer.Scanner
+	token   tokenizer.Token
+	mode    Mode
+	// doc is the text of the doc comment right before the current token
+	doc string
+}
+
+// ParseClass parses the class read from r. On a grammar or lexical error it returns the first
+// error, a *tokenizer.Error, together with the part of the class parsed before it.
+func ParseClass(r io.Reader, mode Mode) (class *Class, err error) {
+	tokenizerMode := tokenizer.Comments
+	if mode&Extended != 0 {
+		tokenizerMode |= tokenizer.Extended
+	}
+	p := &parser{scanner: tokenizer.NewModeScanner(r, tokenizerMode), mode: mode}
+	class = &Class{}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(parseError)
+			if !ok {
+				panic(r)
+			}
+			err = e.err
+		}
+	}()
+	p.advance()
+	p.parseClass(class)
+	return class, nil
+}
+
+// advance moves to the next token that is not a comment, keeping the last doc comment skipped.
+func (p *parser) advance() {
+	p.doc = ""
+	for {
+		p.token = p.scanner.Next()
+		if err := p.scanner.Err(); err != nil {
+			panic(parseError{err})
+		}
+		if p.token.Category != tokenizer.Comment {
+			return
+		}
+		if strings.HasPrefix(p.token.Value, "/**") {
+			p.doc = docText(p.token.Value)
+		}
+	}
+}
+
+// docText returns the text of a /** */ comment without the delimiters and the stars that start
+// its lines.
+func docText(comment string) string {
+	comment = strings.TrimSuffix(strings.TrimPrefix(comment, "/**"), "*/")
+	lines := strings.Split(comment, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "*") {
+			line = strings.TrimSpace(line[1:])
+		}
+		lines[i] = line
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func (p *parser) errorf(format string, a ...interface{}) {
+	panic(parseError{&tokenizer.Error{Pos: p.token.Pos, Msg: fmt.Sprintf(format, a...)}})
+}
+
+// is reports whether the current token is value, an extended-Jack keyword only matches in
+// extended mode.
+func (p *parser) is(value string) bool {
+	return p.token.Value == value && p.token.Category != tokenizer.StringConst && p.token.Category != tokenizer.CharConst
+}
+
+func (p *parser) isKeyword(value string) bool {
+	return p.token.Value == value && p.token.Category == tokenizer.Keyword
+}
+
+func (p *parser) expect(value string) tokenizer.Pos {
+	if !p.is(value) || p.token.Category == tokenizer.Identifier {
+		p.errorf(`expected "%s", got "%s"`, value, p.token.Value)
+	}
+	pos := p.token.Pos
+	p.advance()
+	return pos
+}
+
+func (p *parser) expectIdent(what string) *Ident {
+	if p.token.Category != tokenizer.Identifier {
+		p.errorf(`expected %s, got "%s"`, what, p.token.Value)
+	}
+	ident := &Ident{p.token.Pos, p.token.Value}
+	p.advance()
+	return ident
+}
+
+func (p *parser) expectType(allowVoid bool) (tokenizer.Pos, string) {
+	if !p.token.IsType() && !(allowVoid && p.isKeyword("void")) {
+		p.errorf(`expected a type, got "%s"`, p.token.Value)
+	}
+	token := p.token
+	p.advance()
+	return token.Pos, token.Value
+}
+
+func (p *parser) parseClass(class *Class) {
+	class.Doc = p.doc
+	class.ClassPos = p.expect("class")
+	class.Name = p.expectIdent("the class name")
+	p.expect("{")
+	for {
+		if p.isKeyword("static") || p.isKeyword("field") {
+			class.Vars = append(class.Vars, p.parseClassVarDec())
+		} else if p.isKeyword("const") {
+			class.Constants = append(class.Constants, p.parseConstDec())
+		} else {
+			break
+		}
+	}
+	for p.isKeyword("constructor") || p.isKeyword("function") || p.isKeyword("method") {
+		// added before it is parsed, so a partial class holds the subroutine an error is in
+		sub := &Subroutine{}
+		class.Subroutines = append(class.Subroutines, sub)
+		p.parseSubroutine(sub)
+	}
+	class.End = p.expect("}")
+	if p.token.Category != tokenizer.EOF {
+		p.errorf(`unexpected "%s" after the end of the class`, p.token.Value)
+	}
+}
+
+func (p *parser) parseNames(what string) []*Ident {
+	names := []*Ident{p.expectIdent(what)}
+	for p.is(",") {
+		p.advance()
+		names = append(names, p.expectIdent(what))
+	}
+	return names
+}
+
+func (p *parser) parseClassVarDec() *ClassVarDec {
+	dec := &ClassVarDec{Doc: p.doc, KindPos: p.token.Pos, Kind: p.token.Value}
+	p.advance()
+	dec.TypePos, dec.Type = p.expectType(false)
+	dec.Names = p.parseNames("a variable name")
+	p.expect(";")
+	return dec
+}
+
+func (p *parser) parseConstDec() *ConstDec {
+	dec := &ConstDec{Doc: p.doc, ConstPos: p.token.Pos}
+	p.advance()
+	dec.TypePos, dec.Type = p.expectType(false)
+	dec.Name = p.expectIdent("the name of the constant")
+	p.expect("=")
+	dec.Value = p.parseExpr()
+	p.expect(";")
+	return dec
+}
+
+func (p *parser) parseSubroutine(sub *Subroutine) {
+	sub.Doc, sub.KindPos, sub.Kind = p.doc, p.token.Pos, p.token.Value
+	p.advance()
+	sub.ReturnPos, sub.ReturnType = p.expectType(true)
+	sub.Name = p.expectIdent("the subroutine name")
+	p.expect("(")
+	if !p.is(")") {
+		for {
+			param := &Param{}
+			param.TypePos, param.Type = p.expectType(false)
+			param.Name = p.expectIdent("a parameter name")
+			sub.Params = append(sub.Params, param)
+			if !p.is(",") {
+				break
+			}
+			p.advance()
+		}
+	}
+	p.expect(")")
+	p.expect("{")
+	for p.isKeyword("var") {
+		dec := &VarDec{VarPos: p.token.Pos}
+		p.advance()
+		dec.TypePos, dec.Type = p.expectType(false)
+		dec.Names = p.parseNames("a variable name")
+		p.expect(";")
+		sub.Locals = append(sub.Locals, dec)
+	}
+	// parsed in place, so a partial subroutine keeps the statements before an error
+	p.parseStatements(&sub.Body)
+	sub.End = p.expect("}")
+}
+
+func (p *parser) parseBlock() []Stmt {
+	p.expect("{")
+	var statements []Stmt
+	p.parseStatements(&statements)
+	p.expect("}")
+	return statements
+}
+
+func (p *parser) parseStatements(statements *[]Stmt) {
+	for {
+		statement := p.parseStatement()
+		if statement == nil {
+			return
+		}
+		*statements = append(*statements, statement)
+	}
+}
+
+// parseStatement returns the next statement, or nil if the current token does not start one.
+func (p *parser) parseStatement() Stmt {
+	if p.token.Category != tokenizer.Keyword {
+		return nil
+	}
+	pos := p.token.Pos
+	switch p.token.Value {
+	case "let":
+		p.advance()
+		s := p.parseAssignment(pos)
+		p.expect(";")
+		return s
+	case "if":
+		return p.parseIf()
+	case "while":
+		p.advance()
+		s := &WhileStmt{While: pos}
+		p.expect("(")
+		s.Cond = p.parseExpr()
+		p.expect(")")
+		s.Body = p.parseBlock()
+		return s
+	case "for":
+		return p.parseFor()
+	case "switch":
+		return p.parseSwitch()
+	case "break", "continue":
+		s := &BranchStmt{pos, p.token.Value}
+		p.advance()
+		p.expect(";")
+		return s
+	case "do":
+		p.advance()
+		call, ok := p.parseTerm().(*CallExpr)
+		if !ok {
+			p.errorf("expected a subroutine call after do")
+		}
+		p.expect(";")
+		return &DoStmt{pos, call}
+	case "return":
+		p.advance()
+		s := &ReturnStmt{Return: pos}
+		if !p.is(";") {
+			s.Value = p.parseExpr()
+		}
+		p.expect(";")
+		return s
+	}
+	return nil
+}
+
+// parseAssignment parses name = value or name[index] = value.
+func (p *parser) parseAssignment(pos tokenizer.Pos) *LetStmt {
+	s := &LetStmt{Let: pos, Name: p.expectIdent("a variable name")}
+	if p.is("[") {
+		p.advance()
+		s.Index = p.parseExpr()
+		p.expect("]")
+	}
+	p.expect("=")
+	s.Value = p.parseExpr()
+	return s
+}
+
+func (p *parser) parseIf() *IfStmt {
+	s := &IfStmt{If: p.token.Pos}
+	p.advance()
+	p.expect("(")
+	s.Cond = p.parseExpr()
+	p.expect(")")
+	s.Then = p.parseBlock()
+	if p.isKeyword("else") {
+		p.advance()
+		if p.mode&Extended != 0 && p.isKeyword("if") {
+			s.Else = []Stmt{p.parseIf()}
+		} else if s.Else = p.parseBlock(); s.Else == nil {
+			s.Else = []Stmt{}
+		}
+	}
+	return s
+}
+
+func (p *parser) parseFor() *ForStmt {
+	s := &ForStmt{For: p.token.Pos}
+	p.advance()
+	p.expect("(")
+	if !p.is(";") {
+		s.Init = p.parseAssignment(p.token.Pos)
+	}
+	p.expect(";")
+	if !p.is(";") {
+		s.Cond = p.parseExpr()
+	}
+	p.expect(";")
+	if !p.is(")") {
+		s.Step = p.parseAssignment(p.token.Pos)
+	}
+	p.expect(")")
+	s.Body = p.parseBlock()
+	return s
+}
+
+func (p *parser) parseSwitch() *SwitchStmt {
+	s := &SwitchStmt{Switch: p.token.Pos}
+	p.advance()
+	p.expect("(")
+	s.Value = p.parseExpr()
+	p.expect(")")
+	p.expect("{")
+	for p.isKeyword("case") {
+		clause := &CaseClause{Case: p.token.Pos}
+		for p.isKeyword("case") {
+			p.advance()
+			clause.Values = append(clause.Values, p.parseExpr())
+			p.expect(":")
+		}
+		p.parseStatements(&clause.Body)
+		s.Cases = append(s.Cases, clause)
+	}
+	if p.isKeyword("default") {
+		clause := &CaseClause{Case: p.token.Pos}
+		p.advance()
+		p.expect(":")
+		p.parseStatements(&clause.Body)
+		s.Cases = append(s.Cases, clause)
+		if p.isKeyword("case") {
+			p.errorf("case after default")
+		}
+	}
+	p.expect("}")
+	return s
+}
+
+// precedence mirrors the compiler: the extended-Jack && and || bind loosest, the other
+// operators bind equally unless the Precedence mode is set.
+func (p *parser) precedence(op string) int {
+	switch op {
+	case "||":
+		return 1
+	case "&&":
+		return 2
+	}
+	if p.mode&Precedence == 0 {
+		return 3
+	}
+	switch op {
+	case "|":
+		return 3
+	case "&":
+		return 4
+	case "=":
+		return 5
+	case "<", ">":
+		return 6
+	case "+", "-":
+		return 7
+	}
+	return 8
+}
+
+func (p *parser) isOp() bool {
+	return p.token.Category == tokenizer.Symbol && p.token.IsOp()
+}
+
+func (p *parser) parseExpr() Expr {
+	return p.parseBinary(1)
+}
+
+// parseBinary parses the operations that bind at least as tightly as minPrecedence, operators of
+// equal precedence group from left to right.
+func (p *parser) parseBinary(minPrecedence int) Expr {
+	x := p.parseTerm()
+	for p.isOp() && p.precedence(p.token.Value) >= minPrecedence {
+		op := p.token
+		p.advance()
+		y := p.parseBinary(p.precedence(op.Value) + 1)
+		x = &BinaryExpr{x, op.Pos, op.Value, y}
+	}
+	return x
+}
+
+func (p *parser) parseTerm() Expr {
+	token := p.token
+	switch {
+	case token.Category == tokenizer.IntConst:
+		p.advance()
+		value, _ := strconv.Atoi(token.Value)
+		return &IntLit{token.Pos, value}
+	case token.Category == tokenizer.StringConst:
+		p.advance()
+		return &StringLit{token.Pos, token.Value}
+	case token.Category == tokenizer.CharConst:
+		p.advance()
+		return &CharLit{token.Pos, token.Value}
+	case token.Category == tokenizer.Keyword && token.IsKeywordConstant():
+		p.advance()
+		return &KeywordLit{token.Pos, token.Value}
+	case token.Category == tokenizer.Identifier:
+		return p.parseIdentifierTerm()
+	case token.Category == tokenizer.Symbol && token.Value == "(":
+		p.advance()
+		x := p.parseExpr()
+		p.expect(")")
+		return &ParenExpr{token.Pos, x}
+	case token.Category == tokenizer.Symbol && token.IsUnaryOp():
+		p.advance()
+		return &UnaryExpr{token.Pos, token.Value, p.parseTerm()}
+	}
+	p.errorf(`expected a term, got "%s"`, token.Value)
+	return nil
+}
+
+func (p *parser) parseIdentifierTerm() Expr {
+	name := p.expectIdent("a name")
+	switch {
+	case p.is("("):
+		return &CallExpr{Name: name, Args: p.parseArgs()}
+	case p.is("."):
+		p.advance()
+		sel := p.expectIdent("a subroutine or constant name")
+		if !p.is("(") {
+			return &SelectorExpr{name, sel}
+		}
+		return &CallExpr{Receiver: name, Name: sel, Args: p.parseArgs()}
+	case p.is("["):
+		p.advance()
+		index := p.parseExpr()
+		p.expect("]")
+		return &IndexExpr{name, index}
+	}
+	return name
+}
+
+func (p *parser) parseArgs() []Expr {
+	p.expect("(")
+	var args []Expr
+	if !p.is(")") {
+		args = append(args, p.parseExpr())
+		for p.is(",") {
+			p.advance()
+			args = append(args, p.parseExpr())
+		}
+	}
+	p.expect(")")
+	return args
+}
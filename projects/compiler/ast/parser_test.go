@@ -0,0 +1,191 @@
+package ast
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// format prints an expression fully parenthesized, so the tests can check how it was grouped.
+func format(e Expr) string {
+	switch e := e.(type) {
+	case *Ident:
+		return e.Name
+	case *IntLit:
+		return fmt.Sprint(e.Value)
+	case *KeywordLit:
+		return e.Value
+	case *UnaryExpr:
+		return e.Op + format(e.X)
+	case *BinaryExpr:
+		return "(" + format(e.X) + " " + e.Op + " " + format(e.Y) + ")"
+	case *ParenExpr:
+		return format(e.X)
+	case *IndexExpr:
+		return e.Name.Name + "[" + format(e.Index) + "]"
+	case *CallExpr:
+		var args []string
+		for _, arg := range e.Args {
+			args = append(args, format(arg))
+		}
+		name := e.Name.Name
+		if e.Receiver != nil {
+			name = e.Receiver.Name + "." + name
+		}
+		return name + "(" + strings.Join(args, ", ") + ")"
+	}
+	return fmt.Sprintf("%T", e)
+}
+
+func TestParseExpressions(t *testing.T) {
+	expressions := []struct {
+		source string
+		mode   Mode
+		want   string
+	}{
+		{"1 + 2 * 3", 0, "((1 + 2) * 3)"},
+		{"1 + 2 * 3", Precedence, "(1 + (2 * 3))"},
+		{"a < b & c = -d", Precedence, "((a < b) & (c = -d))"},
+		{"a[i] + f(1, x.g()) - Math.abs(~b)", 0, "((a[i] + f(1, x.g())) - Math.abs(~b))"},
+		{"i < n && a[i] = 0 || done", Extended, "(((i < n) && (a[i] = 0)) || done)"},
+		{"(1 + 2) * 3", Precedence, "((1 + 2) * 3)"},
+	}
+	for _, e := range expressions {
+		src := "class A { function void f() { return " + e.source + "; } }"
+		class, err := ParseClass(strings.NewReader(src), e.mode)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", e.source, err)
+			continue
+		}
+		got := format(class.Subroutines[0].Body[0].(*ReturnStmt).Value)
+		if got != e.want {
+			t.Errorf("Expression %q was incorrect, got: %s, wanted: %s", e.source, got, e.want)
+		}
+	}
+}
+
+func TestParseClass(t *testing.T) {
+	src := `class Point {
+    field int x, y;
+    static Point origin;
+
+    constructor Point new(int ax, int ay) {
+        var int i;
+        let x = ax;
+        if (ay < 0) { let y = 0; } else { let y = ay; }
+        while (i < 2) { do Output.printInt(i); let i = i + 1; }
+        return this;
+    }
+}`
+	class, err := ParseClass(strings.NewReader(src), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class.Name.Name != "Point" || len(class.Vars) != 2 || len(class.Vars[0].Names) != 2 {
+		t.Errorf("Class declarations were incorrect, got: %+v", class)
+	}
+	sub := class.Subroutines[0]
+	if sub.Kind != "constructor" || sub.ReturnType != "Point" || len(sub.Params) != 2 || len(sub.Locals) != 1 {
+		t.Errorf("Subroutine declaration was incorrect, got: %+v", sub)
+	}
+	var kinds []string
+	for _, s := range sub.Body {
+		kinds = append(kinds, fmt.Sprintf("%T", s))
+	}
+	want := "*ast.LetStmt *ast.IfStmt *ast.WhileStmt *ast.ReturnStmt"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Errorf("Statements were incorrect, got: %s, wanted: %s", got, want)
+	}
+	if pos := sub.Body[1].Pos(); pos.Line != 8 || pos.Column != 9 {
+		t.Errorf("Position of the if was incorrect, got: %s, wanted: 8:9", pos)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	sources := []struct {
+		source string
+		want   string
+	}{
+		{"class A { function void f() { let = 1; } }", `1:35: expected a variable name, got "="`},
+		{"class A { function void f() { do 1; } }", "1:35: expected a subroutine call after do"},
+		{"class A { } x", `1:13: unexpected "x" after the end of the class`},
+		{"class A { function void f() { return 1 + ; } }", `1:42: expected a term, got ";"`},
+	}
+	for _, source := range sources {
+		_, err := ParseClass(strings.NewReader(source.source), 0)
+		if err == nil || err.Error() != source.want {
+			t.Errorf("Error for %q was incorrect, got: %v, wanted: %s", source.source, err, source.want)
+		}
+	}
+}
+
+// TestParsePrograms parses the Jack programs of the course.
+func TestParsePrograms(t *testing.T) {
+	var paths []string
+	for _, pattern := range []string{"../../Snake/*.jack", "../../11/*/*.jack", "../../12/*/*.jack"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, matches...)
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ParseClass(f, 0); err != nil {
+			t.Errorf("Unexpected error for %s: %v", path, err)
+		}
+		f.Close()
+	}
+}
+
+func TestParseDocComments(t *testing.T) {
+	src := `// File name: A.jack
+
+/**
+ * Represents a point.
+ *
+ * Points are immutable.
+ */
+class A {
+    /** The x coordinate. */
+    field int x;
+    static int count; // not a doc comment
+
+    /** Returns the x
+        coordinate. */
+    // a line comment between keeps the doc comment
+    method int getX() {
+        return x;
+    }
+
+    /* an ordinary comment */
+    function void f() { return; }
+}`
+	class, err := ParseClass(strings.NewReader(src), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []struct {
+		got  string
+		want string
+	}{
+		{class.Doc, "Represents a point.\n\nPoints are immutable."},
+		{class.Vars[0].Doc, "The x coordinate."},
+		{class.Vars[1].Doc, ""},
+		{class.Subroutines[0].Doc, "Returns the x\ncoordinate."},
+		{class.Subroutines[1].Doc, ""},
+	}
+	for _, doc := range docs {
+		if doc.got != doc.want {
+			t.Errorf("Doc comment was incorrect, got: %q, wanted: %q", doc.got, doc.want)
+		}
+	}
+	if got, want := class.Subroutines[0].Signature(), "method int getX()"; got != want {
+		t.Errorf("Signature was incorrect, got: %s, wanted: %s", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+package ast
+
+// Inspect calls f for node and, as long as f returns true, for each node below it in source
+// order. Expressions and statements are visited, declarations only through the class and
+// subroutine that hold them.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+	switch n := node.(type) {
+	case *Class:
+		inspectIdent(n.Name, f)
+		for _, v := range n.Vars {
+			Inspect(v, f)
+		}
+		for _, c := range n.Constants {
+			Inspect(c, f)
+		}
+		for _, s := range n.Subroutines {
+			Inspect(s, f)
+		}
+	case *ClassVarDec:
+		for _, name := range n.Names {
+			Inspect(name, f)
+		}
+	case *ConstDec:
+		Inspect(n.Name, f)
+		inspectExpr(n.Value, f)
+	case *Subroutine:
+		Inspect(n.Name, f)
+		for _, param := range n.Params {
+			Inspect(param, f)
+		}
+		for _, local := range n.Locals {
+			Inspect(local, f)
+		}
+		inspectStmts(n.Body, f)
+	case *Param:
+		Inspect(n.Name, f)
+	case *VarDec:
+		for _, name := range n.Names {
+			Inspect(name, f)
+		}
+	case *LetStmt:
+		Inspect(n.Name, f)
+		inspectExpr(n.Index, f)
+		inspectExpr(n.Value, f)
+	case *IfStmt:
+		inspectExpr(n.Cond, f)
+		inspectStmts(n.Then, f)
+		inspectStmts(n.Else, f)
+	case *WhileStmt:
+		inspectExpr(n.Cond, f)
+		inspectStmts(n.Body, f)
+	case *ForStmt:
+		if n.Init != nil {
+			Inspect(n.Init, f)
+		}
+		inspectExpr(n.Cond, f)
+		if n.Step != nil {
+			Inspect(n.Step, f)
+		}
+		inspectStmts(n.Body, f)
+	case *SwitchStmt:
+		inspectExpr(n.Value, f)
+		for _, clause := range n.Cases {
+			Inspect(clause, f)
+		}
+	case *CaseClause:
+		for _, value := range n.Values {
+			inspectExpr(value, f)
+		}
+		inspectStmts(n.Body, f)
+	case *DoStmt:
+		Inspect(n.Call, f)
+	case *ReturnStmt:
+		inspectExpr(n.Value, f)
+	case *IndexExpr:
+		Inspect(n.Name, f)
+		inspectExpr(n.Index, f)
+	case *SelectorExpr:
+		Inspect(n.X, f)
+		Inspect(n.Sel, f)
+	case *CallExpr:
+		if n.Receiver != nil {
+			Inspect(n.Receiver, f)
+		}
+		Inspect(n.Name, f)
+		for _, arg := range n.Args {
+			inspectExpr(arg, f)
+		}
+	case *UnaryExpr:
+		inspectExpr(n.X, f)
+	case *BinaryExpr:
+		inspectExpr(n.X, f)
+		inspectExpr(n.Y, f)
+	case *ParenExpr:
+		inspectExpr(n.X, f)
+	}
+}
+
+// inspectExpr skips a nil expression, an interface holding a nil pointer is not nil.
+func inspectExpr(e Expr, f func(Node) bool) {
+	if e != nil {
+		Inspect(e, f)
+	}
+}
+
+func inspectIdent(ident *Ident, f func(Node) bool) {
+	if ident != nil {
+		Inspect(ident, f)
+	}
+}
+
+func inspectStmts(statements []Stmt, f func(Node) bool) {
+	for _, s := range statements {
+		Inspect(s, f)
+	}
+}
@@ -0,0 +1,283 @@
+package ast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"example.com/tokenizer"
+)
+
+// WriteXML writes the parse tree of a class in the XML of the syntax analyzer of project 10, one
+// element per line indented by two spaces per level. The XML only covers standard Jack, a class
+// using extended-Jack is an error.
+func WriteXML(w io.Writer, c *Class) error {
+	x := &xmlWriter{w: bufio.NewWriter(w)}
+	x.class(c)
+	if x.err != nil {
+		return x.err
+	}
+	return x.w.Flush()
+}
+
+type xmlWriter struct {
+	w     *bufio.Writer
+	depth int
+	// err is the first extended-Jack construct met
+	err error
+}
+
+func (x *xmlWriter) line(s string) {
+	x.w.WriteString(strings.Repeat("  ", x.depth) + s + "\n")
+}
+
+func (x *xmlWriter) open(tag string) {
+	x.line("<" + tag + ">")
+	x.depth++
+}
+
+func (x *xmlWriter) close(tag string) {
+	x.depth--
+	x.line("</" + tag + ">")
+}
+
+func (x *xmlWriter) token(category tokenizer.Category, value string) {
+	x.line(fmt.Sprintf("<%s> %s </%s>", category, tokenizer.Token{Value: value}.Escaped(), category))
+}
+
+func (x *xmlWriter) keyword(value string) {
+	x.token(tokenizer.Keyword, value)
+}
+
+func (x *xmlWriter) symbol(value string) {
+	x.token(tokenizer.Symbol, value)
+}
+
+func (x *xmlWriter) identifier(value string) {
+	x.token(tokenizer.Identifier, value)
+}
+
+// typ writes a type, the primitive types and void are keywords and classes identifiers.
+func (x *xmlWriter) typ(t string) {
+	switch t {
+	case "int", "char", "boolean", "void":
+		x.keyword(t)
+	default:
+		x.identifier(t)
+	}
+}
+
+func (x *xmlWriter) names(names []*Ident) {
+	for i, name := range names {
+		if i > 0 {
+			x.symbol(",")
+		}
+		x.identifier(name.Name)
+	}
+}
+
+func (x *xmlWriter) extended(pos tokenizer.Pos, construct string) {
+	if x.err == nil {
+		x.err = fmt.Errorf("%s: %s is extended-Jack, which has no XML form", pos, construct)
+	}
+}
+
+func (x *xmlWriter) class(c *Class) {
+	x.open("class")
+	x.keyword("class")
+	x.identifier(c.Name.Name)
+	x.symbol("{")
+	for _, dec := range c.Vars {
+		x.open("classVarDec")
+		x.keyword(dec.Kind)
+		x.typ(dec.Type)
+		x.names(dec.Names)
+		x.symbol(";")
+		x.close("classVarDec")
+	}
+	for _, dec := range c.Constants {
+		x.extended(dec.ConstPos, "a class constant")
+	}
+	for _, sub := range c.Subroutines {
+		x.subroutine(sub)
+	}
+	x.symbol("}")
+	x.close("class")
+}
+
+func (x *xmlWriter) subroutine(sub *Subroutine) {
+	x.open("subroutineDec")
+	x.keyword(sub.Kind)
+	x.typ(sub.ReturnType)
+	x.identifier(sub.Name.Name)
+	x.symbol("(")
+	x.open("parameterList")
+	for i, param := range sub.Params {
+		if i > 0 {
+			x.symbol(",")
+		}
+		x.typ(param.Type)
+		x.identifier(param.Name.Name)
+	}
+	x.close("parameterList")
+	x.symbol(")")
+	x.open("subroutineBody")
+	x.symbol("{")
+	for _, dec := range sub.Locals {
+		x.open("varDec")
+		x.keyword("var")
+		x.typ(dec.Type)
+		x.names(dec.Names)
+		x.symbol(";")
+		x.close("varDec")
+	}
+	x.statements(sub.Body)
+	x.symbol("}")
+	x.close("subroutineBody")
+	x.close("subroutineDec")
+}
+
+func (x *xmlWriter) block(stmts []Stmt) {
+	x.symbol("{")
+	x.statements(stmts)
+	x.symbol("}")
+}
+
+func (x *xmlWriter) statements(stmts []Stmt) {
+	x.open("statements")
+	for _, s := range stmts {
+		x.statement(s)
+	}
+	x.close("statements")
+}
+
+func (x *xmlWriter) statement(s Stmt) {
+	switch s := s.(type) {
+	case *LetStmt:
+		x.open("letStatement")
+		x.keyword("let")
+		x.identifier(s.Name.Name)
+		if s.Index != nil {
+			x.symbol("[")
+			x.expression(s.Index)
+			x.symbol("]")
+		}
+		x.symbol("=")
+		x.expression(s.Value)
+		x.symbol(";")
+		x.close("letStatement")
+	case *IfStmt:
+		x.open("ifStatement")
+		x.keyword("if")
+		x.symbol("(")
+		x.expression(s.Cond)
+		x.symbol(")")
+		x.block(s.Then)
+		if s.Else != nil {
+			x.keyword("else")
+			x.block(s.Else)
+		}
+		x.close("ifStatement")
+	case *WhileStmt:
+		x.open("whileStatement")
+		x.keyword("while")
+		x.symbol("(")
+		x.expression(s.Cond)
+		x.symbol(")")
+		x.block(s.Body)
+		x.close("whileStatement")
+	case *DoStmt:
+		x.open("doStatement")
+		x.keyword("do")
+		x.call(s.Call)
+		x.symbol(";")
+		x.close("doStatement")
+	case *ReturnStmt:
+		x.open("returnStatement")
+		x.keyword("return")
+		if s.Value != nil {
+			x.expression(s.Value)
+		}
+		x.symbol(";")
+		x.close("returnStatement")
+	case *ForStmt:
+		x.extended(s.For, "a for loop")
+	case *SwitchStmt:
+		x.extended(s.Switch, "a switch")
+	case *BranchStmt:
+		x.extended(s.KeywordPos, s.Keyword)
+	}
+}
+
+func (x *xmlWriter) expression(e Expr) {
+	x.open("expression")
+	x.operands(e)
+	x.close("expression")
+}
+
+// operands writes the terms and operators of an expression, Jack's expressions are flat.
+func (x *xmlWriter) operands(e Expr) {
+	b, ok := e.(*BinaryExpr)
+	if !ok {
+		x.term(e)
+		return
+	}
+	if b.Op == "&&" || b.Op == "||" {
+		x.extended(b.OpPos, "the "+b.Op+" operator")
+	}
+	x.operands(b.X)
+	x.symbol(b.Op)
+	x.operands(b.Y)
+}
+
+func (x *xmlWriter) term(e Expr) {
+	x.open("term")
+	switch e := e.(type) {
+	case *IntLit:
+		x.token(tokenizer.IntConst, fmt.Sprint(e.Value))
+	case *StringLit:
+		x.token(tokenizer.StringConst, e.Value)
+	case *KeywordLit:
+		x.keyword(e.Value)
+	case *Ident:
+		x.identifier(e.Name)
+	case *IndexExpr:
+		x.identifier(e.Name.Name)
+		x.symbol("[")
+		x.expression(e.Index)
+		x.symbol("]")
+	case *CallExpr:
+		x.call(e)
+	case *UnaryExpr:
+		x.symbol(e.Op)
+		x.term(e.X)
+	case *ParenExpr:
+		x.symbol("(")
+		x.expression(e.X)
+		x.symbol(")")
+	case *CharLit:
+		x.extended(e.ValuePos, "a character constant")
+	case *SelectorExpr:
+		x.extended(e.X.NamePos, "a class constant")
+	}
+	x.close("term")
+}
+
+func (x *xmlWriter) call(e *CallExpr) {
+	if e.Receiver != nil {
+		x.identifier(e.Receiver.Name)
+		x.symbol(".")
+	}
+	x.identifier(e.Name.Name)
+	x.symbol("(")
+	x.open("expressionList")
+	for i, arg := range e.Args {
+		if i > 0 {
+			x.symbol(",")
+		}
+		x.expression(arg)
+	}
+	x.close("expressionList")
+	x.symbol(")")
+}
@@ -0,0 +1,63 @@
+package ast
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestWriteXML compares the parse trees of the programs of project 10 with its comparison files.
+func TestWriteXML(t *testing.T) {
+	paths, err := filepath.Glob("../../10/*/*.jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no programs in ../../10")
+	}
+	for _, path := range paths {
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := ioutil.ReadFile(strings.TrimSuffix(path, ".jack") + ".xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		class, err := ParseClass(strings.NewReader(string(source)), 0)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", path, err)
+			continue
+		}
+		var got strings.Builder
+		if err := WriteXML(&got, class); err != nil {
+			t.Errorf("Unexpected error for %s: %v", path, err)
+			continue
+		}
+		if got.String() != strings.ReplaceAll(string(want), "\r\n", "\n") {
+			t.Errorf("XML of %s was incorrect, got:\n%s", path, got.String())
+		}
+	}
+}
+
+func TestWriteXMLExtended(t *testing.T) {
+	sources := []struct {
+		source string
+		want   string
+	}{
+		{"class A { const int N = 1; }", "1:11: a class constant is extended-Jack, which has no XML form"},
+		{"class A { function void f() { for (;;) { break; } return; } }", "1:31: a for loop is extended-Jack, which has no XML form"},
+		{"class A { function boolean f() { return true && false; } }", "1:46: the && operator is extended-Jack, which has no XML form"},
+	}
+	for _, source := range sources {
+		class, err := ParseClass(strings.NewReader(source.source), Extended)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = WriteXML(&strings.Builder{}, class)
+		if err == nil || err.Error() != source.want {
+			t.Errorf("Error for %q was incorrect, got: %v, wanted: %s", source.source, err, source.want)
+		}
+	}
+}
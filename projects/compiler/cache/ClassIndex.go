@@ -0,0 +1,265 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type SubroutineKind uint8
+
+const (
+	Constructor SubroutineKind = iota
+	Function
+	Method
+)
+
+func (k SubroutineKind) String() string {
+	switch k {
+	case Constructor:
+		return "constructor"
+	case Function:
+		return "function"
+	case Method:
+		return "method"
+	default:
+		return ""
+	}
+}
+
+func ParseSubroutineKind(kind string) (SubroutineKind, bool) {
+	switch kind {
+	case "constructor":
+		return Constructor, true
+	case "function":
+		return Function, true
+	case "method":
+		return Method, true
+	default:
+		return 0, false
+	}
+}
+
+type Param struct {
+	Name string
+	Type string
+}
+
+// Subroutine is the signature of a constructor, function or method as seen from outside the class.
+type Subroutine struct {
+	Name       string
+	Kind       SubroutineKind
+	ReturnType string
+	Params     []Param
+}
+
+// Constant is an extended-Jack class constant. Init is the source of its initializer, laid out
+// at the line and column it has in the class file so errors in it point at the right place.
+// Value is only meaningful once Resolved is set.
+type Constant struct {
+	Name     string
+	Type     string
+	Init     string
+	Value    int16
+	Resolved bool
+}
+
+// Class holds the public shape of a class, built by a declaration-only pass over its source.
+type Class struct {
+	Name        string
+	Subroutines map[string]*Subroutine
+	Constants   map[string]*Constant
+	os          bool
+}
+
+func NewClass(name string) *Class {
+	return &Class{Name: name, Subroutines: make(map[string]*Subroutine), Constants: make(map[string]*Constant)}
+}
+
+func (c *Class) AddConstant(constant *Constant) error {
+	if _, ok := c.Constants[constant.Name]; ok {
+		return fmt.Errorf("constant %s.%s is declared more than once", c.Name, constant.Name)
+	}
+	c.Constants[constant.Name] = constant
+	return nil
+}
+
+func (c *Class) AddSubroutine(sub *Subroutine) error {
+	if _, ok := c.Subroutines[sub.Name]; ok {
+		return fmt.Errorf("subroutine %s.%s is declared more than once", c.Name, sub.Name)
+	}
+	c.Subroutines[sub.Name] = sub
+	return nil
+}
+
+func (c *Class) Subroutine(name string) (*Subroutine, bool) {
+	sub, ok := c.Subroutines[name]
+	return sub, ok
+}
+
+// ClassIndex maps class names to their declarations across a whole program, so that calls
+// into other files can be checked while compiling a single class.
+type ClassIndex struct {
+	classes map[string]*Class
+}
+
+func NewClassIndex() *ClassIndex {
+	return &ClassIndex{make(map[string]*Class)}
+}
+
+// NewProgramIndex returns an index pre-populated with the Jack OS classes.
+func NewProgramIndex() *ClassIndex {
+	index := NewClassIndex()
+	for _, class := range OSClasses() {
+		index.classes[class.Name] = class
+	}
+	return index
+}
+
+// Add registers a class. A class compiled from source replaces an OS class of the same name,
+// so a project can provide its own implementation of the OS (as in project 12).
+func (ci *ClassIndex) Add(class *Class) error {
+	if existing, ok := ci.classes[class.Name]; ok && !existing.os {
+		return fmt.Errorf("class %s is declared more than once", class.Name)
+	}
+	ci.classes[class.Name] = class
+	return nil
+}
+
+func (ci *ClassIndex) Class(name string) (*Class, bool) {
+	class, ok := ci.classes[name]
+	return class, ok
+}
+
+// Classes returns every class of the index sorted by name.
+func (ci *ClassIndex) Classes() []*Class {
+	classes := make([]*Class, 0, len(ci.classes))
+	for _, class := range ci.classes {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i].Name < classes[j].Name
+	})
+	return classes
+}
+
+// Constant looks up the constant className.name.
+func (ci *ClassIndex) Constant(className string, name string) (*Constant, bool) {
+	class, ok := ci.classes[className]
+	if !ok {
+		return nil, false
+	}
+	constant, ok := class.Constants[name]
+	return constant, ok
+}
+
+// Subroutine looks up className.name, reporting whether the class and the subroutine exist.
+func (ci *ClassIndex) Subroutine(className string, name string) (sub *Subroutine, classFound bool, subFound bool) {
+	class, ok := ci.classes[className]
+	if !ok {
+		return nil, false, false
+	}
+	sub, ok = class.Subroutine(name)
+	return sub, true, ok
+}
+
+var osClassNames = []string{"Math", "String", "Array", "Output", "Screen", "Keyboard", "Memory", "Sys"}
+
+// osAPI describes the Jack OS as documented in the nand2tetris book, one subroutine per line.
+var osAPI = []string{
+	"function void Math.init()",
+	"function int Math.abs(int x)",
+	"function int Math.multiply(int x, int y)",
+	"function int Math.divide(int x, int y)",
+	"function int Math.min(int x, int y)",
+	"function int Math.max(int x, int y)",
+	"function int Math.sqrt(int x)",
+
+	"constructor String String.new(int maxLength)",
+	"method void String.dispose()",
+	"method int String.length()",
+	"method char String.charAt(int j)",
+	"method void String.setCharAt(int j, char c)",
+	"method String String.appendChar(char c)",
+	"method void String.eraseLastChar()",
+	"method int String.intValue()",
+	"method void String.setInt(int val)",
+	"function char String.backSpace()",
+	"function char String.doubleQuote()",
+	"function char String.newLine()",
+
+	"function Array Array.new(int size)",
+	"method void Array.dispose()",
+
+	"function void Output.init()",
+	"function void Output.moveCursor(int i, int j)",
+	"function void Output.printChar(char c)",
+	"function void Output.printString(String s)",
+	"function void Output.printInt(int i)",
+	"function void Output.println()",
+	"function void Output.backSpace()",
+
+	"function void Screen.init()",
+	"function void Screen.clearScreen()",
+	"function void Screen.setColor(boolean b)",
+	"function void Screen.drawPixel(int x, int y)",
+	"function void Screen.drawLine(int x1, int y1, int x2, int y2)",
+	"function void Screen.drawRectangle(int x1, int y1, int x2, int y2)",
+	"function void Screen.drawCircle(int x, int y, int r)",
+
+	"function void Keyboard.init()",
+	"function char Keyboard.keyPressed()",
+	"function char Keyboard.readChar()",
+	"function String Keyboard.readLine(String message)",
+	"function int Keyboard.readInt(String message)",
+
+	"function void Memory.init()",
+	"function int Memory.peek(int address)",
+	"function void Memory.poke(int address, int value)",
+	"function Array Memory.alloc(int size)",
+	"function void Memory.deAlloc(Array o)",
+
+	"function void Sys.init()",
+	"function void Sys.halt()",
+	"function void Sys.error(int errorCode)",
+	"function void Sys.wait(int duration)",
+}
+
+// OSClasses returns a fresh copy of the OS class declarations.
+func OSClasses() []*Class {
+	classes := make(map[string]*Class)
+	for _, name := range osClassNames {
+		classes[name] = NewClass(name)
+		classes[name].os = true
+	}
+	for _, line := range osAPI {
+		className, sub := parseOSDeclaration(line)
+		if err := classes[className].AddSubroutine(sub); err != nil {
+			panic(err)
+		}
+	}
+	result := make([]*Class, 0, len(osClassNames))
+	for _, name := range osClassNames {
+		result = append(result, classes[name])
+	}
+	return result
+}
+
+func parseOSDeclaration(line string) (string, *Subroutine) {
+	open := strings.Index(line, "(")
+	head := strings.Fields(line[:open])
+	kind, ok := ParseSubroutineKind(head[0])
+	if !ok || len(head) != 3 {
+		panic(fmt.Sprintf("invalid OS declaration: %s", line))
+	}
+	qualifiedName := strings.SplitN(head[2], ".", 2)
+	sub := &Subroutine{Name: qualifiedName[1], Kind: kind, ReturnType: head[1]}
+	params := strings.TrimSuffix(line[open+1:], ")")
+	if params != "" {
+		for _, param := range strings.Split(params, ",") {
+			fields := strings.Fields(param)
+			sub.Params = append(sub.Params, Param{Name: fields[1], Type: fields[0]})
+		}
+	}
+	return qualifiedName[0], sub
+}
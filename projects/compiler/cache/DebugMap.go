@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DebugMap relates the VM code of a class compiled in debug mode to its Jack source, it is
+// written next to the .vm file for VM debuggers and profilers.
+type DebugMap struct {
+	Source string `json:"source"`
+	// Lines maps every command of the .vm file to the Jack line it was compiled from
+	Lines     []LineMapping   `json:"lines"`
+	Functions []FunctionSlots `json:"functions"`
+}
+
+// LineMapping relates a line of the .vm file, counted from 1 like the comments, to a source
+// line and the subroutine it is in.
+type LineMapping struct {
+	VMLine     int    `json:"vmLine"`
+	Line       int    `json:"line"`
+	Subroutine string `json:"subroutine"`
+}
+
+// FunctionSlots names the argument and local slots of a VM function, by segment index.
+type FunctionSlots struct {
+	Name      string   `json:"name"`
+	Arguments []string `json:"arguments"`
+	Locals    []string `json:"locals"`
+}
+
+// sourceLine matches the comment the compiler writes before the code of a source line.
+var sourceLine = regexp.MustCompile(`^// [^:]*:(\d+): `)
+
+// NewDebugMap reads the VM code of a class compiled in debug mode. Each command maps to the
+// source line of the comment before it: the code of a statement follows its comment, the
+// function command and the code that sets up this follow the comment of the declaration.
+// The slot names come from the symbols of the class.
+func NewDebugMap(source string, vm io.Reader, symbols ClassSymbols) (*DebugMap, error) {
+	m := &DebugMap{Source: source, Lines: []LineMapping{}, Functions: []FunctionSlots{}}
+	scanner := bufio.NewScanner(vm)
+	line, subroutine := 0, ""
+	for vmLine := 1; scanner.Scan(); vmLine++ {
+		text := strings.TrimSpace(scanner.Text())
+		if match := sourceLine.FindStringSubmatch(text); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			continue
+		}
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+		if fields := strings.Fields(text); fields[0] == "function" && len(fields) > 1 {
+			subroutine = fields[1]
+		}
+		m.Lines = append(m.Lines, LineMapping{vmLine, line, subroutine})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, sub := range symbols.Subroutines {
+		f := FunctionSlots{Name: symbols.Class + "." + sub.Name, Arguments: []string{}, Locals: []string{}}
+		for _, symbol := range sub.Symbols {
+			switch symbol.Kind {
+			case Arg:
+				f.Arguments = append(f.Arguments, symbol.Name)
+			case Var:
+				f.Locals = append(f.Locals, symbol.Name)
+			}
+		}
+		m.Functions = append(m.Functions, f)
+	}
+	return m, nil
+}
@@ -1,21 +1,52 @@
 package cache
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
 
-type table map[string]map[string]interface{}
+// Symbol is an entry of the symbol table, Index is its position within the VM segment of its Kind.
+type Symbol struct {
+	Name  string
+	Type  string
+	Kind  Kind
+	Index int
+}
 
-func newTable() table {
-	return make(map[string]map[string]interface{})
+// MarshalJSON includes the VM segment of the symbol so that tools reading a symbol dump can map
+// "push local 2" back to a Jack name without knowing the compiler's conventions.
+func (s Symbol) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name    string `json:"name"`
+		Type    string `json:"type"`
+		Kind    string `json:"kind"`
+		Segment string `json:"segment"`
+		Index   int    `json:"index"`
+	}{s.Name, s.Type, s.Kind.String(), s.Kind.Segment(), s.Index})
 }
 
-func (t table) newEntry(name string, symbolType string, kind Kind, index int) {
-	t[name] = map[string]interface{}{"type": symbolType, "kind": kind, "index": index}
+type scope map[string]Symbol
+
+// symbols returns the scope ordered by kind then index, the order the symbols were defined in.
+func (s scope) symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s))
+	for _, symbol := range s {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].Kind != symbols[j].Kind {
+			return symbols[i].Kind < symbols[j].Kind
+		}
+		return symbols[i].Index < symbols[j].Index
+	})
+	return symbols
 }
 
 type SymbolTable struct {
-	classTable      table
-	subroutineTable table
-	FieldIndex      int
+	classScope      scope
+	subroutineScope scope
+	fieldIndex      int
 	staticIndex     int
 	varIndex        int
 	argIndex        int
@@ -23,9 +54,9 @@ type SymbolTable struct {
 
 func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{
-		classTable:      newTable(),
-		subroutineTable: newTable(),
-		FieldIndex:      0,
+		classScope:      make(scope),
+		subroutineScope: make(scope),
+		fieldIndex:      0,
 		staticIndex:     0,
 		varIndex:        0,
 		argIndex:        0,
@@ -33,7 +64,7 @@ func NewSymbolTable() *SymbolTable {
 }
 
 func (s *SymbolTable) StartSubroutine() {
-	s.subroutineTable = newTable()
+	s.subroutineScope = make(scope)
 	s.varIndex = 0
 	s.argIndex = 0
 }
@@ -63,6 +94,22 @@ func (s Kind) String() string {
 	}
 }
 
+// Segment returns the name of the VM segment that holds symbols of this kind.
+func (s Kind) Segment() string {
+	switch s {
+	case Var:
+		return "local"
+	case Arg:
+		return "argument"
+	case Static:
+		return "static"
+	case Field:
+		return "this"
+	default:
+		return ""
+	}
+}
+
 func ParseKind(kind string) Kind {
 	switch kind {
 	case "var":
@@ -78,23 +125,30 @@ func ParseKind(kind string) Kind {
 	}
 }
 
-func (s *SymbolTable) Define(name string, symbolType string, kind Kind) {
+// Define adds a symbol to the scope of its kind and returns it with its segment index.
+func (s *SymbolTable) Define(name string, symbolType string, kind Kind) Symbol {
+	symbol := Symbol{Name: name, Type: symbolType, Kind: kind}
 	switch kind {
 	case Var:
-		s.subroutineTable.newEntry(name, symbolType, kind, s.varIndex)
+		symbol.Index = s.varIndex
+		s.subroutineScope[name] = symbol
 		s.varIndex++
 	case Arg:
-		s.subroutineTable.newEntry(name, symbolType, kind, s.argIndex)
+		symbol.Index = s.argIndex
+		s.subroutineScope[name] = symbol
 		s.argIndex++
 	case Static:
-		s.classTable.newEntry(name, symbolType, kind, s.staticIndex)
+		symbol.Index = s.staticIndex
+		s.classScope[name] = symbol
 		s.staticIndex++
 	case Field:
-		s.classTable.newEntry(name, symbolType, kind, s.FieldIndex)
-		s.FieldIndex++
+		symbol.Index = s.fieldIndex
+		s.classScope[name] = symbol
+		s.fieldIndex++
 	default:
 		panic(fmt.Sprintf("invalid symbol kind: %s", kind))
 	}
+	return symbol
 }
 
 func (s *SymbolTable) VarCount(kind Kind) int {
@@ -106,42 +160,40 @@ func (s *SymbolTable) VarCount(kind Kind) int {
 	case Static:
 		return s.staticIndex
 	case Field:
-		return s.FieldIndex
+		return s.fieldIndex
 	}
 	return -1
 }
 
-func (s *SymbolTable) KindOf(name string) Kind {
-	if kind, ok := s.classTable[name]["kind"]; ok {
-		return kind.(Kind)
-	}
-
-	if kind, ok := s.subroutineTable[name]["kind"]; ok {
-		return kind.(Kind)
+// Lookup finds name in the subroutine scope, then in the class scope.
+func (s *SymbolTable) Lookup(name string) (Symbol, bool) {
+	if symbol, ok := s.subroutineScope[name]; ok {
+		return symbol, true
 	}
-	return None
+	symbol, ok := s.classScope[name]
+	return symbol, ok
 }
 
-func (s *SymbolTable) TypeOf(name string) string {
-	if symbolType, ok := s.classTable[name]["type"]; ok {
-		return symbolType.(string)
-	}
-
-	if symbolType, ok := s.subroutineTable[name]["type"]; ok {
-		return symbolType.(string)
-	}
-
-	return ""
+// ClassScope returns the statics and fields of the class.
+func (s *SymbolTable) ClassScope() []Symbol {
+	return s.classScope.symbols()
 }
 
-func (s *SymbolTable) IndexOf(name string) int {
-	if index, ok := s.classTable[name]["index"]; ok {
-		return index.(int)
-	}
+// SubroutineScope returns the arguments and locals of the current subroutine.
+func (s *SymbolTable) SubroutineScope() []Symbol {
+	return s.subroutineScope.symbols()
+}
 
-	if index, ok := s.subroutineTable[name]["index"]; ok {
-		return index.(int)
-	}
+// ClassSymbols records every scope of a compiled class, it is what the compiler dumps for
+// editors and debuggers.
+type ClassSymbols struct {
+	Class       string              `json:"class"`
+	Symbols     []Symbol            `json:"symbols"`
+	Subroutines []SubroutineSymbols `json:"subroutines"`
+}
 
-	return -1
+type SubroutineSymbols struct {
+	Name    string   `json:"name"`
+	Kind    string   `json:"kind"`
+	Symbols []Symbol `json:"symbols"`
 }
@@ -0,0 +1,57 @@
+package cache
+
+import "testing"
+
+func TestSymbolTable(t *testing.T) {
+	s := NewSymbolTable()
+	s.Define("count", "int", Static)
+	s.Define("x", "int", Field)
+	s.Define("y", "int", Field)
+	s.StartSubroutine()
+	s.Define("this", "Point", Arg)
+	s.Define("dx", "int", Arg)
+	s.Define("x", "boolean", Var)
+
+	symbols := []struct {
+		name   string
+		found  bool
+		symbol Symbol
+	}{
+		{"count", true, Symbol{"count", "int", Static, 0}},
+		{"y", true, Symbol{"y", "int", Field, 1}},
+		{"dx", true, Symbol{"dx", "int", Arg, 1}},
+		{"x", true, Symbol{"x", "boolean", Var, 0}},
+		{"z", false, Symbol{}},
+	}
+	for _, symbol := range symbols {
+		got, found := s.Lookup(symbol.name)
+		if found != symbol.found {
+			t.Errorf("Lookup(%s) found was incorrect, got: %t, wanted: %t", symbol.name, found, symbol.found)
+		}
+		if got != symbol.symbol {
+			t.Errorf("Lookup(%s) was incorrect, got: %+v, wanted: %+v", symbol.name, got, symbol.symbol)
+		}
+	}
+
+	if count := s.VarCount(Field); count != 2 {
+		t.Errorf("VarCount(Field) was incorrect, got: %d, wanted: 2", count)
+	}
+	scope := s.SubroutineScope()
+	names := []string{"x", "this", "dx"}
+	if len(scope) != len(names) {
+		t.Fatalf("SubroutineScope length was incorrect, got: %d, wanted: %d", len(scope), len(names))
+	}
+	for i, name := range names {
+		if scope[i].Name != name {
+			t.Errorf("SubroutineScope()[%d] was incorrect, got: %s, wanted: %s", i, scope[i].Name, name)
+		}
+	}
+
+	s.StartSubroutine()
+	if _, found := s.Lookup("dx"); found {
+		t.Errorf("StartSubroutine did not clear the subroutine scope")
+	}
+	if got, _ := s.Lookup("x"); got.Kind != Field {
+		t.Errorf("Lookup(x) after StartSubroutine was incorrect, got: %s, wanted: field", got.Kind)
+	}
+}
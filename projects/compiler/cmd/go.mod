@@ -8,6 +8,8 @@ require (
 	example.com/engine v0.0.0
 	example.com/tokenizer v0.0.0
 	example.com/writer v0.0.0
+	vm/interpreter v0.0.0
+	vm/parser v0.0.0
 )
 
 replace (
@@ -16,4 +18,6 @@ replace (
 	example.com/engine => ../engine
 	example.com/tokenizer => ../tokenizer
 	example.com/writer => ../writer
+	vm/interpreter => ../../vm/interpreter
+	vm/parser => ../../vm/parser
 )
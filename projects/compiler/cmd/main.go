@@ -1,12 +1,25 @@
 package main
 
 import (
-	"os"
+	"flag"
+	"log"
 
 	"example.com/compiler"
 )
 
 func main() {
-	args := os.Args[1:]
-	compiler.Compile(args[0])
+	strict := flag.Bool("strict", false, "type check assignments, arguments and return values")
+	precedence := flag.Bool("precedence", false, "evaluate operators by conventional precedence instead of left to right")
+	extended := flag.Bool("extended", false, "accept extended-Jack: for loops, break, continue, else if, switch, && and ||, char constants, string escapes and class constants")
+	optimize := flag.Bool("optimize", false, "fold constant subexpressions at compile time")
+	symbols := flag.Bool("symbols", false, "write the symbol table of each class as JSON next to its .vm file")
+	debug := flag.Bool("debug", false, "write the source line of each statement as a comment in the .vm file and a .vm.map file mapping its lines to the source")
+	jobs := flag.Int("j", 0, "number of classes compiled at once, 0 compiles one class per CPU")
+	incremental := flag.Bool("incremental", false, "only compile the classes that changed since the last incremental build")
+	flag.Parse()
+	options := compiler.Options{Strict: *strict, Precedence: *precedence, Extended: *extended, Optimize: *optimize, Symbols: *symbols,
+		Debug: *debug, Jobs: *jobs, Incremental: *incremental}
+	if err := compiler.Compile(flag.Arg(0), options); err != nil {
+		log.Fatal(err)
+	}
 }
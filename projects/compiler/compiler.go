@@ -2,45 +2,177 @@ package compiler
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 
+	"example.com/cache"
 	"example.com/engine"
 )
 
-func compileFile(path string) {
-	outPath := strings.Replace(path, ".jack", ".vm", 1)
-	outFile, err := os.Create(outPath)
+// ErrorList collects every error found while compiling a program so they can be reported together.
+type ErrorList []error
+
+func (e ErrorList) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Options selects optional compiler behaviour.
+type Options struct {
+	// Strict type checks assignments, arguments and return values, mismatches are logged as warnings.
+	Strict bool
+	// Precedence evaluates operators by their usual precedence instead of strictly left to right.
+	Precedence bool
+	// Extended accepts extended-Jack, see engine.Options.
+	Extended bool
+	// Optimize folds constant subexpressions at compile time.
+	Optimize bool
+	// Symbols writes the symbol table of each class to a .symbols.json file next to its .vm file.
+	Symbols bool
+	// Debug writes the source line of each statement as a comment before its VM code, and a
+	// .vm.map file next to each .vm file that maps its lines back to the source, see
+	// cache.DebugMap.
+	Debug bool
+	// Jobs bounds the number of classes compiled at once, 0 compiles one class per CPU.
+	Jobs int
+	// Incremental skips the classes whose source, options and program declarations are the ones
+	// recorded in the manifest of their folder, and whose output was not changed since.
+	Incremental bool
+}
+
+// compileFile compiles the class at path into its .vm file. It runs on a worker of runJobs, so
+// failing to read or write a file is returned with the errors of the class.
+func compileFile(path string, options engine.Options, dumpSymbols bool) (errs []error, warnings []error) {
+	outFile, err := os.Create(vmPath(path))
 	if err != nil {
-		log.Fatal(err)
+		return []error{err}, nil
 	}
 	defer func() {
 		if err := outFile.Close(); err != nil {
-			log.Fatal(err)
+			errs = append(errs, err)
 		}
 	}()
 
-	writer := bufio.NewWriter(outFile)
-	defer func() {
-		if err := writer.Flush(); err != nil {
-			log.Fatal(err)
-		}
-	}()
+	// in debug mode the code is kept to map its lines back to the source
+	var output io.Writer = outFile
+	var code bytes.Buffer
+	if options.Debug {
+		output = io.MultiWriter(outFile, &code)
+	}
+	writer := bufio.NewWriter(output)
 
 	file, err := os.Open(path)
 	if err != nil {
-		log.Fatal(err)
+		return []error{err}, nil
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
-			log.Fatal(err)
+			errs = append(errs, err)
 		}
 	}()
 
-	compilationEngine := engine.NewCompilationEngine(file, writer)
+	// the comments and the map name the file, which may differ from the class
+	options.Source = filepath.Base(path)
+	compilationEngine := engine.NewCompilationEngine(file, writer, options)
 	compilationEngine.CompileClass()
+	if err := writer.Flush(); err != nil {
+		return []error{err}, nil
+	}
+	errs = compilationEngine.Errors()
+	for i, err := range errs {
+		errs[i] = fmt.Errorf("%s:%v", path, err)
+	}
+	warnings = compilationEngine.Warnings()
+	for i, warning := range warnings {
+		warnings[i] = fmt.Errorf("%s:%v", path, warning)
+	}
+	if dumpSymbols {
+		if err := writeSymbols(symbolsPath(path), compilationEngine.Symbols()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if options.Debug {
+		if err := writeDebugMap(path, options.Source, &code, compilationEngine.Symbols()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs, warnings
+}
+
+// writeDebugMap writes the map of the VM code of a class compiled in debug mode, source is the
+// file name its comments give.
+func writeDebugMap(path string, source string, code io.Reader, symbols cache.ClassSymbols) error {
+	m, err := cache.NewDebugMap(source, code, symbols)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(debugMapPath(path), append(data, '\n'), 0644)
+}
+
+// writeSymbols dumps the scopes of a class as JSON, so editors and debuggers can map VM
+// segments back to Jack variable names.
+func writeSymbols(path string, symbols cache.ClassSymbols) error {
+	data, err := json.MarshalIndent(symbols, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// buildIndex runs the declaration pass over every class of the program.
+func buildIndex(jackFiles []string, options engine.Options) (*cache.ClassIndex, error) {
+	index := cache.NewProgramIndex()
+	var errs ErrorList
+	paths := make(map[string]string)
+	for _, path := range jackFiles {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		class, err := engine.ScanClass(file, options)
+		file.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%v", path, err))
+		} else if err := index.Add(class); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", path, err))
+		} else {
+			paths[class.Name] = path
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	constantErrs := engine.ResolveConstants(index, options)
+	for _, class := range index.Classes() {
+		for _, err := range constantErrs[class.Name] {
+			errs = append(errs, fmt.Errorf("%s:%v", paths[class.Name], err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return index, nil
+}
+
+func isJackFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".jack")
 }
 
 func getJackFiles(jackFiles *[]string) filepath.WalkFunc {
@@ -48,32 +180,166 @@ func getJackFiles(jackFiles *[]string) filepath.WalkFunc {
 		if err != nil {
 			return err
 		}
-		if filepath.Ext(path) == ".jack" {
+		if isJackFile(path) {
 			*jackFiles = append(*jackFiles, path)
 		}
 		return nil
 	}
 }
 
+// indexProgram indexes the program in dir, which is every class in that folder but not in
+// its sub folders.
+func indexProgram(dir string, options engine.Options) (*cache.ClassIndex, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return nil, err
+	}
+	var jackFiles []string
+	for _, path := range paths {
+		if isJackFile(path) {
+			jackFiles = append(jackFiles, path)
+		}
+	}
+	return buildIndex(jackFiles, options)
+}
+
+// job is the compilation of one class. The results are kept with the job so that errors and
+// warnings are reported in file order however the classes were scheduled.
+type job struct {
+	path     string
+	options  engine.Options
+	symbols  bool
+	manifest *manifest
+	program  string
+
+	key      string
+	skipped  bool
+	errs     []error
+	warnings []error
+}
+
+func (j *job) run() {
+	if j.manifest != nil {
+		key, err := fileKey(j.path, j.options, j.symbols, j.program)
+		if err != nil {
+			j.errs = []error{err}
+			return
+		}
+		j.key = key
+		var sidecars []string
+		if j.symbols {
+			sidecars = append(sidecars, symbolsPath(j.path))
+		}
+		if j.options.Debug {
+			sidecars = append(sidecars, debugMapPath(j.path))
+		}
+		if warnings, ok := j.manifest.upToDate(j.path, key, sidecars); ok {
+			for _, warning := range warnings {
+				j.warnings = append(j.warnings, errors.New(warning))
+			}
+			j.skipped = true
+			return
+		}
+	}
+	j.errs, j.warnings = compileFile(j.path, j.options, j.symbols)
+}
+
+// runJobs runs the jobs on at most workers goroutines.
+func runJobs(jobs []*job, workers int) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	queue := make(chan *job)
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(jobs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				j.run()
+			}
+		}()
+	}
+	for _, j := range jobs {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+}
+
 // Compile takes a path to a folder or a file and compiles the .jack files/file
-// into an xml document defining the grammar and structure of the jack code.
-func Compile(path string) {
+// into .vm files. A Jack program is the set of classes in one folder, so the classes of each
+// folder are indexed first to check the calls between them. The classes are then compiled
+// concurrently, the errors are reported in file order.
+func Compile(path string, options Options) error {
 	path = filepath.Clean(path)
 	fileInfo, err := os.Stat(path)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	var jackFiles []string
 	if fileInfo.IsDir() {
-		var jackFiles []string
-		err := filepath.Walk(path, getJackFiles(&jackFiles))
-		if err != nil {
-			log.Fatal(err)
+		if err := filepath.Walk(path, getJackFiles(&jackFiles)); err != nil {
+			return err
+		}
+	} else {
+		jackFiles = []string{path}
+	}
+
+	var errs ErrorList
+	languageOptions := engine.Options{Extended: options.Extended, Optimize: options.Optimize}
+	indexes := make(map[string]*cache.ClassIndex)
+	programs := make(map[string]string)
+	manifests := make(map[string]*manifest)
+	var dirs []string
+	var jobs, pending []*job
+	for _, path = range jackFiles {
+		dir := filepath.Dir(path)
+		index, ok := indexes[dir]
+		if !ok {
+			if index, err = indexProgram(dir, languageOptions); err != nil {
+				// kept in place of the folder's classes so the errors stay in file order
+				jobs = append(jobs, &job{errs: []error{err}})
+			}
+			indexes[dir] = index
+			if index != nil && options.Incremental {
+				if programs[dir], err = programKey(index); err != nil {
+					return err
+				}
+				manifests[dir] = loadManifest(dir)
+				dirs = append(dirs, dir)
+			}
+		}
+		if index == nil {
+			continue
 		}
+		engineOptions := languageOptions
+		engineOptions.Classes = index
+		engineOptions.Strict = options.Strict
+		engineOptions.Precedence = options.Precedence
+		engineOptions.Debug = options.Debug
+		j := &job{path: path, options: engineOptions, symbols: options.Symbols, manifest: manifests[dir], program: programs[dir]}
+		jobs = append(jobs, j)
+		pending = append(pending, j)
+	}
 
-		for _, path = range jackFiles {
-			compileFile(path)
+	runJobs(pending, options.Jobs)
+	for _, j := range jobs {
+		for _, warning := range j.warnings {
+			log.Print(warning)
 		}
-	} else {
-		compileFile(path)
+		errs = append(errs, j.errs...)
+		if j.manifest != nil && !j.skipped {
+			j.manifest.record(j.path, j.key, j.errs, j.warnings)
+		}
+	}
+	for _, dir := range dirs {
+		if err := manifests[dir].save(dir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
 	}
+	return nil
 }
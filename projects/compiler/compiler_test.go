@@ -0,0 +1,422 @@
+package compiler
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/cache"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of TestGolden")
+
+func writeClasses(t *testing.T, dir string, classes map[string]string) {
+	for name, source := range classes {
+		if err := ioutil.WriteFile(filepath.Join(dir, name+".jack"), []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// compiled returns the classes of dir whose .vm file was written by the last compilation,
+// the .vm files of every class are first dated back.
+func compiled(t *testing.T, dir string, options Options, classes ...string) []string {
+	old := time.Now().Add(-time.Hour)
+	for _, class := range classes {
+		os.Chtimes(filepath.Join(dir, class+".vm"), old, old)
+	}
+	if err := Compile(dir, options); err != nil {
+		t.Fatal(err)
+	}
+	var written []string
+	for _, class := range classes {
+		info, err := os.Stat(filepath.Join(dir, class+".vm"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.ModTime().After(old) {
+			written = append(written, class)
+		}
+	}
+	return written
+}
+
+func TestIncrementalCompile(t *testing.T) {
+	dir := t.TempDir()
+	writeClasses(t, dir, map[string]string{
+		"Main": "class Main { function void main() { do Util.f(); return; } }",
+		"Util": "class Util { function void f() { return; } }",
+		"Game": "class Game { field int x; method void run() { return; } }",
+	})
+	options := Options{Incremental: true, Jobs: 2}
+	steps := []struct {
+		change func()
+		want   string
+	}{
+		{func() {}, "Main Util Game"},
+		{func() {}, ""},
+		// a body changed, only that class is compiled again
+		{func() {
+			writeClasses(t, dir, map[string]string{"Util": "class Util { function void f() { var int x; let x = 1; return; } }"})
+		}, "Util"},
+		// a declaration changed, the calls to it may compile differently
+		{func() {
+			writeClasses(t, dir, map[string]string{"Util": "class Util { function int f() { return 1; } }"})
+		}, "Main Util Game"},
+		{func() { os.Remove(filepath.Join(dir, "Game.vm")) }, "Game"},
+		{func() { options.Optimize = true }, "Main Util Game"},
+		{func() { ioutil.WriteFile(filepath.Join(dir, manifestName), []byte(`{"version":"0"}`), 0644) }, "Main Util Game"},
+	}
+	for i, step := range steps {
+		step.change()
+		got := strings.Join(compiled(t, dir, options, "Main", "Util", "Game"), " ")
+		if got != step.want {
+			t.Errorf("Classes compiled in step %d were incorrect, got: %s, wanted: %s", i, got, step.want)
+		}
+	}
+}
+
+func TestCompileErrorOrder(t *testing.T) {
+	dir := t.TempDir()
+	classes := map[string]string{}
+	var want []string
+	for _, name := range []string{"A", "B", "C", "D", "E", "F", "G", "H"} {
+		classes[name] = "class " + name + " { function void f() { do Nope.g(); return; } }"
+		want = append(want, filepath.Join(dir, name+".jack"))
+	}
+	writeClasses(t, dir, classes)
+	for i := 0; i < 5; i++ {
+		err := Compile(dir, Options{Jobs: 4})
+		if err == nil {
+			t.Fatal("Compile of classes calling an unknown class was incorrect, got: nil, wanted: an error")
+		}
+		var got []string
+		for _, e := range err.(ErrorList) {
+			got = append(got, strings.SplitN(e.Error(), ":", 2)[0])
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Fatalf("Error order was incorrect, got: %s, wanted: %s", got, want)
+		}
+	}
+}
+
+// TestUnwritableOutput checks that a .vm file that cannot be created fails its class only, the
+// other classes are compiled and the manifest is saved.
+func TestUnwritableOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeClasses(t, dir, map[string]string{
+		"Main": "class Main { function void main() { do Util.f(); return; } }",
+		"Util": "class Util { function void f() { return; } }",
+	})
+	// a folder in place of Main.vm
+	if err := os.Mkdir(filepath.Join(dir, "Main.vm"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := Compile(dir, Options{Incremental: true})
+	errs, _ := err.(ErrorList)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "Main.vm") {
+		t.Fatalf("Errors for an unwritable Main.vm were incorrect, got: %v, wanted: an error creating Main.vm", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Util.vm")); err != nil {
+		t.Errorf("Util.vm was not written: %v", err)
+	}
+	m := loadManifest(dir)
+	if _, ok := m.Files["Util.jack"]; !ok || len(m.Files) != 1 {
+		t.Errorf("Manifest entries were incorrect, got: %v, wanted: Util.jack", m.Files)
+	}
+}
+
+func TestDebugCompile(t *testing.T) {
+	dir := t.TempDir()
+	writeClasses(t, dir, map[string]string{"Main": `class Main {
+    method int f(int a) {
+        var int x;
+        let x = a + 1;
+        if (x) {
+            return x;
+        }
+        return 0;
+    }
+}`})
+	if err := Compile(dir, Options{Debug: true}); err != nil {
+		t.Fatal(err)
+	}
+	vm, err := ioutil.ReadFile(filepath.Join(dir, "Main.vm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// Main.jack:2: method int f(int a) {
+function Main.f 1
+push argument 0
+pop pointer 0
+push constant 0
+pop local 0
+// Main.jack:4: let x = a + 1;
+push argument 1
+push constant 1
+add
+pop local 0
+// Main.jack:5: if (x) {
+push local 0
+not
+if-goto else1
+// Main.jack:6: return x;
+push local 0
+return
+goto end1
+label else1
+label end1
+// Main.jack:8: return 0;
+push constant 0
+return
+`
+	if string(vm) != want {
+		t.Errorf("VM code was incorrect, got:\n%s\nwanted:\n%s", vm, want)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "Main.vm.map"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m cache.DebugMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, l := range m.Lines {
+		lines = append(lines, fmt.Sprintf("%d:%d", l.VMLine, l.Line))
+	}
+	wantLines := "2:2 3:2 4:2 5:2 6:2 8:4 9:4 10:4 11:4 13:5 14:5 15:5 17:6 18:6 19:6 20:6 21:6 23:8 24:8"
+	if got := strings.Join(lines, " "); got != wantLines {
+		t.Errorf("Line map was incorrect, got: %s, wanted: %s", got, wantLines)
+	}
+	if m.Source != "Main.jack" || m.Lines[0].Subroutine != "Main.f" {
+		t.Errorf("Source and subroutine were incorrect, got: %s %s", m.Source, m.Lines[0].Subroutine)
+	}
+	slots := fmt.Sprint(m.Functions)
+	if want := "[{Main.f [this a] [x]}]"; slots != want {
+		t.Errorf("Slots were incorrect, got: %s, wanted: %s", slots, want)
+	}
+
+	// the comments and the map name the source file when it differs from the class
+	dir = t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "Square.Jack"), []byte("class Square {\n    function void f() {\n        return;\n    }\n}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Compile(dir, Options{Debug: true}); err != nil {
+		t.Fatal(err)
+	}
+	vm, err = ioutil.ReadFile(filepath.Join(dir, "Square.vm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(vm), "// Square.Jack:2: ") {
+		t.Errorf("Source comment of Square.Jack was incorrect, got:\n%s", vm)
+	}
+	data, err = ioutil.ReadFile(filepath.Join(dir, "Square.vm.map"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Source != "Square.Jack" {
+		t.Errorf("Source of Square.Jack was incorrect, got: %s, wanted: %s", m.Source, "Square.Jack")
+	}
+}
+
+func TestSymbolsCompile(t *testing.T) {
+	dir := t.TempDir()
+	writeClasses(t, dir, map[string]string{"Point": `class Point {
+    field int x, y;
+    static Point origin;
+    method int distance(Point other, boolean squared) {
+        var int dx, dy;
+        var Array cache;
+        return 0;
+    }
+    function void reset() {
+        return;
+    }
+}`})
+	if err := Compile(dir, Options{Symbols: true}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "Point.symbols.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type symbol struct {
+		Name    string `json:"name"`
+		Type    string `json:"type"`
+		Kind    string `json:"kind"`
+		Segment string `json:"segment"`
+		Index   int    `json:"index"`
+	}
+	var dump struct {
+		Class       string   `json:"class"`
+		Symbols     []symbol `json:"symbols"`
+		Subroutines []struct {
+			Name    string   `json:"name"`
+			Kind    string   `json:"kind"`
+			Symbols []symbol `json:"symbols"`
+		} `json:"subroutines"`
+	}
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatal(err)
+	}
+	format := func(symbols []symbol) string {
+		var s []string
+		for _, symbol := range symbols {
+			s = append(s, fmt.Sprintf("%s %s %s %s %d", symbol.Kind, symbol.Type, symbol.Name, symbol.Segment, symbol.Index))
+		}
+		return strings.Join(s, ", ")
+	}
+	if dump.Class != "Point" {
+		t.Errorf("Class was incorrect, got: %s, wanted: %s", dump.Class, "Point")
+	}
+	if got, want := format(dump.Symbols), "static Point origin static 0, field int x this 0, field int y this 1"; got != want {
+		t.Errorf("Class symbols were incorrect, got: %s, wanted: %s", got, want)
+	}
+	subroutines := []struct {
+		name    string
+		kind    string
+		symbols string
+	}{
+		{"distance", "method", "var int dx local 0, var int dy local 1, var Array cache local 2, arg Point this argument 0, arg Point other argument 1, arg boolean squared argument 2"},
+		{"reset", "function", ""},
+	}
+	if len(dump.Subroutines) != len(subroutines) {
+		t.Fatalf("Subroutines were incorrect, got: %d, wanted: %d", len(dump.Subroutines), len(subroutines))
+	}
+	for i, want := range subroutines {
+		got := dump.Subroutines[i]
+		if got.Name != want.name || got.Kind != want.kind {
+			t.Errorf("Subroutine %d was incorrect, got: %s %s, wanted: %s %s", i, got.Kind, got.Name, want.kind, want.name)
+		}
+		if symbols := format(got.Symbols); symbols != want.symbols {
+			t.Errorf("Symbols of %s were incorrect, got: %s, wanted: %s", want.name, symbols, want.symbols)
+		}
+	}
+}
+
+// goldenPrograms lists the folders of the Jack programs of the course, relative to projects.
+func goldenPrograms(t *testing.T) []string {
+	programs := []string{"12", "Snake"}
+	for _, pattern := range []string{"10/*", "11/*", "12/*"} {
+		dirs, err := filepath.Glob(filepath.Join("..", pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, dir := range dirs {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				programs = append(programs, filepath.ToSlash(dir[len("../"):]))
+			}
+		}
+	}
+	return programs
+}
+
+// TestGolden compiles the programs of the course and compares their VM code with the golden
+// files in testdata, go test -run TestGolden -update rewrites them after an intended change.
+func TestGolden(t *testing.T) {
+	variants := []struct {
+		dir     string
+		options Options
+	}{
+		{"vm", Options{}},
+		{"vm-optimized", Options{Optimize: true}},
+	}
+	for _, program := range goldenPrograms(t) {
+		for _, variant := range variants {
+			dir := t.TempDir()
+			paths, err := filepath.Glob(filepath.Join("..", program, "*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, path := range paths {
+				if !isJackFile(path) {
+					continue
+				}
+				source, err := ioutil.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(filepath.Join(dir, filepath.Base(path)), source, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := Compile(dir, variant.options); err != nil {
+				t.Errorf("Unexpected error for %s: %v", program, err)
+				continue
+			}
+			golden := filepath.Join("testdata", variant.dir, filepath.FromSlash(program))
+			if *update {
+				os.RemoveAll(golden)
+				if err := os.MkdirAll(golden, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			compareGolden(t, dir, golden)
+		}
+	}
+}
+
+// compareGolden compares the .vm files of dir with the ones of golden, or copies them there with
+// -update.
+func compareGolden(t *testing.T, dir string, golden string) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.vm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goldenFiles, err := filepath.Glob(filepath.Join(golden, "*.vm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled := make(map[string]bool)
+	for _, file := range files {
+		name := filepath.Base(file)
+		compiled[name] = true
+		got, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		goldenPath := filepath.Join(golden, name)
+		if *update {
+			if err := ioutil.WriteFile(goldenPath, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(goldenPath)
+		if err != nil {
+			t.Errorf("%s has no golden file, run go test -run TestGolden -update", goldenPath)
+			continue
+		}
+		gotLines, wantLines := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+		for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+			var gotLine, wantLine string
+			if i < len(gotLines) {
+				gotLine = gotLines[i]
+			}
+			if i < len(wantLines) {
+				wantLine = wantLines[i]
+			}
+			if gotLine != wantLine {
+				t.Errorf("Line %d of %s was incorrect, got: %s, wanted: %s", i+1, goldenPath, gotLine, wantLine)
+				break
+			}
+		}
+	}
+	for _, goldenPath := range goldenFiles {
+		if !compiled[filepath.Base(goldenPath)] {
+			t.Errorf("%s was not compiled", goldenPath)
+		}
+	}
+}
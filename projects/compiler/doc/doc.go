@@ -0,0 +1,71 @@
+package doc
+
+import (
+	"strings"
+
+	"example.com/ast"
+)
+
+// Class is the documentation of a class: its doc comment and the public declarations, each
+// group in source order. Fields and statics are private to a class and are left out.
+type Class struct {
+	Name         string
+	Doc          string
+	Constants    []Decl
+	Constructors []Decl
+	Methods      []Decl
+	Functions    []Decl
+}
+
+// Decl is a documented declaration, Decl is its source without a body.
+type Decl struct {
+	Name string
+	Decl string
+	Doc  string
+}
+
+func New(class *ast.Class) *Class {
+	c := &Class{Name: class.Name.Name, Doc: class.Doc}
+	for _, dec := range class.Constants {
+		c.Constants = append(c.Constants, Decl{dec.Name.Name, "const " + dec.Type + " " + dec.Name.Name, dec.Doc})
+	}
+	for _, sub := range class.Subroutines {
+		decl := Decl{sub.Name.Name, sub.Signature(), sub.Doc}
+		switch sub.Kind {
+		case "constructor":
+			c.Constructors = append(c.Constructors, decl)
+		case "method":
+			c.Methods = append(c.Methods, decl)
+		default:
+			c.Functions = append(c.Functions, decl)
+		}
+	}
+	return c
+}
+
+// Synopsis returns the first sentence of the class documentation, as go doc lists packages.
+func (c *Class) Synopsis() string {
+	return synopsis(c.Doc)
+}
+
+func synopsis(doc string) string {
+	if i := strings.Index(doc, "\n\n"); i >= 0 {
+		doc = doc[:i]
+	}
+	doc = strings.Join(strings.Fields(doc), " ")
+	if i := strings.Index(doc, ". "); i >= 0 {
+		doc = doc[:i+1]
+	}
+	return doc
+}
+
+// paragraphs splits a doc comment at its blank lines.
+func paragraphs(doc string) []string {
+	var result []string
+	for _, paragraph := range strings.Split(doc, "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			result = append(result, paragraph)
+		}
+	}
+	return result
+}
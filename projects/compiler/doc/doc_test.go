@@ -0,0 +1,83 @@
+package doc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"example.com/ast"
+)
+
+const source = `/**
+ * A point on the screen.
+ * Points are immutable.
+ *
+ * Use <new> to make one.
+ */
+class Point {
+    field int x;
+
+    /** Makes a point at x. */
+    constructor Point new(int ax) {
+        let x = ax;
+        return this;
+    }
+
+    /** Returns the x coordinate. */
+    method int getX() {
+        return x;
+    }
+
+    function int origin() {
+        return 0;
+    }
+}`
+
+func TestWrite(t *testing.T) {
+	class, err := ast.ParseClass(strings.NewReader(source), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formats := []struct {
+		format Format
+		want   string
+	}{
+		{
+			Markdown,
+			"# Jack API reference\n\n" +
+				"- [Point](#class-point): A point on the screen.\n\n" +
+				"# class Point\n\n" +
+				"A point on the screen.\nPoints are immutable.\n\n" +
+				"Use <new> to make one.\n\n" +
+				"## Constructors\n\n" +
+				"### new\n\n```jack\nconstructor Point new(int ax)\n```\n\nMakes a point at x.\n\n" +
+				"## Methods\n\n" +
+				"### getX\n\n```jack\nmethod int getX()\n```\n\nReturns the x coordinate.\n\n" +
+				"## Functions\n\n" +
+				"### origin\n\n```jack\nfunction int origin()\n```\n",
+		},
+		{
+			HTML,
+			"<h1>Jack API reference</h1>\n<ul>\n" +
+				"<li><a href=\"#class-point\">Point</a>: A point on the screen.</li>\n</ul>\n\n" +
+				"<h1 id=\"class-point\">class Point</h1>\n" +
+				"<p>A point on the screen.\nPoints are immutable.</p>\n" +
+				"<p>Use &lt;new&gt; to make one.</p>\n" +
+				"<h2>Constructors</h2>\n" +
+				"<h3>new</h3>\n<pre><code>constructor Point new(int ax)</code></pre>\n<p>Makes a point at x.</p>\n" +
+				"<h2>Methods</h2>\n" +
+				"<h3>getX</h3>\n<pre><code>method int getX()</code></pre>\n<p>Returns the x coordinate.</p>\n" +
+				"<h2>Functions</h2>\n" +
+				"<h3>origin</h3>\n<pre><code>function int origin()</code></pre>\n",
+		},
+	}
+	for _, f := range formats {
+		var buf bytes.Buffer
+		if err := Write(&buf, []*Class{New(class)}, f.format); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != f.want {
+			t.Errorf("Reference was incorrect, got:\n%s\nwanted:\n%s", got, f.want)
+		}
+	}
+}
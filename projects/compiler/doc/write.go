@@ -0,0 +1,153 @@
+package doc
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Format is the markup of the generated reference.
+type Format int
+
+const (
+	Markdown Format = iota
+	HTML
+)
+
+// Ext returns the file extension of a page in the format.
+func (f Format) Ext() string {
+	if f == HTML {
+		return ".html"
+	}
+	return ".md"
+}
+
+// reference is what the templates render: the index of the classes and the pages of the
+// classes, on one page or with pages linked by file name.
+type reference struct {
+	Classes []*Class
+	// Pages is set when every class has its own page
+	Pages bool
+	Ext   string
+}
+
+func (r reference) Link(name string) string {
+	if r.Pages {
+		return name + r.Ext
+	}
+	return "#class-" + strings.ToLower(name)
+}
+
+const markdownIndex = `# Jack API reference
+{{range .Classes}}
+- [{{.Name}}]({{$.Link .Name}}){{with .Synopsis}}: {{.}}{{end}}{{end}}
+`
+
+const markdownClass = `# class {{.Name}}
+{{range paragraphs .Doc}}
+{{.}}
+{{end}}{{template "group" group "Constants" .Constants}}{{template "group" group "Constructors" .Constructors}}{{template "group" group "Methods" .Methods}}{{template "group" group "Functions" .Functions}}
+{{- define "group"}}{{if .Decls}}
+## {{.Title}}
+{{range .Decls}}
+### {{.Name}}
+
+` + "```jack" + `
+{{.Decl}}
+` + "```" + `
+{{range paragraphs .Doc}}
+{{.}}
+{{end}}{{end}}{{end}}{{end}}`
+
+const htmlIndex = `<h1>Jack API reference</h1>
+<ul>
+{{range .Classes}}<li><a href="{{$.Link .Name}}">{{.Name}}</a>{{with .Synopsis}}: {{.}}{{end}}</li>
+{{end}}</ul>
+`
+
+const htmlClass = `<h1 id="class-{{lower .Name}}">class {{.Name}}</h1>
+{{range paragraphs .Doc}}<p>{{.}}</p>
+{{end}}{{template "group" group "Constants" .Constants}}{{template "group" group "Constructors" .Constructors}}{{template "group" group "Methods" .Methods}}{{template "group" group "Functions" .Functions}}
+{{- define "group"}}{{if .Decls}}<h2>{{.Title}}</h2>
+{{range .Decls}}<h3>{{.Name}}</h3>
+<pre><code>{{.Decl}}</code></pre>
+{{range paragraphs .Doc}}<p>{{.}}</p>
+{{end}}{{end}}{{end}}{{end}}`
+
+type group struct {
+	Title string
+	Decls []Decl
+}
+
+func newGroup(title string, decls []Decl) group {
+	return group{title, decls}
+}
+
+type templates struct {
+	index func(w io.Writer, r reference) error
+	class func(w io.Writer, c *Class) error
+}
+
+func newTemplates(format Format) templates {
+	if format == HTML {
+		funcs := htmltemplate.FuncMap{"paragraphs": paragraphs, "group": newGroup, "lower": strings.ToLower}
+		index := htmltemplate.Must(htmltemplate.New("index").Parse(htmlIndex))
+		class := htmltemplate.Must(htmltemplate.New("class").Funcs(funcs).Parse(htmlClass))
+		return templates{
+			func(w io.Writer, r reference) error { return index.Execute(w, r) },
+			func(w io.Writer, c *Class) error { return class.Execute(w, c) },
+		}
+	}
+	textFuncs := template.FuncMap{"paragraphs": paragraphs, "group": newGroup}
+	index := template.Must(template.New("index").Parse(markdownIndex))
+	class := template.Must(template.New("class").Funcs(textFuncs).Parse(markdownClass))
+	return templates{
+		func(w io.Writer, r reference) error { return index.Execute(w, r) },
+		func(w io.Writer, c *Class) error { return class.Execute(w, c) },
+	}
+}
+
+// Write writes the reference of the classes as one document: an index linking to the sections
+// of the classes.
+func Write(w io.Writer, classes []*Class, format Format) error {
+	t := newTemplates(format)
+	if err := t.index(w, reference{classes, false, format.Ext()}); err != nil {
+		return err
+	}
+	for _, class := range classes {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+		if err := t.class(w, class); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WritePages writes the reference of the classes into dir, a page per class named after it and
+// an index page linking to them.
+func WritePages(dir string, classes []*Class, format Format) error {
+	t := newTemplates(format)
+	var buf bytes.Buffer
+	if err := t.index(&buf, reference{classes, true, format.Ext()}); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "index"+format.Ext()), buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	for _, class := range classes {
+		buf.Reset()
+		if err := t.class(&buf, class); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, class.Name+format.Ext()), buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,9 +2,13 @@ package engine
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"runtime"
 	"strconv"
+	"strings"
 
 	"example.com/cache"
 	"example.com/tokenizer"
@@ -12,58 +16,216 @@ import (
 )
 
 type count struct {
-	ifIdx     int
-	whileIdx  int
-	className string
+	ifIdx          int
+	whileIdx       int
+	className      string
+	subroutineName string
+	subroutineKind cache.SubroutineKind
+	returnType     string
+	loops          []loop
+	// folding is set while compiling a constant expression
+	folding bool
+}
+
+// loop holds the labels that break and continue jump to inside a loop.
+type loop struct {
+	breakLabel    string
+	continueLabel string
+}
+
+// Options configures a compilationEngine. The zero value compiles a class on its own, without
+// any whole-program checks.
+type Options struct {
+	// Classes indexes every class in the program, it is used to check calls into other classes.
+	Classes *cache.ClassIndex
+	// Strict enables type checking of assignments, arguments and return values. Mismatches are
+	// reported as warnings.
+	Strict bool
+	// Precedence replaces Jack's left to right evaluation with the usual operator precedence.
+	Precedence bool
+	// Extended accepts extended-Jack: for loops, break, continue, else if, switch, the
+	// short-circuit && and || operators, character constants, escape sequences in strings and
+	// class constants. The output is standard VM code.
+	Extended bool
+	// Optimize folds constant subexpressions at compile time and replaces operations with a
+	// constant operand by cheaper code that is no larger than the generic one.
+	Optimize bool
+	// Debug writes the source line of each subroutine declaration and statement as a comment
+	// before its code, as in // Main.jack:23: let x = x + 1;. See cache.NewDebugMap.
+	Debug bool
+	// Source is the name of the source file in the Debug comments, the class name followed by
+	// .jack when empty.
+	Source string
+}
+
+func (o Options) mode() tokenizer.Mode {
+	if o.Extended {
+		return tokenizer.Extended
+	}
+	return 0
 }
 
 type compilationEngine struct {
 	scanner     *tokenizer.Scanner
+	token       tokenizer.Token
 	output      *writer.VMWriter
 	symbolTable *cache.SymbolTable
 	count       *count
+	options     Options
+	errors      []error
+	warnings    []error
+	symbols     cache.ClassSymbols
+	constants   map[string]operand
+	resolver    *constantResolver
+	// lines holds the source lines in Debug mode
+	lines []string
 }
 
-func NewCompilationEngine(reader io.Reader, w *bufio.Writer) *compilationEngine {
+func NewCompilationEngine(reader io.Reader, w *bufio.Writer, options Options) *compilationEngine {
+	var lines []string
+	if options.Debug {
+		src, err := ioutil.ReadAll(reader)
+		// a read error is reported by the scanner
+		reader = io.MultiReader(bytes.NewReader(src), errorReader{err})
+		lines = strings.Split(string(src), "\n")
+	}
 	return &compilationEngine{
-		tokenizer.NewScanner(reader),
+		tokenizer.NewModeScanner(reader, options.mode()),
+		tokenizer.Token{},
 		writer.NewVMWriter(w),
 		cache.NewSymbolTable(),
-		&count{0, 0, ""},
+		&count{0, 0, "", "", cache.Function, "", nil, false},
+		options,
+		nil,
+		nil,
+		cache.ClassSymbols{},
+		make(map[string]operand),
+		nil,
+		lines,
+	}
+}
+
+// errorReader returns err once the source before it is read.
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
 	}
+	return 0, io.EOF
+}
+
+// writeSourceLine writes the source line of the current token as a comment in Debug mode, the
+// code that follows is compiled from that line.
+func (c *compilationEngine) writeSourceLine() {
+	if c.lines == nil {
+		return
+	}
+	line := c.token.Pos.Line
+	text := ""
+	if line >= 1 && line <= len(c.lines) {
+		text = strings.TrimSpace(c.lines[line-1])
+	}
+	source := c.options.Source
+	if source == "" {
+		source = c.count.className + ".jack"
+	}
+	c.output.WriteString(fmt.Sprintf("// %s:%d: %s\n", source, line, text))
+}
+
+// Errors returns the errors found while compiling the class. A grammar or lexical error stops
+// compilation so it is always the last error.
+func (c *compilationEngine) Errors() []error {
+	return c.errors
+}
+
+// Symbols returns the symbol table of every scope of the compiled class.
+func (c *compilationEngine) Symbols() cache.ClassSymbols {
+	return c.symbols
+}
+
+func (c *compilationEngine) reportf(format string, a ...interface{}) {
+	context := fmt.Sprintf("%s: %s.%s: ", c.token.Pos, c.count.className, c.count.subroutineName)
+	c.errors = append(c.errors, fmt.Errorf(context+format, a...))
+}
+
+// checkCall validates a call to className.subroutineName against the class index and returns
+// the return type of the subroutine, or "" if it is not known. viaObject is true when an object
+// is passed as the hidden first argument, argTypes excludes that object.
+func (c *compilationEngine) checkCall(className string, subroutineName string, argTypes []string, viaObject bool) string {
+	if c.options.Classes == nil {
+		return ""
+	}
+	sub, classFound, subFound := c.options.Classes.Subroutine(className, subroutineName)
+	if !classFound {
+		c.reportf("unknown class %s", className)
+		return ""
+	}
+	if !subFound {
+		c.reportf("unknown subroutine %s.%s", className, subroutineName)
+		return ""
+	}
+	if viaObject && sub.Kind != cache.Method {
+		c.reportf("%s %s.%s cannot be called on an object", sub.Kind, className, subroutineName)
+	} else if !viaObject && sub.Kind == cache.Method {
+		c.reportf("method %s.%s cannot be called without an object", className, subroutineName)
+	}
+	if len(sub.Params) != len(argTypes) {
+		c.reportf("%s.%s expects %d arguments, got %d", className, subroutineName, len(sub.Params), len(argTypes))
+		return sub.ReturnType
+	}
+	for i, param := range sub.Params {
+		c.checkAssignable(param.Type, argTypes[i], fmt.Sprintf("argument %s of %s.%s", param.Name, className, subroutineName))
+	}
+	return sub.ReturnType
+}
+
+// isLocalFunction reports whether an unqualified call refers to a function or constructor of
+// the current class, which take no hidden object argument.
+func (c *compilationEngine) isLocalFunction(subroutineName string) bool {
+	if c.options.Classes == nil {
+		return false
+	}
+	sub, _, found := c.options.Classes.Subroutine(c.count.className, subroutineName)
+	return found && sub.Kind != cache.Method
 }
 
 func (c *compilationEngine) advance() {
-	c.scanner.Advance()
+	c.token = c.scanner.Next()
+	if err := c.scanner.Err(); err != nil {
+		panic(err)
+	}
 }
 
 func (c *compilationEngine) tokenValue() string {
-	return c.scanner.Token.Value
+	return c.token.Value
 }
 
 func (c *compilationEngine) tokenCategory() tokenizer.Category {
-	return c.scanner.Token.Category
+	return c.token.Category
 }
 
 func (c *compilationEngine) tokenIsType() bool {
-	return c.scanner.Token.IsType()
+	return c.token.IsType()
 }
 
 func (c *compilationEngine) tokenIsOp() bool {
-	return c.scanner.Token.IsOp()
+	return c.token.IsOp()
 }
 
 func (c *compilationEngine) tokenIsUnaryOp() bool {
-	return c.scanner.Token.IsUnaryOp()
+	return c.token.IsUnaryOp()
 }
 
 func (c *compilationEngine) writeToken() {
-	c.output.WriteString(fmt.Sprintf("<%s>%s</%s>\n", c.tokenCategory(), c.tokenValue(), c.tokenCategory()))
+	c.output.WriteString(fmt.Sprintf("<%s>%s</%s>\n", c.tokenCategory(), c.token.Escaped(), c.tokenCategory()))
 }
 
 func (c *compilationEngine) compileIdentifier(defining bool, kind string, symbolType string) {
 	if c.tokenCategory() != tokenizer.Identifier {
-		panic(fmt.Sprintf("expected an identifer term, got %s", c.tokenValue()))
+		panic(fmt.Errorf(`expected an identifier, got "%s"`, c.tokenValue()))
 	}
 	c.writeIdentifier(c.tokenValue(), defining, kind, symbolType)
 	c.advance()
@@ -81,8 +243,7 @@ func (c *compilationEngine) writeIdentifier(name string, defining bool, kindName
 	kind := cache.ParseKind(kindName)
 
 	if kind != cache.None && defining {
-		c.symbolTable.Define(name, symbolType, kind)
-		index := c.symbolTable.IndexOf(name)
+		index := c.symbolTable.Define(name, symbolType, kind).Index
 		// c.output.WriteString(fmt.Sprintf("<%s%s%d>%s</%s%s%d>\n", status, kind, index, name, status, kind, index))
 		switch kind {
 		case cache.Var:
@@ -92,11 +253,11 @@ func (c *compilationEngine) writeIdentifier(name string, defining bool, kindName
 		return
 	}
 
-	symbolKind := c.symbolTable.KindOf(name)
-	if symbolKind != cache.None && kindName != "subroutine" && kindName != "class" {
-		index := c.symbolTable.IndexOf(name)
-		// c.output.WriteString(fmt.Sprintf("<%s%s%d>%s</%s%s%d>\n", status, symbolKind, index, name, status, symbolKind, index))
-		switch symbolKind {
+	symbol, found := c.symbolTable.Lookup(name)
+	if found && kindName != "subroutine" && kindName != "class" {
+		index := symbol.Index
+		// c.output.WriteString(fmt.Sprintf("<%s%s%d>%s</%s%s%d>\n", status, symbol.Kind, index, name, status, symbol.Kind, index))
+		switch symbol.Kind {
 		case cache.Var:
 			c.output.WritePush(writer.Local, strconv.Itoa(index))
 		}
@@ -124,17 +285,47 @@ func (c *compilationEngine) compileTokenValue(tokenValue string) {
 	}
 }
 
-func (c *compilationEngine) compileExpression() {
+// compileExpression writes the expression and returns its type, "" when it cannot be inferred.
+func (c *compilationEngine) compileExpression() string {
 	// c.writeString("<expression>\n")
-	operationStore := make([]string, 0)
-	c.compileTerm()
-	operationStore = c.handleMultipleTerms(operationStore)
-	for i := len(operationStore) - 1; i >= 0; i-- {
-		operation := operationStore[i]
-		// need to convert the operation from the symbol to appropriate vm command
-		c.writeOperation(operation)
-	}
+	exprType := c.writeOperand(c.compileExpressionOperand())
 	// c.writeString("</expression>\n")
+	return exprType
+}
+
+// compileExpressionOperand compiles an expression, the code of a constant result is not written.
+func (c *compilationEngine) compileExpressionOperand() operand {
+	return c.handleMultipleTerms(c.compileTerm(), 0)
+}
+
+// precedence returns how tightly op binds. The Jack spec gives every operator the same
+// precedence and evaluates strictly left to right, conventional precedence is opt-in. The
+// extended-Jack && and || are not part of the spec and always bind loosest, so a guard like
+// i < n && a[i] = 0 tests both comparisons.
+func (c *compilationEngine) precedence(op string) int {
+	switch op {
+	case "||":
+		return 1
+	case "&&":
+		return 2
+	}
+	if !c.options.Precedence {
+		return 3
+	}
+	switch op {
+	case "|":
+		return 3
+	case "&":
+		return 4
+	case "=":
+		return 5
+	case "<", ">":
+		return 6
+	case "+", "-":
+		return 7
+	default:
+		return 8
+	}
 }
 
 func (c *compilationEngine) writeOperation(operation string) {
@@ -147,36 +338,77 @@ func (c *compilationEngine) writeOperation(operation string) {
 		c.output.WriteCall("Math.multiply", 2)
 	case "/":
 		c.output.WriteCall("Math.divide", 2)
-	case "&amp;":
+	case "&":
 		c.output.WriteArithmetic(writer.And)
 	case "|":
 		c.output.WriteArithmetic(writer.Or)
-	case "&lt;":
+	case "<":
 		c.output.WriteArithmetic(writer.Lt)
-	case "&gt;":
+	case ">":
 		c.output.WriteArithmetic(writer.Gt)
 	case "=":
 		c.output.WriteArithmetic(writer.Eq)
 	}
 }
 
-func (c *compilationEngine) handleMultipleExpressions(nArgs int) int {
+// writeShortCircuit writes the jump taken on the left operand of && or ||, the right operand is
+// only evaluated when the left one does not decide the result:
+//
+//	if-goto andN            if-goto orN
+//	push constant 0         <right operand>
+//	goto andEndN            goto orEndN
+//	label andN              label orN
+//	<right operand>         push constant 0, not
+//	label andEndN           label orEndN
+//
+// The right operand is turned into canonical true or false. It returns the label index which
+// endShortCircuit takes once the right operand is compiled.
+func (c *compilationEngine) writeShortCircuit(op string) string {
+	c.count.ifIdx++
+	ifIdxStr := strconv.Itoa(c.count.ifIdx)
+	if op == "&&" {
+		c.output.WriteIf("and" + ifIdxStr)
+		c.output.WritePush(writer.Const, "0")
+		c.output.WriteGoto("andEnd" + ifIdxStr)
+		c.output.WriteLabel("and" + ifIdxStr)
+	} else {
+		c.output.WriteIf("or" + ifIdxStr)
+	}
+	return ifIdxStr
+}
+
+func (c *compilationEngine) endShortCircuit(op string, ifIdxStr string) {
+	c.output.WritePush(writer.Const, "0")
+	c.output.WriteArithmetic(writer.Eq)
+	c.output.WriteArithmetic(writer.Not)
+	if op == "&&" {
+		c.output.WriteLabel("andEnd" + ifIdxStr)
+		return
+	}
+	c.output.WriteGoto("orEnd" + ifIdxStr)
+	c.output.WriteLabel("or" + ifIdxStr)
+	c.output.WritePush(writer.Const, "0")
+	c.output.WriteArithmetic(writer.Not)
+	c.output.WriteLabel("orEnd" + ifIdxStr)
+}
+
+func (c *compilationEngine) handleMultipleExpressions(argTypes []string) []string {
 	if c.tokenValue() != "," {
-		return nArgs
+		return argTypes
 	}
 	// c.writeTokenAndAdvance()
 	c.advance()
-	c.compileExpression()
-	nArgs++
-	nArgs = c.handleMultipleExpressions(nArgs)
-	return nArgs
+	argTypes = append(argTypes, c.compileExpression())
+	argTypes = c.handleMultipleExpressions(argTypes)
+	return argTypes
 }
 
-func (c *compilationEngine) compileFunctionCall() int {
+// compileFunctionCall compiles the argument list and returns the type of each argument.
+func (c *compilationEngine) compileFunctionCall() []string {
 	// if c.tokenValue() != "(" {
 	// 	return 0
 	// }
-	nArgs := 0
+	argTypes := make([]string, 0)
 	// c.compileTokenValue("(")
 	c.advance()
 	// c.writeString("<expressionList>\n")
@@ -185,33 +417,33 @@ func (c *compilationEngine) compileFunctionCall() int {
 		// c.writeString("</expressionList>\n")
 		// c.compileTokenValue(")")
 		c.advance()
-		return nArgs
+		return argTypes
 	}
-	nArgs++
-	c.compileExpression()
-	nArgs = c.handleMultipleExpressions(nArgs)
+	argTypes = append(argTypes, c.compileExpression())
+	argTypes = c.handleMultipleExpressions(argTypes)
 	// c.writeString("</expressionList>\n")
 	// c.compileTokenValue(")")
 	c.advance()
-	return nArgs
+	return argTypes
 }
 
-func (c *compilationEngine) compileMethodCall(kind cache.Kind, idx int) int {
-	nArgs := 1
+// compileMethodCall pushes the object then compiles the argument list, the returned types do
+// not include the object.
+func (c *compilationEngine) compileMethodCall(kind cache.Kind, idx int) []string {
 	c.advance() //(
 	seg := convertKindToSegment(kind)
 	c.output.WritePush(seg, strconv.Itoa(idx))
+	argTypes := make([]string, 0)
 	if c.tokenValue() == ")" {
 		// c.writeString("</expressionList>\n")
 		// c.compileTokenValue(")")
 		c.advance()
-		return nArgs
+		return argTypes
 	}
-	nArgs++
-	c.compileExpression()
-	nArgs = c.handleMultipleExpressions(nArgs)
+	argTypes = append(argTypes, c.compileExpression())
+	argTypes = c.handleMultipleExpressions(argTypes)
 	c.advance()
-	return nArgs
+	return argTypes
 }
 
 func (c *compilationEngine) handleArrayIndex() {
@@ -223,7 +455,7 @@ func (c *compilationEngine) handleArrayIndex() {
 	c.compileTokenValue("]")
 }
 
-func (c *compilationEngine) handleIdentifierTerm() {
+func (c *compilationEngine) handleIdentifierTerm() operand {
 	// this identifier could be a class, subroutine, var, arg, static, field
 	// can check if var, arg, static, field using symbol table
 	// if none of above dependant on next token:
@@ -235,12 +467,24 @@ func (c *compilationEngine) handleIdentifierTerm() {
 	case "(":
 		// THIS IS A METHOD OF THE CURRENT OBJ
 		// c.writeIdentifier(identifierName, false, "subroutine", "")
-		objName := c.symbolTable.TypeOf("this")
-		if objName == "" {
-			objName = c.count.className
+		objName := c.count.className
+		if this, ok := c.symbolTable.Lookup("this"); ok {
+			objName = this.Type
+		}
+		if c.isLocalFunction(identifierName) {
+			argTypes := c.compileFunctionCall()
+			returnType := c.checkCall(objName, identifierName, argTypes, false)
+			c.output.WriteCall(fmt.Sprintf("%s.%s", objName, identifierName), len(argTypes))
+			return operand{typ: returnType}
+		}
+		// without the class index every unqualified call looks like a method call
+		if c.options.Classes != nil && c.count.subroutineKind == cache.Function {
+			c.reportf("method %s cannot be called from a function", identifierName)
 		}
-		nArgs := c.compileMethodCall(cache.None, 0)
-		c.output.WriteCall(fmt.Sprintf("%s.%s", objName, identifierName), nArgs)
+		argTypes := c.compileMethodCall(cache.None, 0)
+		returnType := c.checkCall(objName, identifierName, argTypes, true)
+		c.output.WriteCall(fmt.Sprintf("%s.%s", objName, identifierName), len(argTypes)+1)
+		return operand{typ: returnType}
 	case ".":
 		// if kind := c.symbolTable.KindOf(identifierName); kind != cache.None {
 		// 	c.writeIdentifier(identifierName, false, kind.String(), "")
@@ -249,36 +493,58 @@ func (c *compilationEngine) handleIdentifierTerm() {
 		// }
 		c.advance()
 		functionName := c.tokenValue()
-		var nArgs int
-		objType := c.symbolTable.TypeOf(identifierName)
+		obj, isObject := c.symbolTable.Lookup(identifierName)
+		objType := obj.Type
 		c.advance()
-		if objType == "" {
-			nArgs = c.compileFunctionCall()
-			c.output.WriteCall(fmt.Sprintf("%s.%s", identifierName, functionName), nArgs)
-		} else {
-			objKind := c.symbolTable.KindOf(identifierName)
-			objIdx := c.symbolTable.IndexOf(identifierName)
-			nArgs = c.compileMethodCall(objKind, objIdx)
-			c.output.WriteCall(fmt.Sprintf("%s.%s", objType, functionName), nArgs)
+		if !isObject && c.tokenValue() != "(" {
+			constant, ok := c.classConstant(identifierName, functionName)
+			if !ok {
+				c.reportf("unknown constant %s.%s", identifierName, functionName)
+				// carry on as if it were 0 rather than report the expression as not constant
+				constant.constant = true
+			}
+			return constant
+		}
+		if !isObject {
+			argTypes := c.compileFunctionCall()
+			returnType := c.checkCall(identifierName, functionName, argTypes, false)
+			c.output.WriteCall(fmt.Sprintf("%s.%s", identifierName, functionName), len(argTypes))
+			return operand{typ: returnType}
+		}
+		if isPrimitiveType(objType) && c.options.Strict {
+			c.warnf("cannot call method %s on %s of type %s", functionName, identifierName, objType)
 		}
+		argTypes := c.compileMethodCall(obj.Kind, obj.Index)
+		var returnType string
+		if !isPrimitiveType(objType) {
+			returnType = c.checkCall(objType, functionName, argTypes, true)
+		}
+		c.output.WriteCall(fmt.Sprintf("%s.%s", objType, functionName), len(argTypes)+1)
+		return operand{typ: returnType}
 		// functionName, nArgs := c.compileObjectUse()
 	case "[":
-		kind := c.symbolTable.KindOf(identifierName)
-		idx := c.symbolTable.IndexOf(identifierName)
-		seg := convertKindToSegment(kind)
-		c.output.WritePush(seg, strconv.Itoa(idx))
+		array := c.lookupVariable(identifierName)
+		seg := convertKindToSegment(array.Kind)
+		c.output.WritePush(seg, strconv.Itoa(array.Index))
 		c.advance() // advance to the index
 		c.compileExpression()
 		c.output.WriteArithmetic(writer.Add)
 		c.output.WritePop(writer.Pointer, 1)
 		c.output.WritePush(writer.That, strconv.Itoa(0))
 		c.advance()
+		// array elements are untyped
+		return operand{}
 	default:
+		if _, ok := c.symbolTable.Lookup(identifierName); !ok {
+			if constant, ok := c.classConstant(c.count.className, identifierName); ok {
+				return constant
+			}
+		}
 		// get the kind and index
-		kind := c.symbolTable.KindOf(identifierName)
-		index := c.symbolTable.IndexOf(identifierName)
-		segment := convertKindToSegment(kind)
-		c.output.WritePush(segment, strconv.Itoa(index))
+		variable := c.lookupVariable(identifierName)
+		segment := convertKindToSegment(variable.Kind)
+		c.output.WritePush(segment, strconv.Itoa(variable.Index))
+		return operand{typ: variable.Type}
 	}
 	/*
 		OLD CODE
@@ -306,52 +572,94 @@ func (c *compilationEngine) handleIdentifierTerm() {
 	// }
 }
 
-func (c *compilationEngine) handleExpressionBrackets() {
+func (c *compilationEngine) handleExpressionBrackets() string {
 	c.compileTokenValue("(")
-	c.compileExpression()
+	exprType := c.compileExpression()
 	c.compileTokenValue(")")
+	return exprType
 }
 
-func (c *compilationEngine) compileTerm() {
+// charCodes returns the Hack character codes of the current string or character constant.
+func (c *compilationEngine) charCodes() []int {
+	chars, err := tokenizer.CharCodes(c.tokenValue(), c.options.mode())
+	if err != nil {
+		c.reportf("%v", err)
+	}
+	return chars
+}
+
+// charCode returns the Hack character code of the current character constant.
+func (c *compilationEngine) charCode() int {
+	chars := c.charCodes()
+	if len(chars) != 1 {
+		if chars != nil || c.tokenValue() == "" {
+			c.reportf("character constant '%s' must hold exactly one character", c.tokenValue())
+		}
+		return 0
+	}
+	return chars[0]
+}
+
+// compileTerm compiles the term and returns it as an operand, whose type is "" when it cannot be
+// inferred. The code of a constant term is left to writeOperand so that it can be folded.
+func (c *compilationEngine) compileTerm() operand {
 	// c.writeString("<term>\n")
+	term := operand{}
 	if c.tokenCategory() == tokenizer.IntConst {
-		c.output.WritePush(writer.Const, c.tokenValue())
+		value, _ := strconv.Atoi(c.tokenValue())
+		term = operand{"int", true, int16(value)}
 		c.advance()
 	} else if c.tokenCategory() == tokenizer.StringConst {
 		// c.writeTokenAndAdvance()
-		str := c.tokenValue()
-		length := len(c.tokenValue())
-		c.output.WritePush(writer.Const, strconv.Itoa(length))
+		chars := c.charCodes()
+		c.output.WritePush(writer.Const, strconv.Itoa(len(chars)))
 		c.output.WriteCall("String.new", 1)
-		for _, char := range str {
-			c.output.WritePush(writer.Const, strconv.Itoa(int(char)))
+		for _, char := range chars {
+			c.output.WritePush(writer.Const, strconv.Itoa(char))
 			c.output.WriteCall("String.appendChar", 2)
 		}
 		c.advance()
+		term.typ = "String"
+	} else if c.tokenCategory() == tokenizer.CharConst {
+		term = operand{"char", true, int16(c.charCode())}
+		c.advance()
 	} else if c.tokenCategory() == tokenizer.Keyword {
 		if c.tokenValue() == "true" {
-			c.output.WritePush(writer.Const, strconv.Itoa(1))
-			c.output.WriteArithmetic(writer.Neg)
+			term = operand{"boolean", true, -1}
 		} else if c.tokenValue() == "false" {
-			c.output.WritePush(writer.Const, strconv.Itoa(0))
+			term = operand{"boolean", true, 0}
 		} else if c.tokenValue() == "this" {
 			c.output.WritePush(writer.Pointer, strconv.Itoa(0))
+			term.typ = c.count.className
 		} else if c.tokenValue() == "null" {
-			c.output.WritePush(writer.Const, strconv.Itoa(0))
+			term = operand{"null", true, 0}
 		}
 		c.advance()
 	} else if c.tokenCategory() == tokenizer.Identifier {
-		c.handleIdentifierTerm()
+		term = c.handleIdentifierTerm()
 	} else if c.tokenValue() == "(" {
-		c.handleExpressionBrackets()
+		c.advance()
+		term = c.compileExpressionOperand()
+		c.compileTokenValue(")")
 	} else if c.tokenIsUnaryOp() {
 		// c.writeTokenAndAdvance()
 		op := c.tokenValue()
 		c.advance()
-		c.compileTerm()
+		term = c.compileTerm()
+		if term.constant && c.folding() {
+			if op == "-" {
+				term = operand{"int", true, -term.value}
+			} else {
+				term.value = ^term.value
+			}
+			return term
+		}
+		c.writeOperand(term)
+		term.constant = false
 		switch op {
 		case "-":
 			c.output.WriteArithmetic(writer.Neg)
+			term.typ = "int"
 		case "~":
 			c.output.WriteArithmetic(writer.Not)
 		}
@@ -359,28 +667,104 @@ func (c *compilationEngine) compileTerm() {
 		panic(fmt.Errorf("invalid term grammar %s is not valid for a term", c.tokenValue()))
 	}
 	// c.writeString("</term>\n")
+	return term
 }
 
-func (c *compilationEngine) handleMultipleTerms(operationStore []string) []string {
-	if !c.tokenIsOp() {
-		return operationStore
+// handleMultipleTerms compiles the operators that follow an already written left operand,
+// as long as they bind at least as tightly as minPrecedence. Each operation is written as soon
+// as its right operand is complete, so equal precedence evaluates left to right.
+func (c *compilationEngine) handleMultipleTerms(left operand, minPrecedence int) operand {
+	if !c.tokenIsOp() || c.precedence(c.tokenValue()) < minPrecedence {
+		return left
 	}
-	operationStore = append(operationStore, c.tokenValue())
+	op := c.tokenValue()
 	// c.writeTokenAndAdvance()
 	c.advance()
-	c.compileTerm()
-	c.handleMultipleTerms(operationStore)
-	return operationStore
+	if op == "&&" || op == "||" {
+		c.writeOperand(left)
+		ifIdxStr := c.writeShortCircuit(op)
+		c.writeOperand(c.compileRightOperand(op))
+		c.endShortCircuit(op, ifIdxStr)
+		return c.handleMultipleTerms(operand{typ: "boolean"}, minPrecedence)
+	}
+	// hold back the code of the right operand while a constant left operand may still be folded
+	output := c.output
+	var buffer bytes.Buffer
+	if left.constant {
+		c.output = writer.NewVMWriter(bufio.NewWriter(&buffer))
+	}
+	right := c.compileRightOperand(op)
+	if left.constant {
+		c.output.Flush()
+		c.output = output
+	}
+	result := operand{typ: operationType(op, left.typ, right.typ)}
+	if left.constant && right.constant && c.folding() {
+		value, err := fold(op, left.value, right.value)
+		if err == nil || c.count.folding {
+			if err != nil {
+				c.reportf("%v", err)
+			}
+			result.constant, result.value = true, value
+			return c.handleMultipleTerms(result, minPrecedence)
+		}
+	}
+	if c.options.Optimize && left.constant != right.constant {
+		k := right.value
+		if left.constant {
+			k = left.value
+		}
+		if reducible(op, k, left.constant) {
+			c.output.WriteString(buffer.String())
+			c.writeReduced(op, k, left.constant)
+			return c.handleMultipleTerms(result, minPrecedence)
+		}
+	}
+	c.writeOperand(left)
+	c.output.WriteString(buffer.String())
+	c.writeOperand(right)
+	c.writeOperation(op)
+	return c.handleMultipleTerms(result, minPrecedence)
+}
+
+// compileRightOperand compiles the right operand of op together with the operations that bind
+// more tightly than op.
+func (c *compilationEngine) compileRightOperand(op string) operand {
+	right := c.compileTerm()
+	for c.tokenIsOp() && c.precedence(c.tokenValue()) > c.precedence(op) {
+		right = c.handleMultipleTerms(right, c.precedence(op)+1)
+	}
+	return right
 }
 
 func (c *compilationEngine) compileLet() {
 	if c.tokenValue() != "let" {
 		return
 	}
+	c.writeSourceLine()
 	c.advance()
+	c.compileAssignment()
+	c.compileTokenValue(";")
+
+	// c.writeString("<letStatement>\n")
+	// c.writeTokenAndAdvance()
+	// c.advance()
+	// c.compileIdentifier(false, "", "")
+	// c.handleArrayIndex()
+	// c.compileTokenValue("=")
+	// c.compileExpression()
+	// c.compileTokenValue(";")
+	// c.writeString("</letStatement>\n")
+}
+
+// compileAssignment compiles the varName = expression or varName[index] = expression part of a
+// let statement, it is shared with the clauses of a for loop.
+func (c *compilationEngine) compileAssignment() {
 	// get index and kind of the variable we are assigning to
-	kind := c.symbolTable.KindOf(c.tokenValue())
-	index := c.symbolTable.IndexOf(c.tokenValue())
+	varName := c.tokenValue()
+	variable := c.lookupVariable(varName)
+	kind := variable.Kind
+	index := variable.Index
 	c.advance()
 	// need to handle arrays here
 	isArrayAssignment := c.tokenValue() == "["
@@ -394,7 +778,7 @@ func (c *compilationEngine) compileLet() {
 	}
 	c.advance()
 	// complete operation after the equals
-	c.compileExpression()
+	exprType := c.compileExpression()
 	// pop the result back to the index/variable found
 	if isArrayAssignment {
 		c.output.WritePop(writer.Temp, 0)
@@ -402,20 +786,30 @@ func (c *compilationEngine) compileLet() {
 		c.output.WritePush(writer.Temp, strconv.Itoa(0))
 		c.output.WritePop(writer.That, 0)
 	} else {
+		c.checkAssignable(variable.Type, exprType, "assignment to "+varName)
 		segment := convertKindToSegment(kind)
 		c.output.WritePop(segment, index)
 	}
-	c.advance()
+}
 
-	// c.writeString("<letStatement>\n")
-	// c.writeTokenAndAdvance()
-	// c.advance()
-	// c.compileIdentifier(false, "", "")
-	// c.handleArrayIndex()
-	// c.compileTokenValue("=")
-	// c.compileExpression()
-	// c.compileTokenValue(";")
-	// c.writeString("</letStatement>\n")
+// lookupVariable finds a variable in scope, reporting it if it is not defined. The returned
+// symbol of an undefined variable still has kind None so code generation can carry on.
+func (c *compilationEngine) lookupVariable(name string) cache.Symbol {
+	symbol, ok := c.symbolTable.Lookup(name)
+	if !ok {
+		c.reportf("undefined variable %s", name)
+		return cache.Symbol{Name: name, Kind: cache.None}
+	}
+	return symbol
+}
+
+func isPrimitiveType(symbolType string) bool {
+	switch symbolType {
+	case "int", "char", "boolean":
+		return true
+	default:
+		return false
+	}
 }
 
 func convertKindToSegment(kind cache.Kind) writer.Segment {
@@ -447,6 +841,7 @@ func (c *compilationEngine) compileIf() {
 	if c.tokenValue() != "if" {
 		return
 	}
+	c.writeSourceLine()
 	// c.writeString("<ifStatement>\n")
 	c.count.ifIdx++
 	ifIdxStr := strconv.Itoa(c.count.ifIdx)
@@ -464,7 +859,12 @@ func (c *compilationEngine) compileIf() {
 	c.output.WriteLabel("else" + ifIdxStr)
 	if c.tokenValue() == "else" {
 		c.advance()
-		c.handleStatements()
+		if c.options.Extended && c.tokenValue() == "if" {
+			// else if chains nest the next if in place of the else block
+			c.compileIf()
+		} else {
+			c.handleStatements()
+		}
 	}
 	// compute code inside else
 	// end of statement label
@@ -481,6 +881,7 @@ func (c *compilationEngine) compileWhile() {
 	if c.tokenValue() != "while" {
 		return
 	}
+	c.writeSourceLine()
 	// c.writeString("<whileStatement>\n")
 	c.count.whileIdx++
 	whileIdxStr := strconv.Itoa(c.count.whileIdx)
@@ -492,7 +893,7 @@ func (c *compilationEngine) compileWhile() {
 	c.output.WriteArithmetic(writer.Not)
 	c.output.WriteIf("endWhile" + whileIdxStr)
 	// code inside while loop
-	c.handleStatements()
+	c.compileLoopBody(loop{"endWhile" + whileIdxStr, "while" + whileIdxStr})
 	// goto start label
 	c.output.WriteGoto("while" + whileIdxStr)
 	// label for end of loop
@@ -504,14 +905,165 @@ func (c *compilationEngine) compileWhile() {
 	// c.writeString("</whileStatement>\n")
 }
 
+// compileLoopBody compiles the statements of a loop, break and continue inside them jump to the
+// labels of l.
+func (c *compilationEngine) compileLoopBody(l loop) {
+	c.count.loops = append(c.count.loops, l)
+	c.handleStatements()
+	c.count.loops = c.count.loops[:len(c.count.loops)-1]
+}
+
+// isExtendedKeyword reports whether the current token is the extended-Jack keyword value, in
+// standard Jack the same word is an identifier.
+func (c *compilationEngine) isExtendedKeyword(value string) bool {
+	return c.tokenValue() == value && c.tokenCategory() == tokenizer.Keyword
+}
+
+// compileFor compiles for (init; condition; step) { statements }. Each clause may be empty, an
+// empty condition loops until break. The clauses are compiled in source order, so the step sits
+// ahead of the body and the code jumps around it:
+//
+//	init
+//	label forN
+//	if-goto endForN unless condition
+//	goto forBodyN
+//	label forStepN    // continue jumps here
+//	step
+//	goto forN
+//	label forBodyN
+//	statements
+//	goto forStepN
+//	label endForN     // break jumps here
+func (c *compilationEngine) compileFor() {
+	if !c.isExtendedKeyword("for") {
+		return
+	}
+	c.writeSourceLine()
+	c.count.whileIdx++
+	forIdxStr := strconv.Itoa(c.count.whileIdx)
+	c.advance()
+	c.compileTokenValue("(")
+	if c.tokenValue() != ";" {
+		c.compileAssignment()
+	}
+	c.compileTokenValue(";")
+	c.output.WriteLabel("for" + forIdxStr)
+	if c.tokenValue() != ";" {
+		c.compileExpression()
+		c.output.WriteArithmetic(writer.Not)
+		c.output.WriteIf("endFor" + forIdxStr)
+	}
+	c.compileTokenValue(";")
+	c.output.WriteGoto("forBody" + forIdxStr)
+	c.output.WriteLabel("forStep" + forIdxStr)
+	if c.tokenValue() != ")" {
+		c.compileAssignment()
+	}
+	c.compileTokenValue(")")
+	c.output.WriteGoto("for" + forIdxStr)
+	c.output.WriteLabel("forBody" + forIdxStr)
+	c.compileLoopBody(loop{"endFor" + forIdxStr, "forStep" + forIdxStr})
+	c.output.WriteGoto("forStep" + forIdxStr)
+	c.output.WriteLabel("endFor" + forIdxStr)
+}
+
+// compileSwitch compiles switch (expression) { case N: statements ... default: statements }.
+// Cases do not fall through, each one is an if with its own else label and all of them share
+// the end label, which break also jumps to. Consecutive case labels share the statements that
+// follow them. The value is kept in temp 1 while it is compared, no statement runs before the
+// comparisons of a case so nested switches and calls can reuse it.
+func (c *compilationEngine) compileSwitch() {
+	if !c.isExtendedKeyword("switch") {
+		return
+	}
+	c.writeSourceLine()
+	c.count.ifIdx++
+	endLabel := "end" + strconv.Itoa(c.count.ifIdx)
+	c.advance()
+	c.handleExpressionBrackets()
+	c.output.WritePop(writer.Temp, 1)
+	c.compileTokenValue("{")
+	continueLabel := ""
+	if len(c.count.loops) > 0 {
+		continueLabel = c.count.loops[len(c.count.loops)-1].continueLabel
+	}
+	c.count.loops = append(c.count.loops, loop{endLabel, continueLabel})
+	seen := make(map[int]bool)
+	for c.isExtendedKeyword("case") {
+		c.count.ifIdx++
+		ifIdxStr := strconv.Itoa(c.count.ifIdx)
+		for c.isExtendedKeyword("case") {
+			c.advance()
+			value := c.compileCaseValue()
+			if seen[value] {
+				c.reportf("duplicate case %d", value)
+			}
+			seen[value] = true
+			c.compileTokenValue(":")
+			c.output.WritePush(writer.Temp, "1")
+			c.output.WritePush(writer.Const, strconv.Itoa(value))
+			c.output.WriteArithmetic(writer.Eq)
+			if c.isExtendedKeyword("case") {
+				c.output.WriteIf("case" + ifIdxStr)
+			}
+		}
+		c.output.WriteArithmetic(writer.Not)
+		c.output.WriteIf("else" + ifIdxStr)
+		c.output.WriteLabel("case" + ifIdxStr)
+		c.compileStatements()
+		c.output.WriteGoto(endLabel)
+		c.output.WriteLabel("else" + ifIdxStr)
+	}
+	if c.isExtendedKeyword("default") {
+		c.advance()
+		c.compileTokenValue(":")
+		c.compileStatements()
+	}
+	c.count.loops = c.count.loops[:len(c.count.loops)-1]
+	if c.isExtendedKeyword("case") {
+		panic(fmt.Errorf("case after default"))
+	}
+	c.compileTokenValue("}")
+	c.output.WriteLabel(endLabel)
+}
+
+// compileCaseValue reads the constant of a case label.
+func (c *compilationEngine) compileCaseValue() int {
+	return int(c.compileConstantExpression("case value").value)
+}
+
+// compileBreak compiles break; and continue; as a jump to the labels of the innermost loop or
+// switch, continue skips over switches to the enclosing loop.
+func (c *compilationEngine) compileBreak() {
+	if !c.isExtendedKeyword("break") && !c.isExtendedKeyword("continue") {
+		return
+	}
+	c.writeSourceLine()
+	statement := c.tokenValue()
+	var l loop
+	if len(c.count.loops) > 0 {
+		l = c.count.loops[len(c.count.loops)-1]
+	}
+	if statement == "break" && l.breakLabel != "" {
+		c.output.WriteGoto(l.breakLabel)
+	} else if statement == "continue" && l.continueLabel != "" {
+		c.output.WriteGoto(l.continueLabel)
+	} else {
+		c.reportf("%s is not in a loop", statement)
+	}
+	c.advance()
+	c.compileTokenValue(";")
+}
+
 func (c *compilationEngine) compileDo() {
 	if c.tokenValue() != "do" {
 		return
 	}
+	c.writeSourceLine()
 	// c.writeString("<doStatement>\n")
 	// c.writeTokenAndAdvance()
 	c.advance()
-	c.compileTerm()
+	c.writeOperand(c.compileTerm())
 	c.output.WritePop(writer.Temp, 0)
 	c.advance()
 	// identifierName := c.tokenValue()
@@ -539,19 +1091,28 @@ func (c *compilationEngine) compileReturn() {
 	if c.tokenValue() != "return" {
 		return
 	}
+	c.writeSourceLine()
 	// c.writeString("<returnStatement>\n")
 	// c.writeTokenAndAdvance()
 	c.advance()
 	// handle empty return
 	if c.tokenValue() == ";" {
 		// c.writeTokenAndAdvance()
+		if c.options.Strict && c.count.returnType != "void" {
+			c.warnf("missing return value, expected %s", c.count.returnType)
+		}
 		c.output.WritePush(writer.Const, strconv.Itoa(0))
 		c.output.WriteReturn()
 		c.advance()
 		// c.writeString("</returnStatement>\n")
 		return
 	}
-	c.compileExpression()
+	exprType := c.compileExpression()
+	if c.options.Strict && c.count.returnType == "void" {
+		c.warnf("void subroutine returns a value")
+	} else {
+		c.checkAssignable(c.count.returnType, exprType, "return value")
+	}
 	c.output.WriteReturn()
 	c.compileTokenValue(";")
 	// c.writeString("</returnStatement>\n")
@@ -570,6 +1131,17 @@ func (c *compilationEngine) isTokenStatement() bool {
 			return true
 		}
 	}
+	extendedTokens := []string{
+		"for",
+		"switch",
+		"break",
+		"continue",
+	}
+	for _, token := range extendedTokens {
+		if c.isExtendedKeyword(token) {
+			return true
+		}
+	}
 	return false
 }
 
@@ -580,6 +1152,9 @@ func (c *compilationEngine) compileStatement() {
 	c.compileLet()
 	c.compileIf()
 	c.compileWhile()
+	c.compileFor()
+	c.compileSwitch()
+	c.compileBreak()
 	c.compileDo()
 	c.compileReturn()
 	c.compileStatement()
@@ -669,9 +1244,8 @@ func (c *compilationEngine) handleMultipleSubroutineVarDecs(symbolType string, b
 	nLocals++
 	c.advance()
 	varName := c.tokenValue()
-	c.symbolTable.Define(varName, symbolType, cache.Var)
+	idx := c.symbolTable.Define(varName, symbolType, cache.Var).Index
 	buffer += "push constant 0\n"
-	idx := c.symbolTable.IndexOf(varName)
 	buffer += "pop local " + strconv.Itoa(idx) + "\n"
 	c.advance()
 	buffer, nLocals = c.handleMultipleSubroutineVarDecs(symbolType, buffer, nLocals)
@@ -690,9 +1264,8 @@ func (c *compilationEngine) compileVarDec(buffer string, nLocals int) (string, i
 	// c.compileTokenIsType()
 	c.advance()
 	varName := c.tokenValue()
-	c.symbolTable.Define(varName, symbolType, cache.Var)
+	idx := c.symbolTable.Define(varName, symbolType, cache.Var).Index
 	buffer += "push constant 0\n"
-	idx := c.symbolTable.IndexOf(varName)
 	buffer += "pop local " + strconv.Itoa(idx) + "\n"
 	c.advance()
 	// c.compileIdentifier(true, "var", symbolType)
@@ -708,15 +1281,18 @@ func (c *compilationEngine) compileSubroutine(className string) {
 		return
 	}
 	c.symbolTable.StartSubroutine()
+	c.writeSourceLine()
+	c.count.subroutineKind, _ = cache.ParseSubroutineKind(c.tokenValue())
 	if c.tokenValue() == "function" {
 		// c.writeString("<subroutineDec>\n")
 		// c.writeTokenAndAdvance()
 		nLocals := 0
 		c.advance()
-		// returnType := c.tokenValue()
+		c.count.returnType = c.tokenValue()
 		c.compileTokenIsTypeOrVoid()
 		// c.compileIdentifier(true, "subroutine", "")
 		subroutineName := c.tokenValue()
+		c.count.subroutineName = subroutineName
 		c.advance()
 		c.compileTokenValue("(")
 		c.compileParameterList()
@@ -737,10 +1313,11 @@ func (c *compilationEngine) compileSubroutine(className string) {
 		// c.symbolTable.Define("this", className, cache.Arg)
 		nLocals := 0
 		c.advance()
-		// returnType := c.tokenValue()
+		c.count.returnType = c.tokenValue()
 		c.compileTokenIsTypeOrVoid()
 		// c.compileIdentifier(true, "subroutine", "")
 		subroutineName := c.tokenValue()
+		c.count.subroutineName = subroutineName
 		c.advance()
 		c.compileTokenValue("(")
 		c.compileParameterList()
@@ -750,7 +1327,7 @@ func (c *compilationEngine) compileSubroutine(className string) {
 		varDecBuffer, nLocals = c.compileVarDec(varDecBuffer, nLocals)
 		c.output.WriteFunction(fmt.Sprintf("%s.%s", className, subroutineName), nLocals)
 		c.output.WriteString(varDecBuffer)
-		numOfFieldVars := c.symbolTable.FieldIndex
+		numOfFieldVars := c.symbolTable.VarCount(cache.Field)
 		c.output.WritePush(writer.Const, strconv.Itoa(numOfFieldVars))
 		c.output.WriteCall("Memory.alloc", 1)
 		c.output.WritePop(writer.Pointer, 0)
@@ -760,10 +1337,11 @@ func (c *compilationEngine) compileSubroutine(className string) {
 		c.symbolTable.Define("this", className, cache.Arg)
 		nLocals := 0
 		c.advance()
-		// returnType := c.tokenValue()
+		c.count.returnType = c.tokenValue()
 		c.compileTokenIsTypeOrVoid()
 		// c.compileIdentifier(true, "subroutine", "")
 		subroutineName := c.tokenValue()
+		c.count.subroutineName = subroutineName
 		c.advance()
 		c.compileTokenValue("(")
 		c.compileParameterList()
@@ -778,10 +1356,20 @@ func (c *compilationEngine) compileSubroutine(className string) {
 		c.compileStatements()
 		c.compileTokenValue("}")
 	}
+	c.symbols.Subroutines = append(c.symbols.Subroutines, cache.SubroutineSymbols{
+		Name:    c.count.subroutineName,
+		Kind:    c.count.subroutineKind.String(),
+		Symbols: c.symbolTable.SubroutineScope(),
+	})
 	c.compileSubroutine(className)
 }
 
 func (c *compilationEngine) compileClassVarDec() {
+	if c.isExtendedKeyword("const") {
+		c.compileConstDec()
+		c.compileClassVarDec()
+		return
+	}
 	if c.tokenValue() != "static" && c.tokenValue() != "field" {
 		return
 	}
@@ -798,15 +1386,37 @@ func (c *compilationEngine) compileClassVarDec() {
 	c.compileClassVarDec()
 }
 
+// recoverGrammarError turns the panic raised on a grammar or lexical error into an error of
+// the class. Runtime errors are bugs in the engine and keep panicking.
+func (c *compilationEngine) recoverGrammarError() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err, ok := r.(error)
+	if _, isRuntimeError := r.(runtime.Error); !ok || isRuntimeError {
+		panic(r)
+	}
+	if _, isLexicalError := err.(*tokenizer.Error); !isLexicalError {
+		err = fmt.Errorf("%s: %v", c.token.Pos, err)
+	}
+	c.errors = append(c.errors, err)
+}
+
 func (c *compilationEngine) compileFinalToken() {
 	if c.tokenValue() == "}" {
 		// c.writeToken()
+		c.advance()
+		if c.tokenCategory() != tokenizer.EOF {
+			panic(fmt.Errorf(`unexpected "%s" after the end of the class`, c.tokenValue()))
+		}
 	} else {
 		panic(fmt.Errorf(`expected token "}" as the final token, got "%s"`, c.tokenValue()))
 	}
 }
 
 func (c *compilationEngine) CompileClass() {
+	defer c.recoverGrammarError()
 	// c.writeString("<class>\n")
 	c.advance()
 	c.compileTokenValue("class")
@@ -816,6 +1426,8 @@ func (c *compilationEngine) CompileClass() {
 	c.compileTokenValue("{")
 	// c.advance()
 	c.compileClassVarDec()
+	c.symbols.Class = c.count.className
+	c.symbols.Symbols = c.symbolTable.ClassScope()
 	c.compileSubroutine(c.count.className)
 	c.compileFinalToken()
 	// c.writeString("</class>\n")
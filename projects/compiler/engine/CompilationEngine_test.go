@@ -0,0 +1,760 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/cache"
+	"vm/interpreter"
+)
+
+// runProgram compiles a Main class and loads it into a VM interpreter.
+func runProgram(t *testing.T, source string, options Options) *interpreter.VM {
+	t.Helper()
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+	c := NewCompilationEngine(strings.NewReader(source), w, options)
+	c.CompileClass()
+	w.Flush()
+	if errs := c.Errors(); len(errs) > 0 {
+		t.Fatalf("compile errors: %v", errs)
+	}
+	vm := interpreter.New()
+	vm.RegisterMath()
+	vm.MaxSteps = 100000
+	if err := vm.Load("Main", &out); err != nil {
+		t.Fatal(err)
+	}
+	return vm
+}
+
+// runProgramWithOS compiles a Main class and loads it into a VM interpreter together with the
+// Math class of the OS the build command links, and its Array and Memory dependencies.
+func runProgramWithOS(t *testing.T, source string, options Options) *interpreter.VM {
+	t.Helper()
+	code, errs := compileProgram([]string{source}, options)
+	if len(errs) > 0 {
+		t.Fatalf("compile errors: %v", errs)
+	}
+	vm := interpreter.New()
+	vm.Register("Sys.error", func(vm *interpreter.VM, args []int16) (int16, error) {
+		return 0, fmt.Errorf("Sys.error(%d)", args[0])
+	})
+	vm.MaxSteps = 100000
+	for _, class := range []string{"Memory", "Array", "Math"} {
+		if err := vm.LoadFile(filepath.Join("..", "..", "build", "os", class+".vm")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := vm.Load("Main", strings.NewReader(code["Main"])); err != nil {
+		t.Fatal(err)
+	}
+	for _, function := range []string{"Memory.init", "Math.init"} {
+		if _, err := vm.Call(function); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return vm
+}
+
+// runMain compiles a Main class and returns the result of calling Main.main in the VM interpreter.
+func runMain(t *testing.T, source string, options Options) int16 {
+	t.Helper()
+	result, err := runProgram(t, source, options).Call("Main.main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// mainProgram returns a class Main whose function main, declared by signature such as
+// "int main(int x)", declares vars on line 3 then runs body from line 4, one line each so that
+// tests can tell the line of an error. members are written after main.
+func mainProgram(signature string, vars string, body []string, members ...string) string {
+	source := fmt.Sprintf("class Main {\n\tfunction %s {\n\t\t%s\n\t\t%s\n\t}\n", signature, vars, strings.Join(body, "\n\t\t"))
+	for _, member := range members {
+		source += "\t" + strings.ReplaceAll(member, "\n", "\n\t") + "\n"
+	}
+	return source + "}"
+}
+
+// expressionBody initialises the locals a, b and c of an expression program then returns expr.
+func expressionBody(expr string) []string {
+	return []string{"let a = 7;", "let b = 3;", "let c = 2;", "return " + expr + ";"}
+}
+
+func TestExpressionEvaluationOrder(t *testing.T) {
+	expressions := []struct {
+		expr       string
+		leftRight  int16
+		precedence int16
+	}{
+		{"1", 1, 1},
+		{"a - b - c", 2, 2},
+		{"1 + 2 * 3", 9, 7},
+		{"2 * 3 + 1", 7, 7},
+		{"a - b + c", 6, 6},
+		{"20 / 2 / 5", 2, 2},
+		{"a * b - c * 2", 38, 17},
+		{"10 - 2 * 3", 24, 4},
+		{"1 + 2 * 3 - 4 / 2", 2, 5},
+		{"a + (b * c)", 13, 13},
+		{"(a + b) * c", 20, 20},
+		{"-a + b", -4, -4},
+		{"a - -b", 10, 10},
+		{"1 + 2 < 4", -1, -1},
+		{"a < b + 5", 5, -1},
+		{"a & 6 = 6", -1, 7},
+		{"(a = 7) & (b = 3)", -1, -1},
+		{"a | 8 & 12", 12, 15},
+		{"~(a = b) | c", -1, -1},
+		{"a * (b - c * (a - b))", 28, -35},
+		{"32767 + 1", -32768, -32768},
+		{"b * -c + a", 1, 1},
+	}
+	for _, e := range expressions {
+		got := runMain(t, mainProgram("int main()", "var int a, b, c;", expressionBody(e.expr)), Options{})
+		if got != e.leftRight {
+			t.Errorf("%s evaluated left to right was incorrect, got: %d, wanted: %d", e.expr, got, e.leftRight)
+		}
+		got = runMain(t, mainProgram("int main()", "var int a, b, c;", expressionBody(e.expr)), Options{Precedence: true})
+		if got != e.precedence {
+			t.Errorf("%s evaluated by precedence was incorrect, got: %d, wanted: %d", e.expr, got, e.precedence)
+		}
+	}
+}
+
+// compileErrors compiles source and returns the errors reported by the engine.
+func compileErrors(source string, options Options) []error {
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+	c := NewCompilationEngine(strings.NewReader(source), w, options)
+	c.CompileClass()
+	w.Flush()
+	return c.Errors()
+}
+
+func TestExtendedLoops(t *testing.T) {
+	programs := []struct {
+		statements string
+		want       int16
+	}{
+		{"for (i = 0; i < 10; i = i + 1) { let sum = sum + i; } return sum;", 45},
+		{"for (i = 10; i > 0; i = i - 3) { let sum = sum + 1; } return sum;", 4},
+		{"for (i = 0; i < 0; i = i + 1) { let sum = 99; } return sum;", 0},
+		{"let i = 3; for (; i > 0;) { let sum = sum + i; let i = i - 1; } return sum;", 6},
+		{"for (i = 0;; i = i + 1) { if (i = 5) { break; } } return i;", 5},
+		{"for (i = 0; i < 10; i = i + 1) { if (i & 1 = 1) { continue; } let sum = sum + i; } return sum;", 20},
+		{"while (true) { let i = i + 1; if (i > 3) { break; } } return i;", 4},
+		{"while (i < 10) { let i = i + 1; if (i > 5) { continue; } let sum = sum + 1; } return sum;", 5},
+		{"for (i = 0; i < 3; i = i + 1) { for (j = 0; j < 10; j = j + 1) { if (j = 2) { break; } let sum = sum + 1; } } return sum;", 6},
+		{"for (i = 0; i < 4; i = i + 1) { while (true) { break; } if (i = 2) { continue; } let sum = sum + 10; } return sum;", 30},
+	}
+	for _, p := range programs {
+		got := runMain(t, mainProgram("int main()", "var int i, j, sum;", []string{"let sum = 0;", p.statements}), Options{Extended: true})
+		if got != p.want {
+			t.Errorf("%s was incorrect, got: %d, wanted: %d", p.statements, got, p.want)
+		}
+	}
+}
+
+func TestExtendedBranches(t *testing.T) {
+	elseIf := `if (x < 0) { let result = -1; } else if (x = 0) { let result = 10; } else if (x < 10) { let result = 20; } else { let result = 30; }`
+	switchCases := `switch (x * 2) {
+		case 0: let result = 10;
+		case 2: case 4: let result = 20; if (x = 2) { break; } let result = 25;
+		case -2: let result = -1;
+		default: let result = 99;
+	}`
+	nested := `for (i = 0; i < x; i = i + 1) {
+		switch (i) {
+			case 1: continue;
+			case 3: switch (x) { case 5: break; default: let result = result + 1000; } let result = result + 100;
+			default: let result = result + 1;
+		}
+	}`
+	// the multiplications by a constant are reduced with -optimize, inside the cases of a switch
+	multiplyCases := `switch (x) {
+		case 3: let result = x * 3;
+		case 4: let result = (x * 5) + 1;
+		default: switch (x * 7) { case 7: let result = x * 11; default: let result = x * 13; }
+	}`
+	programs := []struct {
+		statements string
+		x          int16
+		want       int16
+	}{
+		{multiplyCases, 3, 9},
+		{multiplyCases, 4, 21},
+		{multiplyCases, 1, 11},
+		{multiplyCases, 2, 26},
+		{elseIf, -5, -1},
+		{elseIf, 0, 10},
+		{elseIf, 9, 20},
+		{elseIf, 10, 30},
+		{switchCases, 0, 10},
+		{switchCases, 1, 25},
+		{switchCases, 2, 20},
+		{switchCases, -1, -1},
+		{switchCases, 7, 99},
+		{"switch (x) { case 1: let result = 1; }", 2, 0},
+		{"switch (x) { default: let result = 5; }", 2, 5},
+		{nested, 5, 103},
+		{nested, 4, 1102},
+	}
+	for _, p := range programs {
+		for _, optimize := range []bool{false, true} {
+			vm := runProgram(t, mainProgram("int main(int x)", "var int i, result;", []string{"let result = 0;", p.statements, "return result;"}), Options{Extended: true, Optimize: optimize})
+			got, err := vm.Call("Main.main", p.x)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != p.want {
+				t.Errorf("%s with x = %d and optimize %t was incorrect, got: %d, wanted: %d", p.statements, p.x, optimize, got, p.want)
+			}
+		}
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	// calls counts how many operands were evaluated by Main.touch
+	source := `class Main {
+	static int calls;
+	function boolean touch(boolean b) {
+		let calls = calls + 1;
+		return b;
+	}
+	function int main(int x) {
+		let calls = 0;
+		if (%s) {
+			return calls;
+		}
+		return -calls;
+	}
+	function int value(int x) {
+		return %s;
+	}
+}`
+	conditions := []struct {
+		expr string
+		x    int16
+		want int16
+	}{
+		{"Main.touch(false) && Main.touch(true)", 0, -1},
+		{"Main.touch(true) && Main.touch(true)", 0, 2},
+		{"Main.touch(true) && Main.touch(false)", 0, -2},
+		{"Main.touch(true) || Main.touch(false)", 0, 1},
+		{"Main.touch(false) || Main.touch(true)", 0, 2},
+		{"Main.touch(false) || Main.touch(false)", 0, -2},
+		{"x > 0 && Main.touch(x < 10)", 0, 0},
+		{"x > 0 && Main.touch(x < 10)", 5, 1},
+		{"x > 0 && x < 10 || Main.touch(x = 20)", 5, 0},
+		{"x > 0 && x < 10 || Main.touch(x = 20)", 20, 1},
+		{"Main.touch(false) && Main.touch(true) || Main.touch(true)", 0, 2},
+		{"Main.touch(true) || Main.touch(true) && Main.touch(false)", 0, 1},
+	}
+	for _, e := range conditions {
+		vm := runProgram(t, fmt.Sprintf(source, e.expr, "0"), Options{Extended: true})
+		got, err := vm.Call("Main.main", e.x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != e.want {
+			t.Errorf("Operands evaluated by %s with x = %d were incorrect, got: %d, wanted: %d", e.expr, e.x, got, e.want)
+		}
+	}
+	values := []struct {
+		expr string
+		x    int16
+		want int16
+	}{
+		{"x && 4", 3, -1},
+		{"x && 4", 0, 0},
+		{"x || 0", 2, -1},
+		{"0 || x", 2, -1},
+		{"0 || x", 0, 0},
+		{"(x = 1) && (x + 1 = 2)", 1, -1},
+		{"x & 6 && 1", 1, 0},
+		{"x & 6 && 1", 2, -1},
+		{"~(x && 0)", 1, -1},
+	}
+	for _, e := range values {
+		for _, precedence := range []bool{false, true} {
+			vm := runProgram(t, fmt.Sprintf(source, "true", e.expr), Options{Extended: true, Precedence: precedence})
+			got, err := vm.Call("Main.value", e.x)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != e.want {
+				t.Errorf("%s with x = %d was incorrect, got: %d, wanted: %d", e.expr, e.x, got, e.want)
+			}
+		}
+	}
+}
+
+func TestCharacters(t *testing.T) {
+	source := `class Main {
+	function int main(char c) {
+		do Output.printString("%s");
+		switch (c) {
+			case 'a': return 1;
+			case '\n': return 2;
+			default: return c;
+		}
+	}
+}`
+	programs := []struct {
+		str   string
+		chars []int16
+		c     int16
+		want  int16
+	}{
+		{`say \"hi\"`, []int16{115, 97, 121, 32, 34, 104, 105, 34}, 'a', 1},
+		{`\\'`, []int16{92, 39}, 128, 2},
+		{`\n\b`, []int16{128, 129}, 'z', 'z'},
+	}
+	for _, p := range programs {
+		vm := runProgram(t, fmt.Sprintf(source, p.str), Options{Extended: true})
+		var length int16
+		var chars []int16
+		vm.Register("String.new", func(vm *interpreter.VM, args []int16) (int16, error) {
+			length = args[0]
+			return 0, nil
+		})
+		vm.Register("String.appendChar", func(vm *interpreter.VM, args []int16) (int16, error) {
+			chars = append(chars, args[1])
+			return 0, nil
+		})
+		vm.Register("Output.printString", func(vm *interpreter.VM, args []int16) (int16, error) {
+			return 0, nil
+		})
+		got, err := vm.Call("Main.main", p.c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(chars) != fmt.Sprint(p.chars) || int(length) != len(p.chars) {
+			t.Errorf("Characters of %s were incorrect, got: %v of length %d, wanted: %v", p.str, chars, length, p.chars)
+		}
+		if got != p.want {
+			t.Errorf("Case of %d was incorrect, got: %d, wanted: %d", p.c, got, p.want)
+		}
+	}
+}
+
+func TestExtendedErrors(t *testing.T) {
+	programs := []struct {
+		statements string
+		options    Options
+		err        string
+	}{
+		{"break; return 0;", Options{Extended: true}, "5:3: Main.main: break is not in a loop"},
+		{"if (true) { continue; } return 0;", Options{Extended: true}, "5:15: Main.main: continue is not in a loop"},
+		{"for (i = 0; i < 1; i = i + 1) {} return 0;", Options{}, `5:3: expected token to have value "}", got "for"`},
+		{"switch (i) { case 1: continue; } return 0;", Options{Extended: true}, "5:24: Main.main: continue is not in a loop"},
+		{"switch (i) { case 1: case 2: case 1: } return 0;", Options{Extended: true}, "5:38: Main.main: duplicate case 1"},
+		{"switch (i) { case i: } return 0;", Options{Extended: true}, "5:22: Main.main: case value is not a constant expression"},
+		{"switch (i) { default: case 1: } return 0;", Options{Extended: true}, "5:25: case after default"},
+		{`let i = 'ab'; return 0;`, Options{Extended: true}, "5:11: Main.main: character constant 'ab' must hold exactly one character"},
+		{`let i = ''; return 0;`, Options{Extended: true}, "5:11: Main.main: character constant '' must hold exactly one character"},
+		{`do Output.printString("\q"); return 0;`, Options{Extended: true}, `5:25: Main.main: unknown escape sequence \q`},
+		{`do Output.printString("naïve"); return 0;`, Options{}, `5:25: Main.main: character 'ï' is not in the Hack character set`},
+	}
+	for _, p := range programs {
+		errs := compileErrors(mainProgram("int main()", "var int i, j, sum;", []string{"let sum = 0;", p.statements}), p.options)
+		if len(errs) == 0 || !strings.HasPrefix(errs[0].Error(), p.err) {
+			t.Errorf("Errors for %q were incorrect, got: %v, wanted: %s", p.statements, errs, p.err)
+		}
+	}
+}
+
+// compileProgram indexes and compiles the classes of a program, it returns the VM code of
+// every class and the errors found.
+func compileProgram(sources []string, options Options) (map[string]string, []error) {
+	index := cache.NewProgramIndex()
+	var errs []error
+	for _, source := range sources {
+		class, err := ScanClass(strings.NewReader(source), options)
+		if err != nil {
+			return nil, []error{err}
+		}
+		if err := index.Add(class); err != nil {
+			return nil, []error{err}
+		}
+	}
+	constantErrs := ResolveConstants(index, options)
+	for _, class := range index.Classes() {
+		errs = append(errs, constantErrs[class.Name]...)
+	}
+	options.Classes = index
+	code := make(map[string]string)
+	for _, source := range sources {
+		var out bytes.Buffer
+		w := bufio.NewWriter(&out)
+		c := NewCompilationEngine(strings.NewReader(source), w, options)
+		c.CompileClass()
+		w.Flush()
+		errs = append(errs, c.Errors()...)
+		code[c.Symbols().Class] = out.String()
+	}
+	return code, errs
+}
+
+func TestConstants(t *testing.T) {
+	grid := `class Grid {
+	const int CELLS = WIDTH * Grid.HEIGHT;
+	const int WIDTH = 32;
+	const int HEIGHT = 512 / WIDTH;
+	const char QUIT = 'q';
+	const boolean WRAP = WIDTH > 16;
+}`
+	main := `class Main {
+	const int SIDE = -Grid.WIDTH / 4;
+	function int main(int x) {
+		if (x = Grid.QUIT) {
+			return Grid.CELLS;
+		}
+		if (Grid.WRAP) {
+			return SIDE + x;
+		}
+		return 0;
+	}
+}`
+	code, errs := compileProgram([]string{grid, main}, Options{Extended: true})
+	if len(errs) > 0 {
+		t.Fatalf("compile errors: %v", errs)
+	}
+	if code["Grid"] != "" || strings.Contains(code["Main"], "Math.") {
+		t.Errorf("Constants were not folded, got:\n%s%s", code["Grid"], code["Main"])
+	}
+	vm := interpreter.New()
+	vm.RegisterMath()
+	if err := vm.Load("Main", strings.NewReader(code["Main"])); err != nil {
+		t.Fatal(err)
+	}
+	calls := []struct {
+		x    int16
+		want int16
+	}{
+		{'q', 512},
+		{1, -7},
+	}
+	for _, call := range calls {
+		got, err := vm.Call("Main.main", call.x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != call.want {
+			t.Errorf("Main.main(%d) was incorrect, got: %d, wanted: %d", call.x, got, call.want)
+		}
+	}
+
+	local := runMain(t, `class Main {
+	const int A = 3;
+	const int B = A * A - 1;
+	function int main() {
+		var int A;
+		let A = 100;
+		return A + B;
+	}
+}`, Options{Extended: true})
+	if local != 108 {
+		t.Errorf("Local constant was incorrect, got: %d, wanted: %d", local, 108)
+	}
+}
+
+func TestConstantErrors(t *testing.T) {
+	programs := []struct {
+		sources []string
+		err     string
+	}{
+		{[]string{"class A {\n\tconst int X = B.Y + 1;\n}", "class B {\n\tconst int Y = A.X;\n}"}, "2:19: B.Y: constant A.X depends on itself"},
+		{[]string{"class A {\n\tconst int X = A.Z;\n}"}, "2:19: A.X: unknown constant A.Z"},
+		{[]string{"class A {\n\tconst int X = 1 / (2 - 2);\n}"}, "2:27: A.X: division by zero"},
+		{[]string{"class A {\n\tconst int X = Math.abs(1);\n}"}, "2:27: A.X: initializer of X is not a constant expression"},
+		{[]string{"class A {\n\tconst int X = 1 2;\n}"}, `2:18: unexpected "2" in the initializer of X`},
+		{[]string{"class A {\n\tconst int X = 1;\n\tconst int X = 2;\n}"}, "constant A.X is declared more than once"},
+		{[]string{"class A {\n\tconst A X = null;\n}"}, "2:14: A.X: constant X must be an int, char or boolean, not A"},
+	}
+	for _, p := range programs {
+		_, errs := compileProgram(p.sources, Options{Extended: true})
+		if len(errs) == 0 || errs[0].Error() != p.err {
+			t.Errorf("Errors for %q were incorrect, got: %v, wanted: %s", p.sources, errs, p.err)
+		}
+	}
+}
+
+const pointClass = `class Point {
+	field int x, y;
+	constructor Point new(int ax, int ay) {
+		let x = ax;
+		let y = ay;
+		return this;
+	}
+	method int getX() {
+		return x;
+	}
+	function int origin() {
+		return 0;
+	}
+}`
+
+func TestCallChecks(t *testing.T) {
+	programs := []struct {
+		statements string
+		err        string
+	}{
+		{"let p = Point.new(1, 2); do Output.printInt(p.getX() + Point.origin()); do Memory.deAlloc(p);", ""},
+		{"let p = Point.new(1);", "4:23: Main.main: Point.new expects 2 arguments, got 1"},
+		{"do p.getX(3);", "4:15: Main.main: Point.getX expects 0 arguments, got 1"},
+		{"do Point.getX();", "4:18: Main.main: method Point.getX cannot be called without an object"},
+		{"do p.origin();", "4:16: Main.main: function Point.origin cannot be called on an object"},
+		{"do draw();", "4:10: Main.main: method draw cannot be called from a function"},
+		{"do Point.move();", "4:18: Main.main: unknown subroutine Point.move"},
+		{"do Circle.new();", "4:18: Main.main: unknown class Circle"},
+		{"do Math.multiply(2);", "4:22: Main.main: Math.multiply expects 2 arguments, got 1"},
+		{"do Output.print(1);", "4:21: Main.main: unknown subroutine Output.print"},
+		{"do Screen.drawPixel(1, 2);", ""},
+	}
+	for _, p := range programs {
+		_, errs := compileProgram([]string{pointClass, mainProgram("void main()", "var Point p;", []string{p.statements, "return;"}, "method void draw() {\n\treturn;\n}")}, Options{})
+		got := fmt.Sprint(errs)
+		want := "[]"
+		if p.err != "" {
+			want = "[" + p.err + "]"
+		}
+		if got != want {
+			t.Errorf("Errors for %q were incorrect, got: %s, wanted: %s", p.statements, got, want)
+		}
+	}
+
+	// Without the class index an unqualified call from a function is not checked.
+	source := "class Main {\n\tfunction void main() {\n\t\tdo helper();\n\t\treturn;\n\t}\n\tfunction void helper() {\n\t\treturn;\n\t}\n}"
+	if errs := compileErrors(source, Options{}); len(errs) > 0 {
+		t.Errorf("Errors without a class index were incorrect, got: %v, wanted: none", errs)
+	}
+}
+
+func TestScanClass(t *testing.T) {
+	class, err := ScanClass(strings.NewReader(pointClass), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subroutines := []struct {
+		name   string
+		kind   cache.SubroutineKind
+		params string
+	}{
+		{"new", cache.Constructor, "[{ax int} {ay int}]"},
+		{"getX", cache.Method, "[]"},
+		{"origin", cache.Function, "[]"},
+	}
+	for _, s := range subroutines {
+		sub, ok := class.Subroutine(s.name)
+		if !ok {
+			t.Errorf("Subroutine %s was not found", s.name)
+			continue
+		}
+		if sub.Kind != s.kind || fmt.Sprint(sub.Params) != s.params {
+			t.Errorf("Signature of %s was incorrect, got: %s %v, wanted: %s %s", s.name, sub.Kind, sub.Params, s.kind, s.params)
+		}
+	}
+
+	sources := []struct {
+		source string
+		err    string
+	}{
+		{"class A {\n\tfunction void f() {}\n\tmethod int f(int x) {}\n}", "subroutine A.f is declared more than once"},
+		{"class A {\n\tfunction void f() {", "2:21: unexpected end of file"},
+		{"klass A {}", `1:1: expected token to have value "class", got "klass"`},
+	}
+	for _, s := range sources {
+		_, err := ScanClass(strings.NewReader(s.source), Options{})
+		if err == nil || err.Error() != s.err {
+			t.Errorf("Error for %q was incorrect, got: %v, wanted: %s", s.source, err, s.err)
+		}
+	}
+}
+
+func TestStrictWarnings(t *testing.T) {
+	programs := []struct {
+		returnType string
+		statements string
+		warning    string
+	}{
+		{"int", "let c = 65; let i = c + 1; let c = i; return c;", ""},
+		{"void", "let a = 8000; let a = s; let s = a; let i = a; let s = null; let a = null; return;", ""},
+		{"boolean", "let b = (i < 1) | b; let i = i & 7; return b & true;", ""},
+		{"int", `let i = "abc"; return i;`, "4:16: warning: Main.main: cannot use String as int in assignment to i"},
+		{"int", "let i = null; return i;", "4:15: warning: Main.main: cannot use null as int in assignment to i"},
+		{"int", "let i = i < 1; return i;", "4:16: warning: Main.main: cannot use boolean as int in assignment to i"},
+		{"int", "let b = i | 1; return i;", "4:16: warning: Main.main: cannot use int as boolean in assignment to b"},
+		{"boolean", "return 1;", "4:11: warning: Main.main: cannot use int as boolean in return value"},
+		{"int", "return;", "4:9: warning: Main.main: missing return value, expected int"},
+		{"void", "return 1;", "4:11: warning: Main.main: void subroutine returns a value"},
+		{"void", "do i.abs(); return;", "4:11: warning: Main.main: cannot call method abs on i of type int"},
+	}
+	for _, p := range programs {
+		var out bytes.Buffer
+		w := bufio.NewWriter(&out)
+		c := NewCompilationEngine(strings.NewReader(mainProgram(p.returnType+" main()", "var int i; var char c; var boolean b; var String s; var Array a;", []string{p.statements})), w, Options{Strict: true})
+		c.CompileClass()
+		if errs := c.Errors(); len(errs) > 0 {
+			t.Errorf("Errors for %q were incorrect, got: %v, wanted: none", p.statements, errs)
+			continue
+		}
+		got := fmt.Sprint(c.Warnings())
+		want := "[]"
+		if p.warning != "" {
+			want = "[" + p.warning + "]"
+		}
+		if got != want {
+			t.Errorf("Warnings for %q were incorrect, got: %s, wanted: %s", p.statements, got, want)
+		}
+	}
+}
+
+// constantCode returns the code that pushes value, push constant only takes 0 to 32767 so a
+// negative value is followed by a neg, or a not for -32768.
+func constantCode(value int16) string {
+	switch {
+	case value == -32768:
+		return "push constant 32767\nnot"
+	case value < 0:
+		return fmt.Sprintf("push constant %d\nneg", -value)
+	}
+	return fmt.Sprintf("push constant %d", value)
+}
+
+func TestConstantFolding(t *testing.T) {
+	expressions := []struct {
+		expr   string
+		folded bool
+	}{
+		{"2 * 3 + 4", true},
+		{"100 / 7 - 1", true},
+		{"-(5 * 6) + ~0", true},
+		{"(1 < 2) & (3 = 3)", true},
+		{"32767 + 1", true},
+		{"20000 * 3", true},
+		{"-32767 - 1 / 1", true},
+		{"a * (2 * 3)", false},
+		{"(2 * 3) * a", false},
+		{"a + 2 * 3", false},
+	}
+	for _, e := range expressions {
+		for _, precedence := range []bool{false, true} {
+			source := mainProgram("int main()", "var int a, b, c;", expressionBody(e.expr))
+			want := runMain(t, source, Options{Precedence: precedence})
+			got := runMain(t, source, Options{Precedence: precedence, Optimize: true})
+			if got != want {
+				t.Errorf("Folded %s was incorrect, got: %d, wanted: %d", e.expr, got, want)
+			}
+			code, errs := compileProgram([]string{source}, Options{Precedence: precedence, Optimize: true})
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			// the expression is compiled between the last let and the return
+			main := code["Main"]
+			expression := strings.TrimSpace(main[strings.LastIndex(main, "pop local 2")+len("pop local 2") : strings.LastIndex(main, "return")])
+			if folded := expression == constantCode(want); folded != e.folded {
+				t.Errorf("Folding of %s was incorrect, got:\n%s", e.expr, expression)
+			}
+		}
+	}
+}
+
+func TestStrengthReduction(t *testing.T) {
+	source := `class Main {
+	function int left(int x) {
+		return %[1]s %[2]s x;
+	}
+	function int right(int x) {
+		return x %[2]s %[1]s;
+	}
+}`
+	constants := []string{"0", "1", "2", "3", "5", "7", "10", "15", "16", "17", "32", "100", "512", "16384",
+		"-1", "-2", "-3", "-12", "-16", "-16384", "-32767", "32767"}
+	ops := []string{"*", "/", "+", "-", "&", "|"}
+	xs := []int16{0, 1, -1, 2, 7, -7, 99, -1000, 1234, 16383, 32767, -32768}
+	for _, op := range ops {
+		for _, k := range constants {
+			if op == "/" && k == "0" {
+				continue
+			}
+			program := fmt.Sprintf(source, k, op)
+			genericCode, _ := compileProgram([]string{program}, Options{Precedence: true})
+			reducedCode, _ := compileProgram([]string{program}, Options{Precedence: true, Optimize: true})
+			if strings.Count(reducedCode["Main"], "\n") > strings.Count(genericCode["Main"], "\n") {
+				t.Errorf("Reduced code of %s %s was larger than the generic code, got:\n%s", op, k, reducedCode["Main"])
+			}
+			generic := runProgramWithOS(t, program, Options{Precedence: true})
+			reduced := runProgramWithOS(t, program, Options{Precedence: true, Optimize: true})
+			for _, function := range []string{"Main.left", "Main.right"} {
+				for _, x := range xs {
+					if op == "/" && function == "Main.left" && x == 0 {
+						continue
+					}
+					want, err := generic.Call(function, x)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got, err := reduced.Call(function, x)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got != want {
+						t.Errorf("%s with %s %s and x = %d was incorrect, got: %d, wanted: %d", function, op, k, x, got, want)
+					}
+				}
+			}
+		}
+	}
+	code, _ := compileProgram([]string{fmt.Sprintf(source, "-1", "*")}, Options{Optimize: true})
+	if strings.Contains(code["Main"], "Math.multiply") {
+		t.Errorf("Multiplication by -1 was not reduced, got:\n%s", code["Main"])
+	}
+}
+
+// FuzzCompileClass checks that any source is compiled or rejected with errors without panicking,
+// and that the code of a class compiled without errors is valid VM code.
+func FuzzCompileClass(f *testing.F) {
+	for _, pattern := range []string{"../../10/*/*.jack", "../../11/*/*.jack", "../../12/*.jack", "../../12/*/*.jack"} {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, path := range paths {
+			source, err := os.ReadFile(path)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(string(source), uint8(0))
+		}
+	}
+	f.Add(mainProgram("int main()", "var int i, j, sum;", []string{"let sum = 0;", "for (i = 0; i < 3; i = i + 1) { switch (i) { case 1: continue; default: break; } }"}), uint8(0x0f))
+	f.Fuzz(func(t *testing.T, source string, flags uint8) {
+		options := Options{
+			Extended:   flags&1 != 0,
+			Optimize:   flags&2 != 0,
+			Precedence: flags&4 != 0,
+			Strict:     flags&8 != 0,
+			Debug:      flags&16 != 0,
+		}
+		var out bytes.Buffer
+		w := bufio.NewWriter(&out)
+		c := NewCompilationEngine(strings.NewReader(source), w, options)
+		c.CompileClass()
+		w.Flush()
+		if len(c.Errors()) > 0 {
+			return
+		}
+		if err := interpreter.New().Load("Main", &out); err != nil {
+			t.Fatalf("VM code of a compiled class was incorrect: %v", err)
+		}
+	})
+}
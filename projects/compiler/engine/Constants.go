@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"example.com/cache"
+	"example.com/tokenizer"
+	"example.com/writer"
+)
+
+// operand is the value of a term or expression while it is compiled. The code of a constant
+// operand is held back until the operand is used, so an operation on two constants can be
+// folded into one constant.
+type operand struct {
+	typ      string
+	constant bool
+	value    int16
+}
+
+// writeOperand writes the code of a constant operand, the code of any other operand has
+// already been written. It returns the type of the operand.
+func (c *compilationEngine) writeOperand(o operand) string {
+	if o.constant {
+		c.writeConstant(o.value)
+	}
+	return o.typ
+}
+
+// writeConstant pushes value, push constant only takes 0 to 32767.
+func (c *compilationEngine) writeConstant(value int16) {
+	switch {
+	case value >= 0:
+		c.output.WritePush(writer.Const, strconv.Itoa(int(value)))
+	case value == -32768:
+		c.output.WritePush(writer.Const, "32767")
+		c.output.WriteArithmetic(writer.Not)
+	default:
+		c.output.WritePush(writer.Const, strconv.Itoa(int(-value)))
+		c.output.WriteArithmetic(writer.Neg)
+	}
+}
+
+// folding reports whether constant subexpressions are evaluated at compile time, which is
+// always the case in a constant expression.
+func (c *compilationEngine) folding() bool {
+	return c.options.Optimize || c.count.folding
+}
+
+// fold evaluates left op right with the 16-bit arithmetic of the VM and the Jack OS.
+func fold(op string, left int16, right int16) (int16, error) {
+	switch op {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return left / right, nil
+	case "&":
+		return left & right, nil
+	case "|":
+		return left | right, nil
+	case "<":
+		return boolValue(left < right), nil
+	case ">":
+		return boolValue(left > right), nil
+	case "=":
+		return boolValue(left == right), nil
+	}
+	return 0, fmt.Errorf("operator %s cannot be folded", op)
+}
+
+func boolValue(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
+
+// compileConstantExpression compiles an expression that must be constant, the initializer of
+// a constant or a case label, and returns it. what names the expression for the error.
+func (c *compilationEngine) compileConstantExpression(what string) operand {
+	folding := c.count.folding
+	c.count.folding = true
+	o := c.compileExpressionOperand()
+	c.count.folding = folding
+	if !o.constant {
+		c.reportf("%s is not a constant expression", what)
+	}
+	return o
+}
+
+// compileConstDec compiles const type name = expression; which declares a class constant. A
+// constant takes no storage, every use of it is replaced by its value.
+func (c *compilationEngine) compileConstDec() {
+	c.advance()
+	symbolType := c.tokenValue()
+	c.advance()
+	name := c.tokenValue()
+	if c.tokenCategory() != tokenizer.Identifier {
+		panic(fmt.Errorf("expected the name of the constant, got %s", name))
+	}
+	c.count.subroutineName = name
+	c.advance()
+	c.compileTokenValue("=")
+	if !isPrimitiveType(symbolType) {
+		c.reportf("constant %s must be an int, char or boolean, not %s", name, symbolType)
+	}
+	var value operand
+	if constant, ok := c.indexedConstant(c.count.className, name); ok {
+		// the initializer was evaluated, and its errors reported, when the program was indexed
+		for c.tokenValue() != ";" && c.tokenCategory() != tokenizer.EOF {
+			c.advance()
+		}
+		value = constant
+	} else {
+		value = c.compileConstantExpression("initializer of " + name)
+		c.checkAssignable(symbolType, value.typ, "constant "+name)
+	}
+	c.compileTokenValue(";")
+	if _, ok := c.constants[name]; ok {
+		c.reportf("constant %s is declared more than once", name)
+	}
+	c.constants[name] = operand{symbolType, true, value.value}
+	c.count.subroutineName = ""
+}
+
+// classConstant looks up the constant className.name, declared earlier in this class or in any
+// class of the program.
+func (c *compilationEngine) classConstant(className string, name string) (operand, bool) {
+	if className == c.count.className {
+		if o, ok := c.constants[name]; ok {
+			return o, true
+		}
+	}
+	return c.indexedConstant(className, name)
+}
+
+func (c *compilationEngine) indexedConstant(className string, name string) (operand, bool) {
+	if c.options.Classes == nil {
+		return operand{}, false
+	}
+	constant, ok := c.options.Classes.Constant(className, name)
+	if !ok {
+		return operand{}, false
+	}
+	if !constant.Resolved && c.resolver != nil {
+		if cycle := c.resolver.resolve(className, constant); cycle {
+			c.reportf("constant %s.%s depends on itself", className, name)
+		}
+	}
+	return operand{constant.Type, true, constant.Value}, true
+}
+
+// constantResolver evaluates the initializers of the constants in a class index. A constant may
+// refer to constants of other classes, so they are evaluated on demand.
+type constantResolver struct {
+	index     *cache.ClassIndex
+	options   Options
+	resolving map[*cache.Constant]bool
+	errors    map[string][]error
+}
+
+// resolve evaluates constant, declared in className. It reports true if the constant is already
+// being evaluated, the initializer depends on itself.
+func (r *constantResolver) resolve(className string, constant *cache.Constant) (cycle bool) {
+	if constant.Resolved {
+		return false
+	}
+	if r.resolving[constant] {
+		return true
+	}
+	r.resolving[constant] = true
+	c := NewCompilationEngine(strings.NewReader(constant.Init), bufio.NewWriter(ioutil.Discard), r.options)
+	c.resolver = r
+	c.count.className = className
+	c.count.subroutineName = constant.Name
+	func() {
+		defer c.recoverGrammarError()
+		c.advance()
+		constant.Value = c.compileConstantExpression("initializer of " + constant.Name).value
+		if c.tokenCategory() != tokenizer.EOF {
+			panic(fmt.Errorf(`unexpected "%s" in the initializer of %s`, c.tokenValue(), constant.Name))
+		}
+	}()
+	delete(r.resolving, constant)
+	constant.Resolved = true
+	r.errors[className] = append(r.errors[className], c.Errors()...)
+	return false
+}
+
+// ResolveConstants evaluates the constants of every class in the index, which must be done
+// before any class that uses them is compiled. It returns the errors found in each class.
+func ResolveConstants(index *cache.ClassIndex, options Options) map[string][]error {
+	options.Classes = index
+	r := &constantResolver{index, options, make(map[*cache.Constant]bool), make(map[string][]error)}
+	for _, class := range index.Classes() {
+		for _, name := range sortedConstants(class) {
+			r.resolve(class.Name, class.Constants[name])
+		}
+	}
+	return r.errors
+}
+
+func sortedConstants(class *cache.Class) []string {
+	names := make([]string, 0, len(class.Constants))
+	for name := range class.Constants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"example.com/cache"
+	"example.com/tokenizer"
+)
+
+// ScanClass reads only the declarations of a class: its name and the signature of every
+// subroutine. Subroutine bodies are skipped, so it is cheap enough to run over a whole program
+// before any class is compiled. Only the language options are used.
+func ScanClass(reader io.Reader, options Options) (class *cache.Class, err error) {
+	s := &declarationScanner{scanner: tokenizer.NewModeScanner(reader, options.mode())}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+			if _, ok := r.(*tokenizer.Error); !ok {
+				err = fmt.Errorf("%s: %v", s.token.Pos, r)
+			}
+		}
+	}()
+
+	s.Advance()
+	s.expect("class")
+	class = cache.NewClass(s.value())
+	s.Advance()
+	s.expect("{")
+	for depth := 1; depth > 0; {
+		switch s.value() {
+		case "{":
+			depth++
+			s.Advance()
+		case "}":
+			depth--
+			if depth > 0 {
+				s.Advance()
+			}
+		case "constructor", "function", "method":
+			if depth == 1 {
+				if err := class.AddSubroutine(s.scanSubroutine()); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			s.Advance()
+		case "const":
+			if depth == 1 && s.token.Category == tokenizer.Keyword {
+				if err := class.AddConstant(s.scanConstant()); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			s.Advance()
+		default:
+			s.Advance()
+		}
+	}
+	return class, nil
+}
+
+type declarationScanner struct {
+	scanner *tokenizer.Scanner
+	token   tokenizer.Token
+}
+
+func (s *declarationScanner) value() string {
+	return s.token.Value
+}
+
+func (s *declarationScanner) Advance() {
+	s.token = s.scanner.Next()
+	if err := s.scanner.Err(); err != nil {
+		panic(err)
+	}
+	if s.token.Category == tokenizer.EOF {
+		panic(&tokenizer.Error{Pos: s.token.Pos, Msg: "unexpected end of file"})
+	}
+}
+
+func (s *declarationScanner) expect(value string) {
+	if s.value() != value {
+		panic(fmt.Errorf(`expected token to have value "%s", got "%s"`, value, s.value()))
+	}
+	s.Advance()
+}
+
+// scanSubroutine reads a subroutine signature up to and including the closing bracket of its
+// parameter list.
+func (s *declarationScanner) scanSubroutine() *cache.Subroutine {
+	kind, _ := cache.ParseSubroutineKind(s.value())
+	s.Advance()
+	sub := &cache.Subroutine{Kind: kind, ReturnType: s.value()}
+	s.Advance()
+	sub.Name = s.value()
+	s.Advance()
+	s.expect("(")
+	for s.value() != ")" {
+		paramType := s.value()
+		s.Advance()
+		sub.Params = append(sub.Params, cache.Param{Name: s.value(), Type: paramType})
+		s.Advance()
+		if s.value() == "," {
+			s.Advance()
+		}
+	}
+	s.Advance()
+	return sub
+}
+
+// scanConstant reads a constant declaration up to and including its semicolon. The initializer
+// is kept as source, it can only be evaluated once every class is indexed.
+func (s *declarationScanner) scanConstant() *cache.Constant {
+	s.Advance()
+	constant := &cache.Constant{Type: s.value()}
+	s.Advance()
+	constant.Name = s.value()
+	s.Advance()
+	s.expect("=")
+	var init []tokenizer.Token
+	for s.value() != ";" {
+		init = append(init, s.token)
+		s.Advance()
+	}
+	s.Advance()
+	constant.Init = layout(init)
+	return constant
+}
+
+// layout returns source text that puts every token at its original line and column.
+func layout(tokens []tokenizer.Token) string {
+	var b strings.Builder
+	pos := tokenizer.Pos{Line: 1, Column: 1}
+	for _, token := range tokens {
+		for ; pos.Line < token.Pos.Line; pos.Line++ {
+			b.WriteByte('\n')
+			pos.Column = 1
+		}
+		for ; pos.Column < token.Pos.Column; pos.Column++ {
+			b.WriteByte(' ')
+		}
+		text := token.Value
+		switch token.Category {
+		case tokenizer.StringConst:
+			text = `"` + text + `"`
+		case tokenizer.CharConst:
+			text = "'" + text + "'"
+		}
+		b.WriteString(text)
+		pos.Column += utf8.RuneCountInString(text)
+	}
+	return b.String()
+}
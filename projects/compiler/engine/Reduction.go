@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"strconv"
+
+	"example.com/writer"
+)
+
+// reducible reports whether x op k, or k op x when constantLeft is set, has a cheaper form than
+// the generic operation. Every form gives the same 16-bit result as the generic one.
+func reducible(op string, k int16, constantLeft bool) bool {
+	switch op {
+	case "*":
+		// unrolled, a multiplication runs faster than Math.multiply but it must not make the
+		// program larger, which has to fit the ROM
+		return k != -32768 && multiplySize(k) <= constantSize(k)+1
+	case "/":
+		return !constantLeft && (k == 1 || k == -1)
+	case "+", "-":
+		return k == 0
+	case "&", "|":
+		return k == 0 || k == -1
+	}
+	return false
+}
+
+// writeReduced writes the cheaper form of x op k, or k op x when constantLeft is set, where x
+// is the value on top of the stack. reducible must hold.
+func (c *compilationEngine) writeReduced(op string, k int16, constantLeft bool) {
+	switch op {
+	case "*":
+		c.writeMultiply(k)
+	case "/":
+		if k == -1 {
+			c.output.WriteArithmetic(writer.Neg)
+		}
+	case "-":
+		if constantLeft {
+			c.output.WriteArithmetic(writer.Neg)
+		}
+	case "&", "|":
+		// x & -1 and x | 0 are x, x & 0 and x | -1 do not depend on x
+		if op == "&" && k == 0 || op == "|" && k == -1 {
+			c.output.WritePop(writer.Temp, 0)
+			c.writeConstant(k)
+		}
+	}
+}
+
+// writeMultiply multiplies the value on top of the stack by k using additions. A power of two
+// doubles the value in place, temp 0 holding the copy to add. Other constants double a running
+// product and add the original value, kept in temp 2, for every set bit. Both temps are only
+// used within the sequence, temp 2 is not used by any other code so that a multiplication
+// cannot overwrite the value of a switch in temp 1.
+func (c *compilationEngine) writeMultiply(k int16) {
+	n := abs(k)
+	if n == 0 {
+		c.output.WritePop(writer.Temp, 0)
+		c.writeConstant(0)
+		return
+	}
+	if isPowerOfTwo(n) {
+		for ; n > 1; n /= 2 {
+			c.writeDouble()
+		}
+	} else {
+		c.output.WritePop(writer.Temp, 2)
+		c.output.WritePush(writer.Temp, strconv.Itoa(2))
+		bit := highestBit(n) / 2
+		for ; bit > 0; bit /= 2 {
+			c.writeDouble()
+			if n&bit != 0 {
+				c.output.WritePush(writer.Temp, strconv.Itoa(2))
+				c.output.WriteArithmetic(writer.Add)
+			}
+		}
+	}
+	if k < 0 {
+		c.output.WriteArithmetic(writer.Neg)
+	}
+}
+
+// multiplySize is the number of VM commands writeMultiply writes for k.
+func multiplySize(k int16) int {
+	n := abs(k)
+	if n == 0 {
+		return 2
+	}
+	size := 0
+	if isPowerOfTwo(n) {
+		for ; n > 1; n /= 2 {
+			size += 4
+		}
+	} else {
+		size = 2
+		for bit := highestBit(n) / 2; bit > 0; bit /= 2 {
+			size += 4
+			if n&bit != 0 {
+				size += 2
+			}
+		}
+	}
+	if k < 0 {
+		size++
+	}
+	return size
+}
+
+// constantSize is the number of VM commands writeConstant writes for k.
+func constantSize(k int16) int {
+	if k < 0 {
+		return 2
+	}
+	return 1
+}
+
+func (c *compilationEngine) writeDouble() {
+	c.output.WritePop(writer.Temp, 0)
+	c.output.WritePush(writer.Temp, strconv.Itoa(0))
+	c.output.WritePush(writer.Temp, strconv.Itoa(0))
+	c.output.WriteArithmetic(writer.Add)
+}
+
+func abs(k int16) int16 {
+	if k < 0 {
+		return -k
+	}
+	return k
+}
+
+func isPowerOfTwo(n int16) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+func highestBit(n int16) int16 {
+	bit := int16(1)
+	for n/2 >= bit {
+		bit *= 2
+	}
+	return bit
+}
@@ -0,0 +1,67 @@
+package engine
+
+import "fmt"
+
+// Warnings returns the type mismatches found in strict mode.
+func (c *compilationEngine) Warnings() []error {
+	return c.warnings
+}
+
+func (c *compilationEngine) warnf(format string, a ...interface{}) {
+	context := fmt.Sprintf("%s: warning: %s.%s: ", c.token.Pos, c.count.className, c.count.subroutineName)
+	c.warnings = append(c.warnings, fmt.Errorf(context+format, a...))
+}
+
+// checkAssignable warns in strict mode when a value of type actual is stored somewhere declared
+// as target. what describes the destination for the message.
+func (c *compilationEngine) checkAssignable(target string, actual string, what string) {
+	if !c.options.Strict || isAssignable(target, actual) {
+		return
+	}
+	c.warnf("cannot use %s as %s in %s", actual, target, what)
+}
+
+// isAssignable implements Jack's loose typing: int and char mix freely, null and Array stand in
+// for any object, and an Array may also hold a raw address. An empty type means the type could
+// not be inferred (an array element or an unknown call) and is always accepted.
+func isAssignable(target string, actual string) bool {
+	if target == "" || actual == "" || target == actual {
+		return true
+	}
+	if isNumericType(target) && isNumericType(actual) {
+		return true
+	}
+	if actual == "null" {
+		return !isPrimitiveType(target)
+	}
+	if target == "Array" {
+		return actual == "int" || !isPrimitiveType(actual)
+	}
+	if actual == "Array" {
+		return target == "int" || !isPrimitiveType(target)
+	}
+	return false
+}
+
+func isNumericType(symbolType string) bool {
+	return symbolType == "int" || symbolType == "char"
+}
+
+// operationType returns the type of left op right.
+func operationType(op string, left string, right string) string {
+	switch op {
+	case "<", ">", "=", "&&", "||":
+		return "boolean"
+	case "&", "|":
+		// bitwise on ints, logical on booleans
+		if left == "" && right == "" {
+			return ""
+		}
+		if (left == "boolean" || left == "") && (right == "boolean" || right == "") {
+			return "boolean"
+		}
+		return "int"
+	default:
+		return "int"
+	}
+}
@@ -1,15 +1,19 @@
 module engine
 
-go 1.13
+go 1.18
 
 require (
 	example.com/cache v0.0.0
 	example.com/tokenizer v0.0.0
 	example.com/writer v0.0.0
+	vm/interpreter v0.0.0
+	vm/parser v0.0.0
 )
 
 replace (
 	example.com/cache => ../cache
 	example.com/tokenizer => ../tokenizer
 	example.com/writer => ../writer
+	vm/interpreter => ../../vm/interpreter
+	vm/parser => ../../vm/parser
 )
@@ -0,0 +1,115 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around each change.
+const context = 3
+
+// edit is one line of a diff: ' ' kept, '-' removed or '+' added.
+type edit struct {
+	op   byte
+	line string
+}
+
+// lineDiff returns the edits turning a into b, from a longest common subsequence of lines.
+func lineDiff(a []string, b []string) []edit {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	return edits
+}
+
+// Diff returns the changes from before to after of the file at path as a unified diff.
+func Diff(path string, before string, after string) string {
+	edits := lineDiff(splitLines(before), splitLines(after))
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s (formatted)\n", path, path)
+	// line numbers of the next edit in before and after
+	aLine, bLine := 1, 1
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			aLine++
+			bLine++
+			start++
+			continue
+		}
+		// a hunk runs from context lines before the first change to context lines after the
+		// last change that is less than two contexts from the next one
+		first := start - context
+		if first < 0 {
+			first = 0
+		}
+		end := start
+		for k := start; k < len(edits) && k-end <= 2*context; k++ {
+			if edits[k].op != ' ' {
+				end = k
+			}
+		}
+		last := end + context + 1
+		if last > len(edits) {
+			last = len(edits)
+		}
+		aStart, bStart := aLine-(start-first), bLine-(start-first)
+		aCount, bCount := 0, 0
+		for _, e := range edits[first:last] {
+			if e.op != '+' {
+				aCount++
+			}
+			if e.op != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, e := range edits[first:last] {
+			fmt.Fprintf(&out, "%c%s\n", e.op, e.line)
+		}
+		aLine, bLine = aStart+aCount, bStart+bCount
+		start = last
+	}
+	return out.String()
+}
+
+// splitLines splits s into lines. A last line without a newline carries the marker of a
+// unified diff, so it differs from the same line with a newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if !strings.HasSuffix(s, "\n") {
+		lines[len(lines)-1] += "\n\\ No newline at end of file"
+	}
+	return lines
+}
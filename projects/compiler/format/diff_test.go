@@ -0,0 +1,28 @@
+package format
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	before := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm"
+	after := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	want := `--- X.jack
++++ X.jack (formatted)
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -10,4 +10,4 @@
+ j
+ k
+ l
+-m
+\ No newline at end of file
++m
+`
+	if got := Diff("X.jack", before, after); got != want {
+		t.Errorf("Diff was incorrect, got:\n%s\nwanted:\n%s", got, want)
+	}
+}
@@ -0,0 +1,240 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+
+	"example.com/tokenizer"
+)
+
+// indentUnit is one level of indentation, the four spaces of the course's Jack sources.
+const indentUnit = "    "
+
+// block is a { } block being printed, a switch block has a case body open once its first
+// case label is printed.
+type block struct {
+	caseOpen bool
+}
+
+// printer writes tokens and comments in the canonical style: one statement per line, the
+// opening brace on the line of its statement, single spaces around binary operators and after
+// commas, and at most one blank line kept from the source.
+type printer struct {
+	out    bytes.Buffer
+	indent int
+	blocks []block
+	parens int
+	// prev is the last token or comment printed, prevEnd the source line it ends on.
+	prev    tokenizer.Token
+	prevEnd int
+	// prevCode is the last token printed that is not a comment.
+	prevCode tokenizer.Token
+	started  bool
+	// unary is set when the last token printed is a unary minus.
+	unary bool
+	// newline is set when the next token or comment must start a new line.
+	newline bool
+	// opened is set while the current line ends with an opening brace.
+	opened bool
+}
+
+// Source formats Jack source. mode selects the language the source is written in, it must be
+// the mode it is compiled in for extended-Jack operators to be recognised. Only white space
+// changes, so the formatted source compiles to the same VM code.
+func Source(src []byte, mode tokenizer.Mode) ([]byte, error) {
+	s := tokenizer.NewModeScanner(bytes.NewReader(src), mode|tokenizer.Comments)
+	p := &printer{}
+	for token := s.Next(); token.Category != tokenizer.EOF; token = s.Next() {
+		if token.Category == tokenizer.Comment {
+			p.comment(token)
+		} else {
+			p.token(token)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if p.started {
+		p.out.WriteByte('\n')
+	}
+	return p.out.Bytes(), nil
+}
+
+func (p *printer) token(t tokenizer.Token) {
+	if p.prev.Category == tokenizer.Comment && t.Pos.Line > p.prevEnd {
+		p.newline = true
+	}
+	switch {
+	case t.Value == "else" && t.Category == tokenizer.Keyword && p.prev.Value == "}" && p.prev.Category == tokenizer.Symbol:
+		p.newline = false
+	case t.Value == "}" && t.Category == tokenizer.Symbol:
+		p.newline = true
+		if len(p.blocks) > 0 {
+			if p.blocks[len(p.blocks)-1].caseOpen {
+				p.indent--
+			}
+			p.blocks = p.blocks[:len(p.blocks)-1]
+		}
+		p.indent--
+	case p.isCaseLabel(t) && len(p.blocks) > 0 && p.blocks[len(p.blocks)-1].caseOpen:
+		p.newline = true
+		p.blocks[len(p.blocks)-1].caseOpen = false
+		p.indent--
+	}
+
+	if p.newline || !p.started {
+		p.startLine(t.Pos.Line, t.Value == "}")
+	} else if p.spaceBetween(t) {
+		p.out.WriteByte(' ')
+	}
+	p.out.WriteString(text(t))
+	p.unary = t.Value == "-" && t.Category == tokenizer.Symbol && !endsOperand(p.prevCode)
+	p.prev, p.prevCode, p.prevEnd = t, t, t.Pos.Line
+
+	if t.Category != tokenizer.Symbol {
+		return
+	}
+	switch t.Value {
+	case "(":
+		p.parens++
+	case ")":
+		p.parens--
+	case "{":
+		p.blocks = append(p.blocks, block{})
+		p.indent++
+		p.newline = true
+		p.opened = true
+	case "}":
+		p.newline = true
+	case ";":
+		// the clauses of a for loop stay on one line
+		p.newline = p.parens <= 0
+	case ":":
+		if len(p.blocks) > 0 {
+			p.blocks[len(p.blocks)-1].caseOpen = true
+			p.indent++
+		}
+		p.newline = true
+	}
+}
+
+func (p *printer) comment(c tokenizer.Token) {
+	trailing := p.started && c.Pos.Line == p.prevEnd
+	if trailing {
+		p.out.WriteByte(' ')
+	} else {
+		p.startLine(c.Pos.Line, false)
+	}
+	lines := strings.Split(c.Value, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if i > 0 {
+			p.out.WriteByte('\n')
+			// the lines of a doc comment are aligned on their stars
+			if trimmed := strings.TrimLeft(line, " \t"); strings.HasPrefix(trimmed, "*") {
+				line = p.indentation() + " " + trimmed
+			}
+		}
+		p.out.WriteString(line)
+	}
+	p.prev, p.prevEnd = c, c.Pos.Line+len(lines)-1
+	if strings.HasPrefix(c.Value, "//") {
+		p.newline = true
+	}
+}
+
+// startLine starts a new line for an element on source line line. One blank line of the source
+// is kept, except at the start or end of a block.
+func (p *printer) startLine(line int, closing bool) {
+	if p.started {
+		p.out.WriteByte('\n')
+		if line > p.prevEnd+1 && !closing && !p.opened {
+			p.out.WriteByte('\n')
+		}
+	}
+	p.opened = false
+	p.out.WriteString(p.indentation())
+	p.started = true
+	p.newline = false
+}
+
+// indentation returns the indentation of a new line, a line that continues a statement broken
+// by a comment is indented one level further.
+func (p *printer) indentation() string {
+	indent := p.indent
+	if p.prevCode.Value != "" && !p.endsStatement(p.prevCode) {
+		indent++
+	}
+	if indent < 0 {
+		indent = 0
+	}
+	return strings.Repeat(indentUnit, indent)
+}
+
+func (p *printer) endsStatement(t tokenizer.Token) bool {
+	if t.Category != tokenizer.Symbol {
+		return false
+	}
+	switch t.Value {
+	case ";":
+		return p.parens <= 0
+	case "{", "}", ":":
+		return true
+	}
+	return false
+}
+
+// endsOperand reports whether t can end an operand, a minus after it is a binary operator.
+func endsOperand(t tokenizer.Token) bool {
+	switch t.Category {
+	case tokenizer.IntConst, tokenizer.StringConst, tokenizer.CharConst, tokenizer.Identifier:
+		return true
+	case tokenizer.Keyword:
+		return t.IsKeywordConstant()
+	case tokenizer.Symbol:
+		return t.Value == ")" || t.Value == "]"
+	}
+	return false
+}
+
+func (p *printer) isCaseLabel(t tokenizer.Token) bool {
+	return t.Category == tokenizer.Keyword && (t.Value == "case" || t.Value == "default")
+}
+
+// spaceBetween reports whether a space separates the previous element from t on a line.
+func (p *printer) spaceBetween(t tokenizer.Token) bool {
+	prev := p.prev
+	if prev.Category == tokenizer.Comment {
+		return true
+	}
+	if t.Category == tokenizer.Symbol {
+		switch t.Value {
+		case ";", ",", ")", "]", ".", ":":
+			return false
+		case "(", "[":
+			if prev.Category == tokenizer.Identifier {
+				return false
+			}
+		}
+	}
+	if prev.Category == tokenizer.Symbol {
+		switch prev.Value {
+		case "(", "[", ".", "~":
+			return false
+		case "-":
+			return !p.unary
+		}
+	}
+	return true
+}
+
+// text returns the source text of a token.
+func text(t tokenizer.Token) string {
+	switch t.Category {
+	case tokenizer.StringConst:
+		return `"` + t.Value + `"`
+	case tokenizer.CharConst:
+		return "'" + t.Value + "'"
+	}
+	return t.Value
+}
@@ -0,0 +1,147 @@
+package format
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/tokenizer"
+)
+
+func TestSource(t *testing.T) {
+	sources := []struct {
+		source string
+		mode   tokenizer.Mode
+		want   string
+	}{
+		{
+			"class Main{field int x,y;\n\n\n  method void f(int a){let x=-a+(~y) - -1;do Output.printInt(x[2]);return;}}",
+			0,
+			`class Main {
+    field int x, y;
+
+    method void f(int a) {
+        let x = -a + (~y) - -1;
+        do Output.printInt(x[2]);
+        return;
+    }
+}
+`,
+		},
+		{
+			"// header\n/** Doc\n      * comment\n*/\nclass A { // trailing\n\n  function void f() { if (x) { return; }\n  else { return; } }\n}",
+			0,
+			`// header
+/** Doc
+ * comment
+ */
+class A { // trailing
+    function void f() {
+        if (x) {
+            return;
+        } else {
+            return;
+        }
+    }
+}
+`,
+		},
+		{
+			"class A { function void f() { let x = 1 + // one\n2; let y = /* two */ 2; } }",
+			0,
+			`class A {
+    function void f() {
+        let x = 1 + // one
+            2;
+        let y = /* two */ 2;
+    }
+}
+`,
+		},
+		{
+			"class A { function void f() { for (i=0;i<3;i=i+1) { switch (i) { case 1: case 2: let c='\\''; break; default: continue; } } if (a&&b) {} else if (c) {} } }",
+			tokenizer.Extended,
+			`class A {
+    function void f() {
+        for (i = 0; i < 3; i = i + 1) {
+            switch (i) {
+                case 1:
+                case 2:
+                    let c = '\'';
+                    break;
+                default:
+                    continue;
+            }
+        }
+        if (a && b) {
+        } else if (c) {
+        }
+    }
+}
+`,
+		},
+	}
+	for _, source := range sources {
+		got, err := Source([]byte(source.source), source.mode)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", source.source, err)
+			continue
+		}
+		if string(got) != source.want {
+			t.Errorf("Formatted source was incorrect, got:\n%s\nwanted:\n%s", got, source.want)
+		}
+		again, _ := Source(got, source.mode)
+		if !bytes.Equal(again, got) {
+			t.Errorf("Formatting was not idempotent, got:\n%s\nwanted:\n%s", again, got)
+		}
+	}
+}
+
+func tokens(t *testing.T, src []byte) []string {
+	s := tokenizer.NewModeScanner(bytes.NewReader(src), tokenizer.Comments)
+	var values []string
+	for token := s.Next(); token.Category != tokenizer.EOF; token = s.Next() {
+		value := token.Value
+		if token.Category == tokenizer.Comment {
+			// the lines of a comment may be indented differently
+			value = strings.Join(strings.Fields(value), " ")
+		}
+		values = append(values, token.Category.String()+" "+value)
+	}
+	if s.Err() != nil {
+		t.Fatal(s.Err())
+	}
+	return values
+}
+
+// TestSourcePrograms formats the Jack programs of the course. Only white space may change, the
+// tokens and comments are the same, and formatting again changes nothing.
+func TestSourcePrograms(t *testing.T) {
+	var paths []string
+	for _, pattern := range []string{"../../Snake/*.jack", "../../11/*/*.jack", "../../12/*/*.jack"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, matches...)
+	}
+	for _, path := range paths {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		formatted, err := Source(src, 0)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", path, err)
+			continue
+		}
+		if got, want := strings.Join(tokens(t, formatted), "\n"), strings.Join(tokens(t, src), "\n"); got != want {
+			t.Errorf("Tokens of %s were changed by formatting", path)
+		}
+		if again, _ := Source(formatted, 0); !bytes.Equal(again, formatted) {
+			t.Errorf("Formatting %s was not idempotent", path)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+module format
+
+go 1.13
+
+require example.com/tokenizer v0.0.0
+
+replace example.com/tokenizer => ../tokenizer
@@ -1,12 +1,14 @@
 module compiler
 
-go 1.13
+go 1.16
 
 require (
 	example.com/cache v0.0.0
 	example.com/engine v0.0.0
 	example.com/tokenizer v0.0.0
 	example.com/writer v0.0.0
+	vm/interpreter v0.0.0
+	vm/parser v0.0.0
 )
 
 replace (
@@ -14,4 +16,6 @@ replace (
 	example.com/engine => ./engine
 	example.com/tokenizer => ./tokenizer
 	example.com/writer => ./writer
+	vm/interpreter => ../vm/interpreter
+	vm/parser => ../vm/parser
 )
@@ -0,0 +1,397 @@
+package interp
+
+import (
+	"example.com/ast"
+	"example.com/tokenizer"
+)
+
+// flow is how a statement ends: by going on to the next one, or by a jump out of it.
+type flow uint8
+
+const (
+	next flow = iota
+	breakFlow
+	continueFlow
+	returnFlow
+)
+
+func (in *Interpreter) exec(stmts []ast.Stmt) flow {
+	for _, s := range stmts {
+		if f := in.stmt(s); f != next {
+			return f
+		}
+	}
+	return next
+}
+
+func (in *Interpreter) stmt(s ast.Stmt) flow {
+	in.frame.pos = s.Pos()
+	in.step()
+	switch s := s.(type) {
+	case *ast.LetStmt:
+		in.let(s)
+	case *ast.IfStmt:
+		if in.expr(s.Cond) != 0 {
+			return in.exec(s.Then)
+		}
+		return in.exec(s.Else)
+	case *ast.WhileStmt:
+		return in.loop(s.While, s.Cond, s.Body, nil)
+	case *ast.ForStmt:
+		if s.Init != nil {
+			in.let(s.Init)
+		}
+		return in.loop(s.For, s.Cond, s.Body, s.Step)
+	case *ast.SwitchStmt:
+		return in.switchStmt(s)
+	case *ast.BranchStmt:
+		if s.Keyword == "break" {
+			return breakFlow
+		}
+		return continueFlow
+	case *ast.DoStmt:
+		in.callExpr(s.Call)
+	case *ast.ReturnStmt:
+		if s.Value != nil {
+			in.frame.result = in.expr(s.Value)
+		}
+		return returnFlow
+	}
+	return next
+}
+
+// loop runs a while or for loop, a for loop without a condition runs until it is left.
+func (in *Interpreter) loop(pos tokenizer.Pos, cond ast.Expr, body []ast.Stmt, step *ast.LetStmt) flow {
+	for {
+		in.frame.pos = pos
+		in.step()
+		if cond != nil && in.expr(cond) == 0 {
+			return next
+		}
+		switch in.exec(body) {
+		case breakFlow:
+			return next
+		case returnFlow:
+			return returnFlow
+		}
+		if step != nil {
+			in.frame.pos = step.Let
+			in.step()
+			in.let(step)
+		}
+	}
+}
+
+// switchStmt runs the clause of the first case label equal to the value, or the default clause.
+// A clause does not fall through to the next, break leaves the switch and continue the loop
+// around it.
+func (in *Interpreter) switchStmt(s *ast.SwitchStmt) flow {
+	value := in.expr(s.Value)
+	for _, clause := range s.Cases {
+		match := len(clause.Values) == 0
+		for _, v := range clause.Values {
+			if in.constExpr(in.frame.class, v) == value {
+				match = true
+			}
+		}
+		if match {
+			if f := in.exec(clause.Body); f != breakFlow {
+				return f
+			}
+			return next
+		}
+	}
+	return next
+}
+
+func (in *Interpreter) let(s *ast.LetStmt) {
+	if s.Index != nil {
+		address := in.index(s.Name, s.Index)
+		value := in.expr(s.Value)
+		*in.mem(address) = value
+		return
+	}
+	value := in.expr(s.Value)
+	ref, _, ok := in.ref(s.Name)
+	if !ok {
+		in.fail(0, "%s is not a variable", s.Name.Name)
+	}
+	*ref = value
+}
+
+// ref returns where the variable name is kept and its type: a local variable or argument of
+// the frame, a field of this object or a static of the class.
+func (in *Interpreter) ref(ident *ast.Ident) (*int16, string, bool) {
+	f := in.frame
+	if v, ok := f.names[ident.Name]; ok {
+		return &f.values[v.index], v.typ, true
+	}
+	if v, ok := f.class.fields[ident.Name]; ok {
+		if f.sub.Kind == "function" {
+			in.fail(0, "field %s is used in a function", ident.Name)
+		}
+		return in.mem(int(f.this) + v.index), v.typ, true
+	}
+	if v, ok := f.class.statics[ident.Name]; ok {
+		return &f.class.values[v.index], v.typ, true
+	}
+	return nil, "", false
+}
+
+// mem returns the word of RAM at address.
+func (in *Interpreter) mem(address int) *int16 {
+	if address < 0 || address >= RAMSize {
+		in.fail(0, "address %d is outside the RAM", address)
+	}
+	return &in.RAM[address]
+}
+
+// index returns the address of name[index], with 16-bit arithmetic as the compiled code has.
+func (in *Interpreter) index(name *ast.Ident, index ast.Expr) int {
+	i := in.expr(index)
+	base := in.expr(name)
+	return int(base + i)
+}
+
+func (in *Interpreter) expr(e ast.Expr) int16 {
+	switch e := e.(type) {
+	case *ast.IntLit:
+		return int16(e.Value)
+	case *ast.StringLit:
+		return in.stringConstant(e.Value)
+	case *ast.CharLit:
+		return in.charConstant(e.Value)
+	case *ast.KeywordLit:
+		switch e.Value {
+		case "true":
+			return -1
+		case "this":
+			return in.frame.this
+		}
+		return 0
+	case *ast.Ident:
+		if ref, _, ok := in.ref(e); ok {
+			return *ref
+		}
+		if value, ok := in.constant(in.frame.class, e.Name); ok {
+			return value
+		}
+		in.fail(0, "%s is not defined", e.Name)
+	case *ast.IndexExpr:
+		return *in.mem(in.index(e.Name, e.Index))
+	case *ast.SelectorExpr:
+		return in.constExpr(in.frame.class, e)
+	case *ast.CallExpr:
+		return in.callExpr(e)
+	case *ast.UnaryExpr:
+		x := in.expr(e.X)
+		if e.Op == "-" {
+			return -x
+		}
+		return ^x
+	case *ast.BinaryExpr:
+		return in.binary(e)
+	case *ast.ParenExpr:
+		return in.expr(e.X)
+	}
+	return 0
+}
+
+// binary evaluates the operands left to right. Multiplication and division call the Math class
+// as the compiled code does, && and || only evaluate the right operand when the left one does
+// not decide the result.
+func (in *Interpreter) binary(e *ast.BinaryExpr) int16 {
+	switch e.Op {
+	case "&&":
+		if in.expr(e.X) == 0 {
+			return 0
+		}
+		return boolValue(in.expr(e.Y) != 0)
+	case "||":
+		if in.expr(e.X) != 0 {
+			return -1
+		}
+		return boolValue(in.expr(e.Y) != 0)
+	}
+	x, y := in.expr(e.X), in.expr(e.Y)
+	switch e.Op {
+	case "*":
+		in.frame.pos = e.OpPos
+		return in.call("Math", "multiply", []int16{x, y})
+	case "/":
+		in.frame.pos = e.OpPos
+		return in.call("Math", "divide", []int16{x, y})
+	}
+	return arithmetic(e.Op, x, y)
+}
+
+// arithmetic applies an operator that the VM implements itself.
+func arithmetic(op string, x int16, y int16) int16 {
+	switch op {
+	case "+":
+		return x + y
+	case "-":
+		return x - y
+	case "&":
+		return x & y
+	case "|":
+		return x | y
+	case "<":
+		return boolValue(x < y)
+	case ">":
+		return boolValue(x > y)
+	case "=":
+		return boolValue(x == y)
+	}
+	return 0
+}
+
+func boolValue(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
+
+// callExpr calls a subroutine. The receiver is a variable holding the object of a method, or
+// the class of a function or constructor; without one, a method is called on this.
+func (in *Interpreter) callExpr(e *ast.CallExpr) int16 {
+	f := in.frame
+	className, name := f.class.decl.Name.Name, e.Name.Name
+	var args []int16
+	f.pos = e.Pos()
+	if e.Receiver == nil {
+		sub, ok := f.class.subroutines[name]
+		if ok && sub.Kind == "method" {
+			if f.sub.Kind == "function" {
+				in.fail(0, "method %s is called from a function", name)
+			}
+			args = append(args, f.this)
+		}
+	} else if ref, typ, ok := in.ref(e.Receiver); ok {
+		className = typ
+		args = append(args, *ref)
+		if c, ok := in.classes[typ]; ok {
+			if sub, ok := c.subroutines[name]; ok && sub.Kind != "method" {
+				in.fail(0, "%s.%s is not a method", typ, name)
+			}
+		}
+	} else {
+		className = e.Receiver.Name
+		if c, ok := in.classes[className]; ok {
+			if sub, ok := c.subroutines[name]; ok && sub.Kind == "method" {
+				in.fail(0, "method %s.%s is called without an object", className, name)
+			}
+		}
+	}
+	for _, arg := range e.Args {
+		args = append(args, in.expr(arg))
+	}
+	f.pos = e.Pos()
+	return in.call(className, name, args)
+}
+
+// stringConstant builds a string constant with String.new and String.appendChar.
+func (in *Interpreter) stringConstant(value string) int16 {
+	codes := in.charCodes(value)
+	s := in.call("String", "new", []int16{int16(len(codes))})
+	for _, c := range codes {
+		s = in.call("String", "appendChar", []int16{s, int16(c)})
+	}
+	return s
+}
+
+func (in *Interpreter) charConstant(value string) int16 {
+	codes := in.charCodes(value)
+	if len(codes) != 1 {
+		in.fail(0, "character constant '%s' must hold exactly one character", value)
+	}
+	return int16(codes[0])
+}
+
+func (in *Interpreter) charCodes(value string) []int {
+	var mode tokenizer.Mode
+	if in.mode&ast.Extended != 0 {
+		mode = tokenizer.Extended
+	}
+	codes, err := tokenizer.CharCodes(value, mode)
+	if err != nil {
+		in.fail(0, "%v", err)
+	}
+	return codes
+}
+
+// constant returns the value of an extended-Jack constant of the class, evaluating its
+// initializer the first time.
+func (in *Interpreter) constant(c *class, name string) (int16, bool) {
+	if value, ok := c.resolved[name]; ok {
+		return value, true
+	}
+	dec, ok := c.constants[name]
+	if !ok {
+		return 0, false
+	}
+	if c.resolving[name] {
+		in.fail(0, "constant %s.%s depends on itself", c.decl.Name.Name, name)
+	}
+	c.resolving[name] = true
+	value := in.constExpr(c, dec.Value)
+	delete(c.resolving, name)
+	c.resolved[name] = value
+	return value, true
+}
+
+// constExpr evaluates a constant expression of the class, an initializer or a case label, with
+// the arithmetic the compiler folds them with.
+func (in *Interpreter) constExpr(c *class, e ast.Expr) int16 {
+	switch e := e.(type) {
+	case *ast.IntLit:
+		return int16(e.Value)
+	case *ast.CharLit:
+		return in.charConstant(e.Value)
+	case *ast.KeywordLit:
+		switch e.Value {
+		case "true":
+			return -1
+		case "false", "null":
+			return 0
+		}
+	case *ast.Ident:
+		if value, ok := in.constant(c, e.Name); ok {
+			return value
+		}
+	case *ast.SelectorExpr:
+		if other, ok := in.classes[e.X.Name]; ok {
+			if value, ok := in.constant(other, e.Sel.Name); ok {
+				return value
+			}
+		}
+		in.fail(0, "constant %s.%s is not defined", e.X.Name, e.Sel.Name)
+	case *ast.UnaryExpr:
+		x := in.constExpr(c, e.X)
+		if e.Op == "-" {
+			return -x
+		}
+		return ^x
+	case *ast.BinaryExpr:
+		x, y := in.constExpr(c, e.X), in.constExpr(c, e.Y)
+		switch e.Op {
+		case "&&":
+			return boolValue(x != 0 && y != 0)
+		case "||":
+			return boolValue(x != 0 || y != 0)
+		case "*":
+			return x * y
+		case "/":
+			if y == 0 {
+				in.fail(0, "division by zero")
+			}
+			return x / y
+		}
+		return arithmetic(e.Op, x, y)
+	case *ast.ParenExpr:
+		return in.constExpr(c, e.X)
+	}
+	in.fail(0, "not a constant expression")
+	return 0
+}
@@ -0,0 +1,15 @@
+module interp
+
+go 1.13
+
+require (
+	example.com/ast v0.0.0
+	example.com/cache v0.0.0
+	example.com/tokenizer v0.0.0
+)
+
+replace (
+	example.com/ast => ../ast
+	example.com/cache => ../cache
+	example.com/tokenizer => ../tokenizer
+)
@@ -0,0 +1,380 @@
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"example.com/ast"
+	"example.com/tokenizer"
+)
+
+// The Hack memory map the OS works in, the same as the one of a compiled program.
+const (
+	HeapBase = 2048
+	HeapEnd  = 16384
+	Screen   = 16384
+	Keyboard = 24576
+	RAMSize  = 32768
+)
+
+// maxDepth bounds the nesting of calls, a deeper program has run away with recursion.
+const maxDepth = 4096
+
+// Builtin implements a subroutine in Go, it receives the call's arguments, this first for a
+// method, and returns the subroutine's value.
+type Builtin func(in *Interpreter, args []int16) (int16, error)
+
+// Interpreter runs Jack classes from their syntax trees, without compiling them. Objects, arrays
+// and strings live in a Hack sized RAM managed by an OS written in Go, the variables of the
+// subroutines are kept outside of it.
+type Interpreter struct {
+	RAM []int16
+	// MaxSteps bounds the number of statements a single Run or Call may execute, 0 means no bound.
+	MaxSteps int
+	// Console, when set, receives the text printed through Output.
+	Console io.Writer
+	// Input supplies the keys read by Keyboard.readChar, readLine and readInt, a newline is the
+	// newline key.
+	Input io.Reader
+
+	mode     ast.Mode
+	classes  map[string]*class
+	builtins map[string]Builtin
+	frame    *frame
+	depth    int
+	steps    int
+	halted   bool
+	heap     heap
+	output   output
+	color    bool
+	keys     *bufio.Reader
+	keysFrom io.Reader
+}
+
+// class is a loaded class with its variables laid out. Fields are numbered as the compiler
+// numbers them, statics are held by the class.
+type class struct {
+	decl        *ast.Class
+	file        string
+	fields      map[string]variable
+	statics     map[string]variable
+	values      []int16
+	subroutines map[string]*ast.Subroutine
+	constants   map[string]*ast.ConstDec
+	resolved    map[string]int16
+	resolving   map[string]bool
+}
+
+type variable struct {
+	typ   string
+	index int
+}
+
+// frame is a call being executed. pos is the position of the statement or call being run, for
+// errors.
+type frame struct {
+	class  *class
+	sub    *ast.Subroutine
+	this   int16
+	names  map[string]variable
+	values []int16
+	result int16
+	pos    tokenizer.Pos
+	caller *frame
+}
+
+func (f *frame) define(name string, typ string, value int16) {
+	f.names[name] = variable{typ, len(f.values)}
+	f.values = append(f.values, value)
+}
+
+// Error is a runtime error of a Jack program: a fault of the interpreted code, a failure of the
+// OS such as a division by zero, or a call of Sys.error. Pos is the position of the statement
+// or call being executed in Function, Code is the error code the Jack OS gives the failure, 0
+// when it has none.
+type Error struct {
+	File     string
+	Pos      tokenizer.Pos
+	Function string
+	Code     int
+	Msg      string
+}
+
+func (e *Error) Error() string {
+	if e.Function == "" {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s:%s: %s: %s", e.File, e.Pos, e.Function, e.Msg)
+}
+
+// halt is the panic value of Sys.halt, it unwinds the calls of the program.
+type halt struct{}
+
+func New(mode ast.Mode) *Interpreter {
+	in := &Interpreter{
+		RAM:      make([]int16, RAMSize),
+		mode:     mode,
+		classes:  make(map[string]*class),
+		builtins: make(map[string]Builtin),
+	}
+	in.registerOS()
+	in.Reset()
+	return in
+}
+
+// Register installs a Go implementation of a subroutine, replacing the one of the OS. Subroutines
+// of loaded classes take precedence over builtins of the same name.
+func (in *Interpreter) Register(name string, fn Builtin) {
+	in.builtins[name] = fn
+}
+
+// Load parses a class read from r, file names it in errors.
+func (in *Interpreter) Load(file string, r io.Reader) error {
+	decl, err := ast.ParseClass(r, in.mode)
+	if err != nil {
+		return fmt.Errorf("%s:%v", file, err)
+	}
+	name := decl.Name.Name
+	if _, ok := in.classes[name]; ok {
+		return fmt.Errorf("%s: class %s is defined more than once", file, name)
+	}
+	c := &class{
+		decl:        decl,
+		file:        file,
+		fields:      make(map[string]variable),
+		statics:     make(map[string]variable),
+		subroutines: make(map[string]*ast.Subroutine),
+		constants:   make(map[string]*ast.ConstDec),
+		resolved:    make(map[string]int16),
+		resolving:   make(map[string]bool),
+	}
+	for _, dec := range decl.Vars {
+		for _, ident := range dec.Names {
+			if dec.Kind == "field" {
+				c.fields[ident.Name] = variable{dec.Type, len(c.fields)}
+			} else {
+				c.statics[ident.Name] = variable{dec.Type, len(c.values)}
+				c.values = append(c.values, 0)
+			}
+		}
+	}
+	for _, dec := range decl.Constants {
+		c.constants[dec.Name.Name] = dec
+	}
+	for _, sub := range decl.Subroutines {
+		if _, ok := c.subroutines[sub.Name.Name]; ok {
+			return fmt.Errorf("%s:%s: subroutine %s.%s is defined more than once", file, sub.Name.NamePos, name, sub.Name.Name)
+		}
+		c.subroutines[sub.Name.Name] = sub
+	}
+	in.classes[name] = c
+	return nil
+}
+
+// LoadFile loads a single .jack file.
+func (in *Interpreter) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return in.Load(path, file)
+}
+
+// LoadDir loads every .jack file of a folder.
+func (in *Interpreter) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jack"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := in.LoadFile(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset clears RAM and the static variables and initializes the OS, keeping the loaded classes.
+func (in *Interpreter) Reset() {
+	for i := range in.RAM {
+		in.RAM[i] = 0
+	}
+	for _, c := range in.classes {
+		for i := range c.values {
+			c.values[i] = 0
+		}
+	}
+	in.heap.reset()
+	in.output.reset()
+	in.color = true
+	in.halted = false
+	in.frame, in.depth = nil, 0
+}
+
+// Halted reports whether the program called Sys.halt or returned from its Run.
+func (in *Interpreter) Halted() bool {
+	return in.halted
+}
+
+// Run runs function, usually Main.main, as a program: the machine is reset first and the
+// program halts when the function returns, as under Sys.init.
+func (in *Interpreter) Run(function string) error {
+	in.Reset()
+	_, err := in.Call(function)
+	if err != nil && !in.halted {
+		return err
+	}
+	in.halted = true
+	return nil
+}
+
+// Call calls Class.function with the given arguments on the current state of the machine and
+// returns its result.
+func (in *Interpreter) Call(function string, args ...int16) (result int16, err error) {
+	dot := strings.Index(function, ".")
+	if dot < 0 {
+		return 0, fmt.Errorf("%s is not a Class.function name", function)
+	}
+	in.steps = 0
+	defer func() {
+		if r := recover(); r != nil {
+			in.frame, in.depth = nil, 0
+			switch e := r.(type) {
+			case *Error:
+				err = e
+			case halt:
+				in.halted = true
+				err = fmt.Errorf("%s halted before returning", function)
+			default:
+				panic(r)
+			}
+		}
+	}()
+	return in.call(function[:dot], function[dot+1:], args), nil
+}
+
+// fail stops the program with an error at the position being executed.
+func (in *Interpreter) fail(code int, format string, a ...interface{}) {
+	e := &Error{Code: code, Msg: fmt.Sprintf(format, a...)}
+	if f := in.frame; f != nil {
+		e.File, e.Pos = f.class.file, f.pos
+		e.Function = f.class.decl.Name.Name + "." + f.sub.Name.Name
+	}
+	panic(e)
+}
+
+func (in *Interpreter) step() {
+	in.steps++
+	if in.MaxSteps > 0 && in.steps > in.MaxSteps {
+		in.fail(0, "stopped after %d steps", in.MaxSteps)
+	}
+}
+
+// call runs a subroutine of a loaded class or a builtin of the same name.
+func (in *Interpreter) call(className string, name string, args []int16) int16 {
+	if c, ok := in.classes[className]; ok {
+		if sub, ok := c.subroutines[name]; ok {
+			return in.invoke(c, sub, args)
+		}
+	}
+	builtin, ok := in.builtins[className+"."+name]
+	if !ok {
+		in.fail(0, "subroutine %s.%s is not defined", className, name)
+	}
+	result, err := builtin(in, args)
+	if err != nil {
+		in.fail(0, "%s.%s: %v", className, name, err)
+	}
+	return result
+}
+
+// invoke runs a subroutine of a loaded class in a new frame. A constructor allocates its object
+// with Memory.alloc as the compiled code does.
+func (in *Interpreter) invoke(c *class, sub *ast.Subroutine, args []int16) int16 {
+	params := len(sub.Params)
+	if sub.Kind == "method" {
+		params++
+	}
+	if len(args) != params {
+		in.fail(0, "%s.%s takes %d arguments, got %d", c.decl.Name.Name, sub.Name.Name, params, len(args))
+	}
+	if in.depth >= maxDepth {
+		in.fail(0, "stack overflow")
+	}
+	f := &frame{class: c, sub: sub, names: make(map[string]variable), pos: sub.KindPos, caller: in.frame}
+	if sub.Kind == "method" {
+		f.this, args = args[0], args[1:]
+	}
+	for i, param := range sub.Params {
+		f.define(param.Name.Name, param.Type, args[i])
+	}
+	for _, dec := range sub.Locals {
+		for _, ident := range dec.Names {
+			f.define(ident.Name, dec.Type, 0)
+		}
+	}
+	in.frame = f
+	in.depth++
+	if sub.Kind == "constructor" {
+		f.this = in.call("Memory", "alloc", []int16{int16(len(c.fields))})
+	}
+	in.exec(sub.Body)
+	in.frame = f.caller
+	in.depth--
+	return f.result
+}
+
+// Tests returns the tests of the loaded classes sorted by name: the functions whose name starts
+// with Test of the classes whose name ends with Test, the classes of files named *Test.jack.
+func (in *Interpreter) Tests() []string {
+	var tests []string
+	for name, c := range in.classes {
+		if !strings.HasSuffix(name, "Test") {
+			continue
+		}
+		for _, sub := range c.decl.Subroutines {
+			if strings.HasPrefix(sub.Name.Name, "Test") {
+				tests = append(tests, name+"."+sub.Name.Name)
+			}
+		}
+	}
+	sort.Strings(tests)
+	return tests
+}
+
+// RunTest runs a test on a reset machine. A test is a function without parameters, it passes
+// when it returns and, if it returns a boolean, returns true. It fails on a runtime error, a
+// call of Sys.error or Sys.halt.
+func (in *Interpreter) RunTest(test string) error {
+	dot := strings.Index(test, ".")
+	if dot < 0 {
+		return fmt.Errorf("%s is not a Class.function name", test)
+	}
+	c, ok := in.classes[test[:dot]]
+	if !ok {
+		return fmt.Errorf("class %s is not loaded", test[:dot])
+	}
+	sub, ok := c.subroutines[test[dot+1:]]
+	if !ok {
+		return fmt.Errorf("%s is not defined", test)
+	}
+	if sub.Kind != "function" || len(sub.Params) > 0 {
+		return fmt.Errorf("%s:%s: %s must be a function without parameters", c.file, sub.KindPos, test)
+	}
+	in.Reset()
+	result, err := in.Call(test)
+	if err != nil {
+		return err
+	}
+	if sub.ReturnType == "boolean" && result == 0 {
+		return fmt.Errorf("%s returned false", test)
+	}
+	return nil
+}
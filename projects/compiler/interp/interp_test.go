@@ -0,0 +1,298 @@
+package interp
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/ast"
+)
+
+func load(t *testing.T, mode ast.Mode, sources ...string) *Interpreter {
+	t.Helper()
+	in := New(mode)
+	for _, source := range sources {
+		name := strings.Fields(source)[1]
+		if err := in.Load(name+".jack", strings.NewReader(source)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return in
+}
+
+const point = `class Point {
+	field int x, y;
+	static int count;
+
+	constructor Point new(int ax, int ay) {
+		let x = ax;
+		let y = ay;
+		let count = count + 1;
+		return this;
+	}
+
+	method int getX() { return x; }
+
+	method Point plus(Point other) {
+		return Point.new(x + other.getX(), y + other.getY());
+	}
+
+	method int getY() { return y; }
+
+	function int count() { return count; }
+}`
+
+func TestCall(t *testing.T) {
+	functions := []struct {
+		function string
+		want     int16
+	}{
+		{"function int f() { return 32767 + 1; }", -32768},
+		{"function int f() { return 300 * 300; }", 24464},
+		{"function int f() { return -7 / 2; }", -3},
+		{"function int f() { return 2 + 3 * 4; }", 20},
+		{"function int f() { return ~5 & 7; }", 2},
+		{"function boolean f() { return (1 < 2) & (3 > 2); }", -1},
+		{"function int f() { return Main.fib(15); } function int fib(int n) { if (n < 2) { return n; } return Main.fib(n - 1) + Main.fib(n - 2); }", 610},
+		{"function int f() { var int i, sum; while (i < 10) { let i = i + 1; let sum = sum + i; } return sum; }", 55},
+		{"function int f() { var Array a; let a = Array.new(3); let a[0] = 4; let a[a[0] - 2] = 5; return a[0] + a[2]; }", 9},
+		{"function int f() { var Point p; let p = Point.new(1, 2); let p = p.plus(Point.new(3, 4)); return p.getX() * 10 + p.getY(); }", 46},
+		{"function int f() { do Point.new(1, 2); do Point.new(1, 2); return Point.count(); }", 2},
+		{`function int f() { var String s; let s = "-123x"; return s.intValue() + s.length(); }`, -118},
+		{`function int f() { var String s; let s = String.new(6); do s.setInt(-450); return s.charAt(0) + s.length(); }`, '-' + 4},
+		{"function int f() { return Math.sqrt(32767) + Math.max(-3, Math.min(4, 9)) + Math.abs(-2); }", 187},
+		{"function int f() { return Memory.peek(8000); }", 0},
+	}
+	for _, f := range functions {
+		in := load(t, 0, "class Main { "+f.function+" }", point)
+		got, err := in.Call("Main.f")
+		if err != nil {
+			t.Errorf("%s failed: %v", f.function, err)
+			continue
+		}
+		if got != f.want {
+			t.Errorf("Result of %s was incorrect, got: %d, wanted: %d", f.function, got, f.want)
+		}
+	}
+}
+
+func TestExtended(t *testing.T) {
+	functions := []struct {
+		function string
+		want     int16
+	}{
+		{"function int f() { var int i, sum; for (i = 0; i < 10; i = i + 1) { if (i = 3) { continue; } if (i = 6) { break; } let sum = sum + i; } return sum; }", 12},
+		{"function int f() { var int i, sum; for (i = 0; i < 4; i = i + 1) { switch (i) { case 0: case 1: let sum = sum + 1; case 2: break; default: let sum = sum + N; } } return sum; }", 102},
+		{"function boolean f() { var Array a; return (a = null) || (a[0] = 1); }", -1},
+		{"function boolean f() { return (1 = 1) && 5; }", -1},
+		{"function int f() { return N + Other.M; }", 500},
+		{`function char f() { return '\n'; }`, 128},
+	}
+	for _, f := range functions {
+		in := load(t, ast.Extended, "class Main { const int N = 100; "+f.function+" }", "class Other { const int M = Main.N * 4; }")
+		got, err := in.Call("Main.f")
+		if err != nil {
+			t.Errorf("%s failed: %v", f.function, err)
+			continue
+		}
+		if got != f.want {
+			t.Errorf("Result of %s was incorrect, got: %d, wanted: %d", f.function, got, f.want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	functions := []struct {
+		function string
+		err      string
+		code     int
+	}{
+		{"function int f() {\n\tvar int i;\n\treturn 1 / i;\n}", "Main.jack:3:11: Main.f: Math.divide: division by zero (ERR3)", 3},
+		{"function void f() {\n\tdo Sys.error(42);\n\treturn;\n}", "Main.jack:2:5: Main.f: Sys.error (ERR42)", 42},
+		{"function void f() {\n\tdo Main.g();\n\treturn;\n}", "Main.jack:2:5: Main.f: subroutine Main.g is not defined", 0},
+		{"function void f() {\n\tdo Point.getX();\n\treturn;\n}", "Main.jack:2:5: Main.f: method Point.getX is called without an object", 0},
+		{"function void f() {\n\tdo Point.new(1);\n\treturn;\n}", "Main.jack:2:5: Main.f: Point.new takes 2 arguments, got 1", 0},
+		{"function void f() {\n\tdo Main.f();\n\treturn;\n}", "Main.jack:2:5: Main.f: stack overflow", 0},
+		{"function void f() {\n\twhile (true) {}\n\treturn;\n}", "Main.jack:2:2: Main.f: stopped after 10000 steps", 0},
+		{"function void f() {\n\tvar String s;\n\tlet s = \"ab\";\n\tdo s.appendChar(99);\n\treturn;\n}", "Main.jack:4:5: Main.f: String.appendChar: string is full (ERR17)", 17},
+		{"function void f() {\n\tvar Array a;\n\tlet a = -1;\n\tlet a[0] = 1;\n\treturn;\n}", "Main.jack:4:2: Main.f: address -1 is outside the RAM", 0},
+	}
+	for _, f := range functions {
+		in := load(t, 0, "class Main {\n"+f.function+"\n}", point)
+		in.MaxSteps = 10000
+		_, err := in.Call("Main.f")
+		if err == nil {
+			t.Errorf("%s did not fail", f.function)
+			continue
+		}
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("Error of %s was incorrect, got: %T, wanted: *Error", f.function, err)
+			continue
+		}
+		// the function is moved down a line by the class declaration
+		e.Pos.Line--
+		if e.Error() != f.err || e.Code != f.code {
+			t.Errorf("Error of %s was incorrect, got: %s (%d), wanted: %s (%d)", f.function, e, e.Code, f.err, f.code)
+		}
+	}
+}
+
+func TestOutput(t *testing.T) {
+	in := load(t, 0, `class Main {
+	function void main() {
+		var int n;
+		let n = Keyboard.readInt("n? ");
+		do Output.printString("n*n=");
+		do Output.printInt(n * n);
+		do Output.println();
+		do Output.printInt(-32767 - 1);
+		do Sys.error(7);
+		return;
+	}
+}`)
+	var console strings.Builder
+	in.Console = &console
+	in.Input = strings.NewReader("1\b12\n")
+	err := in.Run("Main.main")
+	if err == nil || !strings.HasSuffix(err.Error(), "Sys.error (ERR7)") {
+		t.Errorf("Error was incorrect, got: %v, wanted: Sys.error (ERR7)", err)
+	}
+	want := "n? 112\nn*n=144\n-ERR7"
+	if console.String() != want {
+		t.Errorf("Console was incorrect, got: %q, wanted: %q", console.String(), want)
+	}
+	// the first character, n, is on the left of the first word of the second line of pixels
+	for row := 0; row < 11; row++ {
+		got := in.RAM[Screen+32+row*32] & 0xff
+		if got != font['n'][row] {
+			t.Errorf("Row %d of n was incorrect, got: %d, wanted: %d", row, got, font['n'][row])
+		}
+	}
+}
+
+func TestScreen(t *testing.T) {
+	calls := []struct {
+		statements string
+		words      map[int]int16
+	}{
+		{"do Screen.drawPixel(17, 1);", map[int]int16{33: 2}},
+		{"do Screen.drawRectangle(14, 0, 17, 1);", map[int]int16{0: -16384, 1: 3, 32: -16384, 33: 3}},
+		{"do Screen.drawLine(0, 0, 3, 1);", map[int]int16{0: 3, 32: 12}},
+		{"do Screen.drawLine(3, 1, 0, 0);", map[int]int16{0: 3, 32: 12}},
+		{"do Screen.drawCircle(1, 1, 1);", map[int]int16{0: 2, 32: 7, 64: 2}},
+		{"do Screen.drawRectangle(0, 0, 15, 0); do Screen.setColor(false); do Screen.drawPixel(0, 0);", map[int]int16{0: -2}},
+	}
+	for _, c := range calls {
+		in := load(t, 0, "class Main { function void f() { "+c.statements+" return; } }")
+		if _, err := in.Call("Main.f"); err != nil {
+			t.Errorf("%s failed: %v", c.statements, err)
+			continue
+		}
+		got := make(map[int]int16)
+		for i := Screen; i < Keyboard; i++ {
+			if in.RAM[i] != 0 {
+				got[i-Screen] = in.RAM[i]
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(c.words) {
+			t.Errorf("Screen of %s was incorrect, got: %v, wanted: %v", c.statements, got, c.words)
+		}
+	}
+}
+
+func TestTests(t *testing.T) {
+	in := load(t, 0, point, `class PointTest {
+	function void TestNew() {
+		var Point p;
+		let p = Point.new(3, 4);
+		if (~(p.getX() = 3)) {
+			do Sys.error(1);
+		}
+		return;
+	}
+
+	function boolean TestCount() {
+		do Point.new(0, 0);
+		return Point.count() = 1;
+	}
+
+	function boolean TestFalse() {
+		return false;
+	}
+
+	function void TestArgument(int i) {
+		return;
+	}
+
+	function void helper() {
+		return;
+	}
+}`)
+	var got []string
+	for _, test := range in.Tests() {
+		result := "pass"
+		if err := in.RunTest(test); err != nil {
+			result = err.Error()
+		}
+		got = append(got, test+": "+result)
+	}
+	want := []string{
+		"PointTest.TestArgument: PointTest.jack:20:2: PointTest.TestArgument must be a function without parameters",
+		"PointTest.TestCount: pass",
+		"PointTest.TestFalse: PointTest.TestFalse returned false",
+		"PointTest.TestNew: pass",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Tests were incorrect, got: %q, wanted: %q", got, want)
+	}
+}
+
+func TestPrograms(t *testing.T) {
+	programs := []struct {
+		name    string
+		input   string
+		console string
+	}{
+		{"Seven", "", "7"},
+		{"Average", "3\n10\n20\n33\n", "How many numbers? 3\nEnter a number: 10\nEnter a number: 20\nEnter a number: 33\nThe average is 21"},
+		{"ComplexArrays", "", "Test 1: expected result: 5; actual result: 5\nTest 2: expected result: 40; actual result: 40\nTest 3: expected result: 0; actual result: 0\nTest 4: expected result: 77; actual result: 77\nTest 5: expected result: 110; actual result: 110\n"},
+	}
+	for _, p := range programs {
+		in := New(0)
+		if err := in.LoadDir(filepath.Join("..", "..", "11", p.name)); err != nil {
+			t.Fatal(err)
+		}
+		var console strings.Builder
+		in.Console = &console
+		in.Input = strings.NewReader(p.input)
+		if err := in.Run("Main.main"); err != nil {
+			t.Errorf("%s failed: %v", p.name, err)
+			continue
+		}
+		if !in.Halted() {
+			t.Errorf("%s did not halt", p.name)
+		}
+		if console.String() != p.console {
+			t.Errorf("Console of %s was incorrect, got: %q, wanted: %q", p.name, console.String(), p.console)
+		}
+	}
+
+	in := New(0)
+	if err := in.LoadDir(filepath.Join("..", "..", "11", "ConvertToBin")); err != nil {
+		t.Fatal(err)
+	}
+	in.RAM[8000] = 0x5aa5
+	if _, err := in.Call("Main.main"); err != nil {
+		t.Fatal(err)
+	}
+	var bits []int16
+	for i := 8001; i <= 8016; i++ {
+		bits = append(bits, in.RAM[i])
+	}
+	want := "[1 0 1 0 0 1 0 1 0 1 0 1 1 0 1 0]"
+	if fmt.Sprint(bits) != want {
+		t.Errorf("Bits of ConvertToBin were incorrect, got: %v, wanted: %s", bits, want)
+	}
+}
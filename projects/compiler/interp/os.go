@@ -0,0 +1,705 @@
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// registerOS installs the Jack OS. The subroutines check their arguments and report failures with
+// the error codes of the Jack OS, which also prints them on the screen, and draw the screen and
+// text as it does, so a program leaves the same picture as when compiled.
+func (in *Interpreter) registerOS() {
+	in.registerMath()
+	in.registerMemory()
+	in.registerString()
+	in.registerOutput()
+	in.registerScreen()
+	in.registerKeyboard()
+	in.registerSys()
+}
+
+// os registers a subroutine of the OS that takes arity arguments.
+func (in *Interpreter) os(name string, arity int, fn func(args []int16) int16) {
+	in.Register(name, func(in *Interpreter, args []int16) (int16, error) {
+		if len(args) != arity {
+			return 0, fmt.Errorf("takes %d arguments, got %d", arity, len(args))
+		}
+		return fn(args), nil
+	})
+}
+
+// sysError stops the program as Sys.error does: the code is printed as ERR<code> and the
+// machine halts.
+func (in *Interpreter) sysError(code int16, failure string) {
+	in.printChar('E')
+	in.printChar('R')
+	in.printChar('R')
+	in.printInt(code)
+	in.fail(int(code), "%s (ERR%d)", failure, code)
+}
+
+func (in *Interpreter) registerMath() {
+	in.os("Math.init", 0, func(args []int16) int16 { return 0 })
+	in.os("Math.abs", 1, func(args []int16) int16 {
+		if args[0] < 0 {
+			return -args[0]
+		}
+		return args[0]
+	})
+	in.os("Math.multiply", 2, func(args []int16) int16 {
+		return args[0] * args[1]
+	})
+	in.os("Math.divide", 2, func(args []int16) int16 {
+		if args[1] == 0 {
+			in.sysError(3, "Math.divide: division by zero")
+		}
+		return args[0] / args[1]
+	})
+	in.os("Math.sqrt", 1, func(args []int16) int16 {
+		if args[0] < 0 {
+			in.sysError(4, "Math.sqrt: square root of a negative number")
+		}
+		var root int16
+		for (root+1)*(root+1) <= args[0] && root < 181 {
+			root++
+		}
+		return root
+	})
+	in.os("Math.min", 2, func(args []int16) int16 {
+		if args[0] < args[1] {
+			return args[0]
+		}
+		return args[1]
+	})
+	in.os("Math.max", 2, func(args []int16) int16 {
+		if args[0] > args[1] {
+			return args[0]
+		}
+		return args[1]
+	})
+}
+
+// heap hands out the blocks of the heap first fit from a list of free blocks kept in address
+// order, and remembers the size of each block given out so it can be given back.
+type heap struct {
+	free []block
+	used map[int]int
+}
+
+type block struct {
+	address int
+	size    int
+}
+
+func (h *heap) reset() {
+	h.free = []block{{HeapBase, HeapEnd - HeapBase}}
+	h.used = make(map[int]int)
+}
+
+func (h *heap) alloc(size int) (int, bool) {
+	for i, b := range h.free {
+		if b.size < size {
+			continue
+		}
+		if b.size == size {
+			h.free = append(h.free[:i], h.free[i+1:]...)
+		} else {
+			h.free[i] = block{b.address + size, b.size - size}
+		}
+		h.used[b.address] = size
+		return b.address, true
+	}
+	return 0, false
+}
+
+// dispose returns a block to the free list, joining it with the free blocks next to it.
+func (h *heap) dispose(address int) bool {
+	size, ok := h.used[address]
+	if !ok {
+		return false
+	}
+	delete(h.used, address)
+	i := 0
+	for i < len(h.free) && h.free[i].address < address {
+		i++
+	}
+	h.free = append(h.free, block{})
+	copy(h.free[i+1:], h.free[i:])
+	h.free[i] = block{address, size}
+	if i+1 < len(h.free) && address+size == h.free[i+1].address {
+		h.free[i].size += h.free[i+1].size
+		h.free = append(h.free[:i+1], h.free[i+2:]...)
+	}
+	if i > 0 && h.free[i-1].address+h.free[i-1].size == address {
+		h.free[i-1].size += h.free[i].size
+		h.free = append(h.free[:i], h.free[i+1:]...)
+	}
+	return true
+}
+
+func (in *Interpreter) registerMemory() {
+	in.os("Memory.init", 0, func(args []int16) int16 {
+		in.heap.reset()
+		return 0
+	})
+	in.os("Memory.peek", 1, func(args []int16) int16 {
+		return *in.mem(int(args[0]))
+	})
+	in.os("Memory.poke", 2, func(args []int16) int16 {
+		*in.mem(int(args[0])) = args[1]
+		return 0
+	})
+	in.os("Memory.alloc", 1, func(args []int16) int16 {
+		return in.alloc(args[0], 5, "Memory.alloc")
+	})
+	in.os("Memory.deAlloc", 1, func(args []int16) int16 {
+		in.dispose(args[0], "Memory.deAlloc")
+		return 0
+	})
+	in.os("Array.new", 1, func(args []int16) int16 {
+		return in.alloc(args[0], 2, "Array.new")
+	})
+	in.os("Array.dispose", 1, func(args []int16) int16 {
+		in.dispose(args[0], "Array.dispose")
+		return 0
+	})
+}
+
+// alloc allocates a block of the heap, code is the error of a size that is not positive.
+func (in *Interpreter) alloc(size int16, code int16, function string) int16 {
+	if size < 1 {
+		in.sysError(code, fmt.Sprintf("%s: size %d is not positive", function, size))
+	}
+	address, ok := in.heap.alloc(int(size))
+	if !ok {
+		in.sysError(6, fmt.Sprintf("%s: heap overflow", function))
+	}
+	return int16(address)
+}
+
+func (in *Interpreter) dispose(address int16, function string) {
+	if !in.heap.dispose(int(address)) {
+		in.fail(0, "%s: %d is not an allocated block", function, address)
+	}
+}
+
+// A string is a block of the heap holding its capacity, its length and then its characters.
+const (
+	stringCapacity = 0
+	stringLength   = 1
+	stringChars    = 2
+)
+
+func (in *Interpreter) registerString() {
+	in.os("String.new", 1, func(args []int16) int16 {
+		if args[0] < 0 {
+			in.sysError(14, "String.new: maximum length is negative")
+		}
+		s := in.alloc(args[0]+stringChars, 14, "String.new")
+		*in.mem(int(s) + stringCapacity) = args[0]
+		*in.mem(int(s) + stringLength) = 0
+		return s
+	})
+	in.os("String.dispose", 1, func(args []int16) int16 {
+		in.dispose(args[0], "String.dispose")
+		return 0
+	})
+	in.os("String.length", 1, func(args []int16) int16 {
+		return *in.mem(int(args[0]) + stringLength)
+	})
+	in.os("String.charAt", 2, func(args []int16) int16 {
+		return *in.stringChar(args[0], args[1], 15, "String.charAt")
+	})
+	in.os("String.setCharAt", 3, func(args []int16) int16 {
+		*in.stringChar(args[0], args[1], 16, "String.setCharAt") = args[2]
+		return 0
+	})
+	in.os("String.appendChar", 2, func(args []int16) int16 {
+		s := int(args[0])
+		length := in.mem(s + stringLength)
+		if *length == *in.mem(s + stringCapacity) {
+			in.sysError(17, "String.appendChar: string is full")
+		}
+		*in.mem(s + stringChars + int(*length)) = args[1]
+		*length++
+		return args[0]
+	})
+	in.os("String.eraseLastChar", 1, func(args []int16) int16 {
+		length := in.mem(int(args[0]) + stringLength)
+		if *length == 0 {
+			in.sysError(18, "String.eraseLastChar: string is empty")
+		}
+		*length--
+		return 0
+	})
+	in.os("String.intValue", 1, func(args []int16) int16 {
+		s := int(args[0])
+		length := int(*in.mem(s + stringLength))
+		i, negative := 0, false
+		if length > 0 && *in.mem(s + stringChars) == '-' {
+			i, negative = 1, true
+		}
+		var value int16
+		for ; i < length; i++ {
+			digit := *in.mem(s + stringChars + i) - '0'
+			if digit < 0 || digit > 9 {
+				break
+			}
+			value = value*10 + digit
+		}
+		if negative {
+			return -value
+		}
+		return value
+	})
+	in.os("String.setInt", 2, func(args []int16) int16 {
+		s := int(args[0])
+		chars := intChars(args[1])
+		if capacity := *in.mem(s + stringCapacity); capacity == 0 || int(capacity) < len(chars) {
+			in.sysError(19, "String.setInt: string is too short")
+		}
+		for i, c := range chars {
+			*in.mem(s + stringChars + i) = c
+		}
+		*in.mem(s + stringLength) = int16(len(chars))
+		return 0
+	})
+	in.os("String.newLine", 0, func(args []int16) int16 { return 128 })
+	in.os("String.backSpace", 0, func(args []int16) int16 { return 129 })
+	in.os("String.doubleQuote", 0, func(args []int16) int16 { return '"' })
+}
+
+// stringChar returns the character at index of a string, code is the error of an index outside
+// the string.
+func (in *Interpreter) stringChar(s int16, index int16, code int16, function string) *int16 {
+	if index < 0 || index >= *in.mem(int(s) + stringLength) {
+		in.sysError(code, fmt.Sprintf("%s: index %d is outside the string", function, index))
+	}
+	return in.mem(int(s) + stringChars + int(index))
+}
+
+// intChars returns the decimal characters of n as String.setInt of the Jack OS writes them, which
+// writes -32768 as a lone minus sign.
+func intChars(n int16) []int16 {
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	var chars []int16
+	for n > 0 {
+		chars = append([]int16{'0' + n%10}, chars...)
+		n /= 10
+	}
+	if negative {
+		chars = append([]int16{'-'}, chars...)
+	}
+	if len(chars) == 0 {
+		chars = []int16{'0'}
+	}
+	return chars
+}
+
+// output is the cursor of Output as the Jack OS keeps it: the word of the screen it is in,
+// counted from the top left, the column of that word and whether it is on the left half.
+// Characters are 8 pixels wide and 11 high, two to a word.
+type output struct {
+	address int
+	column  int
+	left    bool
+}
+
+// reset places the cursor at the top left. Like the Jack OS, the first row of characters starts
+// on the second line of pixels.
+func (o *output) reset() {
+	*o = output{32, 0, true}
+}
+
+func (in *Interpreter) registerOutput() {
+	in.os("Output.init", 0, func(args []int16) int16 {
+		in.output.reset()
+		return 0
+	})
+	in.os("Output.moveCursor", 2, func(args []int16) int16 {
+		i, j := args[0], args[1]
+		if i < 0 || i > 22 || j < 0 || j > 63 {
+			in.sysError(20, "Output.moveCursor: illegal cursor location")
+		}
+		column := int(j / 2)
+		in.output = output{32 + int(i)*352 + column, column, int(j) == column*2}
+		in.drawChar(' ')
+		return 0
+	})
+	in.os("Output.printChar", 1, func(args []int16) int16 {
+		in.printChar(args[0])
+		return 0
+	})
+	in.os("Output.printString", 1, func(args []int16) int16 {
+		length := in.call("String", "length", []int16{args[0]})
+		for i := int16(0); i < length; i++ {
+			in.printChar(in.call("String", "charAt", []int16{args[0], i}))
+		}
+		return 0
+	})
+	in.os("Output.printInt", 1, func(args []int16) int16 {
+		in.printInt(args[0])
+		return 0
+	})
+	in.os("Output.println", 0, func(args []int16) int16 {
+		in.println()
+		return 0
+	})
+	in.os("Output.backSpace", 0, func(args []int16) int16 {
+		in.backSpace()
+		return 0
+	})
+}
+
+// drawChar draws a character at the cursor, over the half of the words the cursor is in.
+func (in *Interpreter) drawChar(c int16) {
+	bitmap := font[0]
+	if c >= 32 && c <= 126 {
+		bitmap = font[c]
+	}
+	address := Screen + in.output.address
+	for _, row := range bitmap {
+		if in.output.left {
+			in.RAM[address] = in.RAM[address]&^0xff | row
+		} else {
+			in.RAM[address] = in.RAM[address]&0xff | row<<8
+		}
+		address += 32
+	}
+}
+
+// printChar prints a character and moves the cursor on, to the next line after the last column.
+// The newline and backspace keys move the cursor instead.
+func (in *Interpreter) printChar(c int16) {
+	switch c {
+	case 128:
+		in.println()
+	case 129:
+		in.backSpace()
+	default:
+		in.drawChar(c)
+		if !in.output.left {
+			in.output.column++
+			in.output.address++
+		}
+		if in.output.column == 32 {
+			in.println()
+		} else {
+			in.output.left = !in.output.left
+		}
+	}
+	if in.Console != nil && c >= 32 && c <= 126 {
+		in.Console.Write([]byte{byte(c)})
+	}
+}
+
+func (in *Interpreter) printInt(n int16) {
+	for _, c := range intChars(n) {
+		in.printChar(c)
+	}
+}
+
+// println moves the cursor to the start of the next line, from the last line to the first. The
+// console gets a newline whenever the cursor moves to the next line.
+func (in *Interpreter) println() {
+	o := &in.output
+	o.address += 352 - o.column
+	o.column, o.left = 0, true
+	if o.address == 8128 {
+		o.address = 32
+	}
+	if in.Console != nil {
+		in.Console.Write([]byte{'\n'})
+	}
+}
+
+// backSpace moves the cursor one character back and erases it.
+func (in *Interpreter) backSpace() {
+	o := &in.output
+	if o.left {
+		if o.column > 0 {
+			o.column--
+			o.address--
+		} else {
+			o.column = 31
+			if o.address == 32 {
+				o.address = 8128
+			}
+			o.address -= 321
+		}
+		o.left = false
+	} else {
+		o.left = true
+	}
+	in.drawChar(' ')
+}
+
+func (in *Interpreter) registerScreen() {
+	in.os("Screen.init", 0, func(args []int16) int16 {
+		in.color = true
+		return 0
+	})
+	in.os("Screen.clearScreen", 0, func(args []int16) int16 {
+		for i := Screen; i < Keyboard; i++ {
+			in.RAM[i] = 0
+		}
+		return 0
+	})
+	in.os("Screen.setColor", 1, func(args []int16) int16 {
+		in.color = args[0] != 0
+		return 0
+	})
+	in.os("Screen.drawPixel", 2, func(args []int16) int16 {
+		in.drawPixel(args[0], args[1])
+		return 0
+	})
+	in.os("Screen.drawLine", 4, func(args []int16) int16 {
+		in.drawLine(args[0], args[1], args[2], args[3])
+		return 0
+	})
+	in.os("Screen.drawRectangle", 4, func(args []int16) int16 {
+		x1, y1, x2, y2 := args[0], args[1], args[2], args[3]
+		if x1 > x2 || y1 > y2 || x1 < 0 || x2 > 511 || y1 < 0 || y2 > 255 {
+			in.sysError(9, "Screen.drawRectangle: illegal rectangle coordinates")
+		}
+		for y := y1; y <= y2; y++ {
+			in.drawHorizontal(y, x1, x2)
+		}
+		return 0
+	})
+	in.os("Screen.drawCircle", 3, func(args []int16) int16 {
+		x, y, r := args[0], args[1], args[2]
+		if x < 0 || x > 511 || y < 0 || y > 255 {
+			in.sysError(12, "Screen.drawCircle: illegal center coordinates")
+		}
+		if x-r < 0 || x+r > 511 || y-r < 0 || y+r > 255 {
+			in.sysError(13, "Screen.drawCircle: illegal radius")
+		}
+		in.drawCircle(x, y, r)
+		return 0
+	})
+}
+
+// setWord sets the pixels of mask in the screen word at address to the color.
+func (in *Interpreter) setWord(address int, mask int16) {
+	if in.color {
+		in.RAM[Screen+address] |= mask
+	} else {
+		in.RAM[Screen+address] &^= mask
+	}
+}
+
+// bit returns the mask of pixel i of a word, 0 for the pixel past the last.
+func bit(i int16) int16 {
+	return int16(1 << uint(i))
+}
+
+func (in *Interpreter) drawPixel(x int16, y int16) {
+	if x < 0 || x > 511 || y < 0 || y > 255 {
+		in.sysError(7, "Screen.drawPixel: illegal pixel coordinates")
+	}
+	in.setWord(int(y)*32+int(x/16), bit(x%16))
+}
+
+// drawLine draws a line with the integer steps of the Jack OS, so the same pixels are set: the
+// line is walked along its longer axis from the end with the smaller coordinate.
+func (in *Interpreter) drawLine(x1 int16, y1 int16, x2 int16, y2 int16) {
+	if x1 < 0 || x2 > 511 || y1 < 0 || y2 > 255 {
+		in.sysError(8, "Screen.drawLine: illegal line coordinates")
+	}
+	dx, dy := abs(x2-x1), abs(y2-y1)
+	steep := dx < dy
+	if steep && y2 < y1 || !steep && x2 < x1 {
+		x1, y1, x2, y2 = x2, y2, x1, y1
+	}
+	var a, b, end int16
+	var down bool
+	if steep {
+		dx, dy = dy, dx
+		a, b, end, down = y1, x1, y2, x1 > x2
+	} else {
+		a, b, end, down = x1, y1, x2, y1 > y2
+	}
+	diff := 2*dy - dx
+	straight, diagonal := 2*dy, 2*(dy-dx)
+	plot := func() {
+		if steep {
+			in.drawPixel(b, a)
+		} else {
+			in.drawPixel(a, b)
+		}
+	}
+	plot()
+	for a < end {
+		if diff < 0 {
+			diff += straight
+		} else {
+			diff += diagonal
+			if down {
+				b--
+			} else {
+				b++
+			}
+		}
+		a++
+		plot()
+	}
+}
+
+func abs(n int16) int16 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// drawHorizontal draws the row y from x1 to x2 a word at a time, the part of the row outside
+// the screen is left out.
+func (in *Interpreter) drawHorizontal(y int16, x1 int16, x2 int16) {
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	if y < 0 || y > 255 || x1 > 511 || x2 < 0 {
+		return
+	}
+	if x1 < 0 {
+		x1 = 0
+	}
+	if x2 > 511 {
+		x2 = 511
+	}
+	first := ^(bit(x1%16) - 1)
+	last := bit(x2%16+1) - 1
+	address := int(y)*32 + int(x1/16)
+	end := int(y)*32 + int(x2/16)
+	if address == end {
+		in.setWord(address, first&last)
+		return
+	}
+	in.setWord(address, first)
+	for address++; address < end; address++ {
+		in.setWord(address, -1)
+	}
+	in.setWord(end, last)
+}
+
+// drawCircle fills a circle with the midpoint algorithm of the Jack OS, a row of the circle at
+// a time.
+func (in *Interpreter) drawCircle(x int16, y int16, r int16) {
+	a, b, diff := int16(0), r, 1-r
+	rows := func() {
+		in.drawHorizontal(y-b, x+a, x-a)
+		in.drawHorizontal(y+b, x+a, x-a)
+		in.drawHorizontal(y-a, x-b, x+b)
+		in.drawHorizontal(y+a, x-b, x+b)
+	}
+	rows()
+	for b > a {
+		if diff < 0 {
+			diff += 2*a + 3
+		} else {
+			diff += 2*(a-b) + 5
+			b--
+		}
+		a++
+		rows()
+	}
+}
+
+func (in *Interpreter) registerKeyboard() {
+	in.os("Keyboard.init", 0, func(args []int16) int16 { return 0 })
+	in.os("Keyboard.keyPressed", 0, func(args []int16) int16 {
+		return in.RAM[Keyboard]
+	})
+	in.os("Keyboard.readChar", 0, func(args []int16) int16 {
+		return in.readChar()
+	})
+	in.os("Keyboard.readLine", 1, func(args []int16) int16 {
+		return in.readLine(args[0])
+	})
+	in.os("Keyboard.readInt", 1, func(args []int16) int16 {
+		s := in.readLine(args[0])
+		value := in.call("String", "intValue", []int16{s})
+		in.call("String", "dispose", []int16{s})
+		return value
+	})
+}
+
+// readKey returns the next key of the input. A newline is the newline key, a backspace or delete
+// the backspace key.
+func (in *Interpreter) readKey() int16 {
+	if in.Input == nil {
+		in.fail(0, "Keyboard: there is no input")
+	}
+	if in.keys == nil || in.keysFrom != in.Input {
+		in.keys, in.keysFrom = bufio.NewReader(in.Input), in.Input
+	}
+	for {
+		c, err := in.keys.ReadByte()
+		if err == io.EOF {
+			in.fail(0, "Keyboard: end of input")
+		} else if err != nil {
+			in.fail(0, "Keyboard: %v", err)
+		}
+		switch c {
+		case '\r':
+			continue
+		case '\n':
+			return 128
+		case '\b', 127:
+			return 129
+		}
+		return int16(c)
+	}
+}
+
+// readChar reads a key, showing the cursor while it waits and echoing the key.
+func (in *Interpreter) readChar() int16 {
+	in.printChar(0)
+	c := in.readKey()
+	in.printChar(129)
+	in.printChar(c)
+	return c
+}
+
+// readLine prints the message and reads a line of at most 80 characters, backspace erases the
+// last one.
+func (in *Interpreter) readLine(message int16) int16 {
+	in.call("Output", "printString", []int16{message})
+	s := in.call("String", "new", []int16{80})
+	for {
+		c := in.readChar()
+		switch c {
+		case 128:
+			return s
+		case 129:
+			in.call("String", "eraseLastChar", []int16{s})
+		default:
+			s = in.call("String", "appendChar", []int16{s, c})
+		}
+	}
+}
+
+func (in *Interpreter) registerSys() {
+	in.os("Sys.init", 0, func(args []int16) int16 {
+		in.call("Main", "main", nil)
+		panic(halt{})
+	})
+	in.os("Sys.halt", 0, func(args []int16) int16 {
+		panic(halt{})
+	})
+	in.os("Sys.error", 1, func(args []int16) int16 {
+		in.sysError(args[0], "Sys.error")
+		return 0
+	})
+	in.os("Sys.wait", 1, func(args []int16) int16 {
+		if args[0] < 0 {
+			in.sysError(1, "Sys.wait: duration is negative")
+		}
+		return 0
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"example.com/ast"
+	"example.com/interp"
+)
+
+const usage = `usage: jack run [flags] path... runs a program from its .jack files or folders
+       jack test [flags] folder... runs the tests of the programs in the folders`
+
+// main interprets Jack programs without compiling them. jack run runs Main.main, or the function
+// given with -f, with the text printed through Output on the standard output and the keyboard
+// read from the standard input. jack test runs the Test functions of the *Test.jack classes of
+// each folder and reports each as passed or failed, the exit status is 1 when a test fails.
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	extended := flags.Bool("extended", false, "interpret extended-Jack")
+	precedence := flags.Bool("precedence", false, "group operators by precedence")
+	steps := flags.Int("steps", 0, "stop a run or test after this many statements, 0 for no bound")
+	function := flags.String("f", "Main.main", "the function jack run runs")
+	pattern := flags.String("run", "", "only run the tests whose name matches this regular expression")
+	flags.Parse(os.Args[2:])
+	var mode ast.Mode
+	if *extended {
+		mode |= ast.Extended
+	}
+	if *precedence {
+		mode |= ast.Precedence
+	}
+
+	switch os.Args[1] {
+	case "run":
+		in := interp.New(mode)
+		in.MaxSteps = *steps
+		in.Console, in.Input = os.Stdout, os.Stdin
+		for _, path := range flags.Args() {
+			if err := load(in, path); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := in.Run(*function); err != nil {
+			fmt.Println()
+			log.Fatal(err)
+		}
+		fmt.Println()
+	case "test":
+		match, err := regexp.Compile(*pattern)
+		if err != nil {
+			log.Fatal(err)
+		}
+		failed := false
+		for _, dir := range flags.Args() {
+			if !test(dir, mode, *steps, match) {
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	default:
+		log.Fatal(usage)
+	}
+}
+
+// load loads a .jack file, or the .jack files of a folder.
+func load(in *interp.Interpreter, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return in.LoadDir(path)
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".jack") {
+		return fmt.Errorf("%s is not a .jack file", path)
+	}
+	return in.LoadFile(path)
+}
+
+// test runs the tests of the program in dir and prints their results, it reports whether they
+// all passed.
+func test(dir string, mode ast.Mode, steps int, match *regexp.Regexp) bool {
+	in := interp.New(mode)
+	in.MaxSteps = steps
+	if err := in.LoadDir(dir); err != nil {
+		fmt.Printf("FAIL\t%s\t%v\n", dir, err)
+		return false
+	}
+	passed, failed := 0, 0
+	for _, name := range in.Tests() {
+		if !match.MatchString(name) {
+			continue
+		}
+		if err := in.RunTest(name); err != nil {
+			fmt.Printf("FAIL\t%s\t%v\n", name, err)
+			failed++
+		} else {
+			fmt.Printf("PASS\t%s\n", name)
+			passed++
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("FAIL\t%s\t%d passed, %d failed\n", dir, passed, failed)
+		return false
+	}
+	fmt.Printf("ok\t%s\t%d passed\n", dir, passed)
+	return true
+}
@@ -0,0 +1,17 @@
+module main
+
+go 1.13
+
+require (
+	example.com/ast v0.0.0
+	example.com/cache v0.0.0
+	example.com/doc v0.0.0
+	example.com/tokenizer v0.0.0
+)
+
+replace (
+	example.com/ast => ../ast
+	example.com/cache => ../cache
+	example.com/doc => ../doc
+	example.com/tokenizer => ../tokenizer
+)
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"example.com/ast"
+	"example.com/doc"
+)
+
+// main generates the API reference of the .jack files given as arguments, folders are searched
+// for .jack files. The reference is printed as one Markdown document, or as HTML with -html.
+// With -o the reference is written into a folder instead, a page per class and an index.
+func main() {
+	html := flag.Bool("html", false, "generate HTML instead of Markdown")
+	out := flag.String("o", "", "write a page per class and an index page into this folder")
+	extended := flag.Bool("extended", false, "read extended-Jack")
+	flag.Parse()
+	var mode ast.Mode
+	if *extended {
+		mode = ast.Extended
+	}
+	format := doc.Markdown
+	if *html {
+		format = doc.HTML
+	}
+
+	var classes []*doc.Class
+	for _, arg := range flag.Args() {
+		err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !strings.EqualFold(filepath.Ext(path), ".jack") {
+				return err
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			class, err := ast.ParseClass(f, mode)
+			if err != nil {
+				log.Fatalf("%s:%v", path, err)
+			}
+			classes = append(classes, doc.New(class))
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	sort.SliceStable(classes, func(i, j int) bool { return classes[i].Name < classes[j].Name })
+
+	var err error
+	if *out != "" {
+		if err = os.MkdirAll(*out, 0755); err == nil {
+			err = doc.WritePages(*out, classes, format)
+		}
+	} else {
+		err = doc.Write(os.Stdout, classes, format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,13 @@
+module main
+
+go 1.13
+
+require (
+	example.com/format v0.0.0
+	example.com/tokenizer v0.0.0
+)
+
+replace (
+	example.com/format => ../format
+	example.com/tokenizer => ../tokenizer
+)
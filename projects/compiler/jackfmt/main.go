@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/format"
+	"example.com/tokenizer"
+)
+
+// main formats the .jack files given as arguments, folders are searched for .jack files. The
+// formatted source is printed unless -l, -d or -w is given. With -l or -d the exit status is 1
+// when a file is not formatted, so the check can run in CI.
+func main() {
+	list := flag.Bool("l", false, "list the files whose formatting differs from jackfmt's")
+	diff := flag.Bool("d", false, "print a diff of the changes instead of the formatted source")
+	write := flag.Bool("w", false, "write the formatted source back to the file")
+	extended := flag.Bool("extended", false, "format extended-Jack")
+	flag.Parse()
+	var mode tokenizer.Mode
+	if *extended {
+		mode = tokenizer.Extended
+	}
+
+	var files []string
+	for _, arg := range flag.Args() {
+		err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.EqualFold(filepath.Ext(path), ".jack") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	unformatted := false
+	for _, path := range files {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		formatted, err := format.Source(src, mode)
+		if err != nil {
+			log.Fatalf("%s:%v", path, err)
+		}
+		changed := !bytes.Equal(src, formatted)
+		unformatted = unformatted || changed
+		switch {
+		case *list:
+			if changed {
+				fmt.Println(path)
+			}
+		case *diff:
+			if changed {
+				fmt.Print(format.Diff(path, string(src), string(formatted)))
+			}
+		case *write:
+			if changed {
+				if err := ioutil.WriteFile(path, formatted, 0644); err != nil {
+					log.Fatal(err)
+				}
+			}
+		default:
+			os.Stdout.Write(formatted)
+		}
+	}
+	if unformatted && (*list || *diff) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"example.com/ast"
+	"example.com/lint"
+)
+
+// main lints the .jack files given as arguments, folders are searched for .jack files. The files
+// of a folder are checked together as one program. Diagnostics are printed one per line as
+// file:line:column: message (check), or as a JSON array with -json for editors. The exit status
+// is 1 when there is a diagnostic.
+func main() {
+	jsonOutput := flag.Bool("json", false, "print the diagnostics as a JSON array")
+	extended := flag.Bool("extended", false, "lint extended-Jack")
+	precedence := flag.Bool("precedence", false, "group operators by precedence")
+	flag.Parse()
+	var mode ast.Mode
+	if *extended {
+		mode |= ast.Extended
+	}
+	if *precedence {
+		mode |= ast.Precedence
+	}
+
+	programs := make(map[string][]string)
+	for _, arg := range flag.Args() {
+		err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.EqualFold(filepath.Ext(path), ".jack") {
+				dir := filepath.Dir(path)
+				programs[dir] = append(programs[dir], path)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	var dirs []string
+	for dir := range programs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	diagnostics := []lint.Diagnostic{}
+	for _, dir := range dirs {
+		found, err := lint.Files(programs[dir], mode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		diagnostics = append(diagnostics, found...)
+	}
+	if *jsonOutput {
+		out, err := json.MarshalIndent(diagnostics, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(out))
+	} else {
+		for _, d := range diagnostics {
+			fmt.Println(d)
+		}
+	}
+	if len(diagnostics) > 0 {
+		os.Exit(1)
+	}
+}
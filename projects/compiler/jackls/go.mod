@@ -0,0 +1,27 @@
+module main
+
+go 1.13
+
+require (
+	example.com/ast v0.0.0
+	example.com/cache v0.0.0
+	example.com/engine v0.0.0
+	example.com/lint v0.0.0
+	example.com/lsp v0.0.0
+	example.com/tokenizer v0.0.0
+	example.com/writer v0.0.0
+	vm/interpreter v0.0.0
+	vm/parser v0.0.0
+)
+
+replace (
+	example.com/ast => ../ast
+	example.com/cache => ../cache
+	example.com/engine => ../engine
+	example.com/lint => ../lint
+	example.com/lsp => ../lsp
+	example.com/tokenizer => ../tokenizer
+	example.com/writer => ../writer
+	vm/interpreter => ../../vm/interpreter
+	vm/parser => ../../vm/parser
+)
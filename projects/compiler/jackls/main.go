@@ -0,0 +1,19 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"example.com/lsp"
+)
+
+// main runs the Jack language server over standard input and output. Editors start it as the
+// server command of the jack language, the language options can be set in the
+// initializationOptions: {"extended": true, "precedence": true, "strict": true}.
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("jackls: ")
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,400 @@
+package lint
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"example.com/ast"
+	"example.com/cache"
+	"example.com/tokenizer"
+)
+
+// Diagnostic is a finding at a position of a file. Check names the check that made it, so an
+// editor can group or silence them.
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s (%s)", d.File, d.Line, d.Column, d.Message, d.Check)
+}
+
+// The checks.
+const (
+	Syntax      = "syntax"
+	Declaration = "declaration"
+	Unused      = "unused"
+	Shadow      = "shadow"
+	Unreachable = "unreachable"
+	Result      = "result"
+	Constructor = "constructor"
+	Method      = "method"
+	Dispose     = "dispose"
+)
+
+// Files lints the .jack files as the classes of one program. A file that does not parse gets a
+// single syntax diagnostic and is not checked further, a class declared more than once or with a
+// subroutine declared more than once gets a declaration diagnostic. The error is only set when a
+// file can't be read.
+func Files(paths []string, mode ast.Mode) ([]Diagnostic, error) {
+	var diagnostics []Diagnostic
+	index := cache.NewProgramIndex()
+	classes := make(map[string]*ast.Class)
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		class, err := ast.ParseClass(f, mode)
+		f.Close()
+		if err != nil {
+			e, ok := err.(*tokenizer.Error)
+			if !ok {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			diagnostics = append(diagnostics, Diagnostic{path, e.Pos.Line, e.Pos.Column, Syntax, e.Msg})
+			continue
+		}
+		declarations, err := class.Declarations()
+		if err == nil {
+			err = index.Add(declarations)
+		}
+		if err != nil {
+			diagnostics = append(diagnostics, Diagnostic{path, class.Name.NamePos.Line, class.Name.NamePos.Column, Declaration, err.Error()})
+		}
+		classes[path] = class
+	}
+	for _, path := range paths {
+		if class, ok := classes[path]; ok {
+			diagnostics = append(diagnostics, Class(path, class, index)...)
+		}
+	}
+	sortDiagnostics(diagnostics)
+	return diagnostics, nil
+}
+
+func sortDiagnostics(diagnostics []Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// variable is a declared name together with what the checked code does with it.
+type variable struct {
+	name *ast.Ident
+	kind string
+	typ  string
+	read bool
+	// written is set by a let that assigns the whole variable.
+	written bool
+	// allocation is the constructor call last assigned to a local, escapes is set when the
+	// object is handed to other code, which then owns it.
+	allocation *ast.CallExpr
+	escapes    bool
+	disposed   bool
+}
+
+type checker struct {
+	path        string
+	class       *ast.Class
+	index       *cache.ClassIndex
+	diagnostics []Diagnostic
+	classVars   map[string]*variable
+	// the state of the subroutine being checked
+	vars     map[string]*variable
+	usesThis bool
+}
+
+// Class lints a parsed class, the index holds the declarations of the program it belongs to.
+func Class(path string, class *ast.Class, index *cache.ClassIndex) []Diagnostic {
+	c := &checker{path: path, class: class, index: index, classVars: make(map[string]*variable)}
+	var classVars []*variable
+	for _, dec := range class.Vars {
+		for _, name := range dec.Names {
+			v := &variable{name: name, kind: dec.Kind, typ: dec.Type}
+			c.classVars[name.Name] = v
+			classVars = append(classVars, v)
+		}
+	}
+	for _, sub := range class.Subroutines {
+		c.checkSubroutine(sub)
+	}
+	for _, v := range classVars {
+		c.checkUsed(v)
+	}
+	sortDiagnostics(c.diagnostics)
+	return c.diagnostics
+}
+
+func (c *checker) reportf(pos tokenizer.Pos, check string, format string, a ...interface{}) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{c.path, pos.Line, pos.Column, check, fmt.Sprintf(format, a...)})
+}
+
+func (c *checker) checkUsed(v *variable) {
+	switch {
+	case v.read:
+	case v.written && v.kind != "parameter":
+		c.reportf(v.name.NamePos, Unused, "%s %s is assigned but never used", v.kind, v.name.Name)
+	default:
+		c.reportf(v.name.NamePos, Unused, "%s %s is never used", v.kind, v.name.Name)
+	}
+}
+
+func (c *checker) checkSubroutine(sub *ast.Subroutine) {
+	c.vars, c.usesThis = make(map[string]*variable), false
+	var vars []*variable
+	for _, param := range sub.Params {
+		v := &variable{name: param.Name, kind: "parameter", typ: param.Type}
+		c.vars[param.Name.Name] = v
+		vars = append(vars, v)
+	}
+	for _, dec := range sub.Locals {
+		for _, name := range dec.Names {
+			if field, ok := c.classVars[name.Name]; ok {
+				c.reportf(name.NamePos, Shadow, "local %s shadows %s %s", name.Name, field.kind, name.Name)
+			}
+			v := &variable{name: name, kind: "local", typ: dec.Type}
+			c.vars[name.Name] = v
+			vars = append(vars, v)
+		}
+	}
+
+	c.checkStatements(sub.Body)
+	c.checkReachable(sub.Body)
+
+	for _, v := range vars {
+		c.checkUsed(v)
+		if v.allocation != nil && !v.escapes && !v.disposed {
+			c.reportf(v.allocation.Pos(), Dispose, "%s allocated by %s.%s is never disposed", v.name.Name, v.allocation.Receiver.Name, v.allocation.Name.Name)
+		}
+	}
+	name := c.class.Name.Name + "." + sub.Name.Name
+	if sub.Kind == "method" && !c.usesThis {
+		c.reportf(sub.Name.NamePos, Method, "method %s does not use this, it could be a function", name)
+	}
+	if sub.Kind == "constructor" {
+		for _, s := range sub.Body {
+			ast.Inspect(s, func(node ast.Node) bool {
+				if s, ok := node.(*ast.ReturnStmt); ok {
+					if this, ok := s.Value.(*ast.KeywordLit); !ok || this.Value != "this" {
+						c.reportf(s.Return, Constructor, "constructor %s does not return this", name)
+					}
+				}
+				return true
+			})
+		}
+	}
+}
+
+// lookup finds the variable a name refers to, a local or parameter hides a class variable.
+func (c *checker) lookup(name string) (*variable, bool) {
+	if v, ok := c.vars[name]; ok {
+		return v, true
+	}
+	v, ok := c.classVars[name]
+	if ok && v.kind == "field" {
+		c.usesThis = true
+	}
+	return v, ok
+}
+
+func (c *checker) checkStatements(statements []ast.Stmt) {
+	for _, s := range statements {
+		c.checkStatement(s)
+	}
+}
+
+func (c *checker) checkStatement(s ast.Stmt) {
+	switch s := s.(type) {
+	case *ast.LetStmt:
+		c.checkLet(s)
+	case *ast.IfStmt:
+		c.checkExpr(s.Cond)
+		c.checkStatements(s.Then)
+		c.checkStatements(s.Else)
+	case *ast.WhileStmt:
+		c.checkExpr(s.Cond)
+		c.checkStatements(s.Body)
+	case *ast.ForStmt:
+		if s.Init != nil {
+			c.checkLet(s.Init)
+		}
+		c.checkExpr(s.Cond)
+		if s.Step != nil {
+			c.checkLet(s.Step)
+		}
+		c.checkStatements(s.Body)
+	case *ast.SwitchStmt:
+		c.checkExpr(s.Value)
+		for _, clause := range s.Cases {
+			for _, value := range clause.Values {
+				c.checkExpr(value)
+			}
+			c.checkStatements(clause.Body)
+		}
+	case *ast.DoStmt:
+		c.checkExpr(s.Call)
+		c.checkDiscarded(s.Call)
+	case *ast.ReturnStmt:
+		c.checkExpr(s.Value)
+	}
+}
+
+func (c *checker) checkLet(s *ast.LetStmt) {
+	c.checkExpr(s.Index)
+	c.checkExpr(s.Value)
+	v, ok := c.lookup(s.Name.Name)
+	if !ok {
+		return
+	}
+	if s.Index != nil {
+		v.read = true
+		return
+	}
+	v.written = true
+	if call, ok := s.Value.(*ast.CallExpr); ok && v.kind == "local" && c.allocates(call) {
+		v.allocation = call
+	}
+}
+
+// allocates reports whether call is Class.new(...) returning a new object of Class, which
+// includes the OS function Array.new.
+func (c *checker) allocates(call *ast.CallExpr) bool {
+	if call.Receiver == nil || call.Name.Name != "new" {
+		return false
+	}
+	if _, ok := c.lookup(call.Receiver.Name); ok {
+		return false
+	}
+	sub, _, ok := c.index.Subroutine(call.Receiver.Name, "new")
+	return ok && sub.ReturnType == call.Receiver.Name
+}
+
+// checkExpr records the variables read by e.
+func (c *checker) checkExpr(e ast.Expr) {
+	switch e := e.(type) {
+	case *ast.Ident:
+		if v, ok := c.lookup(e.Name); ok {
+			v.read, v.escapes = true, true
+		}
+	case *ast.KeywordLit:
+		if e.Value == "this" {
+			c.usesThis = true
+		}
+	case *ast.IndexExpr:
+		if v, ok := c.lookup(e.Name.Name); ok {
+			v.read = true
+		}
+		c.checkExpr(e.Index)
+	case *ast.CallExpr:
+		c.checkCall(e)
+		for _, arg := range e.Args {
+			c.checkExpr(arg)
+		}
+	case *ast.UnaryExpr:
+		c.checkExpr(e.X)
+	case *ast.BinaryExpr:
+		c.checkExpr(e.X)
+		c.checkExpr(e.Y)
+	case *ast.ParenExpr:
+		c.checkExpr(e.X)
+	}
+}
+
+func (c *checker) checkCall(call *ast.CallExpr) {
+	if call.Receiver == nil {
+		// an unqualified call of a method passes this along
+		sub, _, ok := c.index.Subroutine(c.class.Name.Name, call.Name.Name)
+		if !ok || sub.Kind == cache.Method {
+			c.usesThis = true
+		}
+		return
+	}
+	if v, ok := c.lookup(call.Receiver.Name); ok {
+		v.read = true
+		if call.Name.Name == "dispose" {
+			v.disposed = true
+		}
+	}
+}
+
+// callee returns the subroutine a call resolves to.
+func (c *checker) callee(call *ast.CallExpr) (*cache.Subroutine, string, bool) {
+	className := c.class.Name.Name
+	if call.Receiver != nil {
+		className = call.Receiver.Name
+		if v, ok := c.vars[call.Receiver.Name]; ok {
+			className = v.typ
+		} else if v, ok := c.classVars[call.Receiver.Name]; ok {
+			className = v.typ
+		}
+	}
+	sub, _, ok := c.index.Subroutine(className, call.Name.Name)
+	return sub, className, ok
+}
+
+// checkDiscarded reports a do statement that throws away the value of its call. A method that
+// returns an object of its own class, like String.appendChar, is taken to return this for
+// chaining and its value may be dropped.
+func (c *checker) checkDiscarded(call *ast.CallExpr) {
+	sub, className, ok := c.callee(call)
+	if !ok || sub.ReturnType == "void" || (sub.Kind == cache.Method && sub.ReturnType == className) {
+		return
+	}
+	c.reportf(call.Pos(), Result, "result of %s.%s is discarded", className, sub.Name)
+}
+
+// terminates reports whether control never continues after s.
+func terminates(s ast.Stmt) bool {
+	switch s := s.(type) {
+	case *ast.ReturnStmt, *ast.BranchStmt:
+		return true
+	case *ast.IfStmt:
+		return len(s.Else) > 0 && terminates(last(s.Then)) && terminates(last(s.Else))
+	}
+	return false
+}
+
+func last(statements []ast.Stmt) ast.Stmt {
+	if len(statements) == 0 {
+		return nil
+	}
+	return statements[len(statements)-1]
+}
+
+// checkReachable reports the first statement of each block that follows a statement that
+// never completes.
+func (c *checker) checkReachable(statements []ast.Stmt) {
+	reported := false
+	for i, s := range statements {
+		switch s := s.(type) {
+		case *ast.IfStmt:
+			c.checkReachable(s.Then)
+			c.checkReachable(s.Else)
+		case *ast.WhileStmt:
+			c.checkReachable(s.Body)
+		case *ast.ForStmt:
+			c.checkReachable(s.Body)
+		case *ast.SwitchStmt:
+			for _, clause := range s.Cases {
+				c.checkReachable(clause.Body)
+			}
+		}
+		if !reported && terminates(s) && i+1 < len(statements) {
+			c.reportf(statements[i+1].Pos(), Unreachable, "unreachable code")
+			reported = true
+		}
+	}
+}
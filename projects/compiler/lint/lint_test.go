@@ -0,0 +1,169 @@
+package lint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"example.com/ast"
+	"example.com/cache"
+)
+
+func lintSource(t *testing.T, src string, mode ast.Mode) []string {
+	class, err := ast.ParseClass(strings.NewReader(src), mode)
+	if err != nil {
+		t.Fatalf("Unexpected error for %q: %v", src, err)
+	}
+	index := cache.NewProgramIndex()
+	declarations, err := class.Declarations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Add(declarations)
+	var got []string
+	for _, d := range Class("A.jack", class, index) {
+		got = append(got, d.String())
+	}
+	return got
+}
+
+func TestClass(t *testing.T) {
+	sources := []struct {
+		source string
+		mode   ast.Mode
+		want   []string
+	}{
+		{
+			`class A {
+    field int x, y;
+    static int s;
+    method int f(int a, int b) { var int i, j; let j = 1; return x + b; }
+}`,
+			0,
+			[]string{
+				"A.jack:2:18: field y is never used (unused)",
+				"A.jack:3:16: static s is never used (unused)",
+				"A.jack:4:22: parameter a is never used (unused)",
+				"A.jack:4:42: local i is never used (unused)",
+				"A.jack:4:45: local j is assigned but never used (unused)",
+			},
+		},
+		{
+			`class A {
+    field int x;
+    method int f() { var int x; let x = 1; return x; }
+}`,
+			0,
+			[]string{
+				"A.jack:2:15: field x is never used (unused)",
+				"A.jack:3:16: method A.f does not use this, it could be a function (method)",
+				"A.jack:3:30: local x shadows field x (shadow)",
+			},
+		},
+		{
+			`class A {
+    function int f(boolean b) {
+        if (b) { return 1; } else { return 2; }
+        do Output.printInt(3);
+        while (b) { break; let b = false; }
+        return 0;
+    }
+}`,
+			ast.Extended,
+			[]string{
+				"A.jack:4:9: unreachable code (unreachable)",
+				"A.jack:5:28: unreachable code (unreachable)",
+			},
+		},
+		{
+			`class A {
+    field int x;
+    constructor A new() { let x = 0; if (x) { return null; } return this; }
+    method int g() { return x; }
+    method void h(String s) { do g(); do Math.abs(x); do s.appendChar(65); return; }
+}`,
+			0,
+			[]string{
+				"A.jack:3:47: constructor A.new does not return this (constructor)",
+				"A.jack:5:34: result of A.g is discarded (result)",
+				"A.jack:5:42: result of Math.abs is discarded (result)",
+			},
+		},
+		{
+			`class A {
+    function void f() {
+        var A kept, leaked, disposed;
+        var Array a;
+        let kept = A.new();
+        let leaked = A.new();
+        let disposed = A.new();
+        let a = Array.new(3);
+        do A.keep(kept);
+        do leaked.run();
+        do disposed.dispose();
+        let a[0] = 1;
+        do Memory.deAlloc(a);
+        return;
+    }
+    constructor A new() { return this; }
+    method void run() { do dispose(); return; }
+    method void dispose() { do Memory.deAlloc(this); return; }
+    function void keep(A a) { do a.run(); return; }
+}`,
+			0,
+			[]string{
+				"A.jack:6:22: leaked allocated by A.new is never disposed (dispose)",
+			},
+		},
+	}
+	for _, source := range sources {
+		got := strings.Join(lintSource(t, source.source, source.mode), "\n")
+		want := strings.Join(source.want, "\n")
+		if got != want {
+			t.Errorf("Diagnostics were incorrect, got:\n%s\nwanted:\n%s", got, want)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	files := map[string]string{
+		"Main.jack":  "class Main { function void main() { do Point.new(); return; } }",
+		"Point.jack": "class Point { constructor Point new() { return this; } }",
+		"Bad.jack":   "class Bad { function void f() { let 1 = 2; } }",
+		"Twice.jack": "class Twice { function void f() { return; } function int f() { return 1; } }",
+		"Twin.jack":  "class Point { function void g() { return; } }",
+	}
+	var paths []string
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	// the class declared again is the one of the later file
+	sort.Strings(paths)
+	diagnostics, err := Files(paths, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, strings.TrimPrefix(d.String(), dir+string(filepath.Separator)))
+	}
+	want := `Bad.jack:1:37: expected a variable name, got "1" (syntax)
+Main.jack:1:40: result of Point.new is discarded (result)
+Twice.jack:1:7: subroutine Twice.f is declared more than once (declaration)
+Twin.jack:1:7: class Point is declared more than once (declaration)`
+	if strings.Join(got, "\n") != want {
+		t.Errorf("Diagnostics were incorrect, got:\n%s\nwanted:\n%s", strings.Join(got, "\n"), want)
+	}
+}
@@ -0,0 +1,305 @@
+package lsp
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"example.com/ast"
+	"example.com/cache"
+	"example.com/engine"
+	"example.com/lint"
+	"example.com/tokenizer"
+)
+
+// diagnose compiles the class of f as the compiler would and lints it. The compiler reports
+// errors and, with the strict option, warnings, jacklint only checks a class that parses.
+func (s *Server) diagnose(p *program, f *file) []Diagnostic {
+	options := s.options
+	options.Classes = p.index
+	c := engine.NewCompilationEngine(strings.NewReader(f.text), bufio.NewWriter(ioutil.Discard), options)
+	c.CompileClass()
+	diagnostics := []Diagnostic{}
+	for _, err := range c.Errors() {
+		diagnostics = append(diagnostics, compilerDiagnostic(f, err, severityError))
+	}
+	for _, err := range c.Warnings() {
+		diagnostics = append(diagnostics, compilerDiagnostic(f, err, severityWarning))
+	}
+	if f.class != nil && f.err == nil {
+		for _, d := range lint.Class(f.path, f.class, p.index) {
+			pos := tokenizer.Pos{Line: d.Line, Column: d.Column}
+			diagnostics = append(diagnostics, Diagnostic{f.toUTF16(wordRange(f.text, pos)), severityWarning, d.Check, "jacklint", d.Message})
+		}
+	}
+	return diagnostics
+}
+
+// compilerMessage splits an error of the compiler into its position and message.
+var compilerMessage = regexp.MustCompile(`^(\d+):(\d+): (?:warning: )?(.*)$`)
+
+func compilerDiagnostic(f *file, err error, severity int) Diagnostic {
+	d := Diagnostic{Severity: severity, Source: "jack", Message: err.Error()}
+	if m := compilerMessage.FindStringSubmatch(err.Error()); m != nil {
+		var pos tokenizer.Pos
+		fmt.Sscan(m[1], &pos.Line)
+		fmt.Sscan(m[2], &pos.Column)
+		d.Range, d.Message = f.toUTF16(wordRange(f.text, pos)), m[3]
+	}
+	return d
+}
+
+// wordRange returns the range of the word or symbol that starts at pos, in runes.
+func wordRange(text string, pos tokenizer.Pos) Range {
+	start := Position{pos.Line - 1, pos.Column - 1}
+	end := Position{start.Line, start.Character + 1}
+	lines := strings.Split(text, "\n")
+	if start.Line < 0 || start.Line >= len(lines) {
+		return Range{start, start}
+	}
+	line := []rune(lines[start.Line])
+	if start.Character < 0 || start.Character >= len(line) {
+		return Range{start, start}
+	}
+	for isWordChar(line[start.Character]) && end.Character < len(line) && isWordChar(line[end.Character]) {
+		end.Character++
+	}
+	return Range{start, end}
+}
+
+func isWordChar(c rune) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func (s *Server) definition(params textDocumentPositionParams) (interface{}, error) {
+	p, f, err := s.document(params.TextDocument.URI)
+	if err != nil || f == nil || f.class == nil {
+		return nil, err
+	}
+	ref, ok := referenceAt(f.class, f.fromUTF16(params.Position))
+	if !ok {
+		return nil, nil
+	}
+	switch ref.kind {
+	case variableReference:
+		if ref.decl != nil {
+			return Location{uriFromPath(f.path), f.toUTF16(identRange(ref.decl))}, nil
+		}
+	case classReference:
+		if target, ok := p.classes[ref.class]; ok {
+			return Location{uriFromPath(target.path), target.toUTF16(identRange(target.class.Name))}, nil
+		}
+	case subroutineReference:
+		if target, sub := p.subroutine(ref.class, ref.member); sub != nil {
+			return Location{uriFromPath(target.path), target.toUTF16(identRange(sub.Name))}, nil
+		}
+	case constantReference:
+		if target, dec := p.constant(ref.class, ref.member); dec != nil {
+			return Location{uriFromPath(target.path), target.toUTF16(identRange(dec.Name))}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) hover(params textDocumentPositionParams) (interface{}, error) {
+	p, f, err := s.document(params.TextDocument.URI)
+	if err != nil || f == nil || f.class == nil {
+		return nil, err
+	}
+	ref, ok := referenceAt(f.class, f.fromUTF16(params.Position))
+	if !ok {
+		return nil, nil
+	}
+	// code is shown as Jack, note as text below it
+	var code, note string
+	switch ref.kind {
+	case variableReference:
+		symbol := ref.symbol
+		code = fmt.Sprintf("%s %s %s", symbol.Kind, symbol.Type, symbol.Name)
+		note = fmt.Sprintf("%s %d", symbol.Kind.Segment(), symbol.Index)
+	case classReference:
+		if _, ok := p.index.Class(ref.class); !ok {
+			return nil, nil
+		}
+		code = "class " + ref.class
+		if target, ok := p.classes[ref.class]; ok {
+			note = target.class.Doc
+		}
+	case subroutineReference:
+		sub, _, ok := p.index.Subroutine(ref.class, ref.member)
+		if !ok {
+			return nil, nil
+		}
+		code = signature(ref.class, sub)
+		if _, decl := p.subroutine(ref.class, ref.member); decl != nil {
+			note = decl.Doc
+		}
+	case constantReference:
+		constant, ok := p.index.Constant(ref.class, ref.member)
+		if !ok {
+			return nil, nil
+		}
+		code = fmt.Sprintf("const %s %s.%s", constant.Type, ref.class, constant.Name)
+		if constant.Resolved {
+			code += fmt.Sprintf(" = %d", constant.Value)
+		}
+	}
+	value := "```jack\n" + code + "\n```"
+	if note != "" {
+		value += "\n" + note
+	}
+	return Hover{markupContent{"markdown", value}, f.toUTF16(identRange(ref.ident))}, nil
+}
+
+// signature formats a subroutine as it is declared, qualified by its class.
+func signature(className string, sub *cache.Subroutine) string {
+	params := make([]string, len(sub.Params))
+	for i, param := range sub.Params {
+		params[i] = param.Type + " " + param.Name
+	}
+	return fmt.Sprintf("%s %s %s.%s(%s)", sub.Kind, sub.ReturnType, className, sub.Name, strings.Join(params, ", "))
+}
+
+func (s *Server) documentSymbols(params documentSymbolParams) (interface{}, error) {
+	_, f, err := s.document(params.TextDocument.URI)
+	if err != nil || f == nil || f.class == nil {
+		return []DocumentSymbol{}, err
+	}
+	class := f.class
+	symbol := DocumentSymbol{
+		Name:           class.Name.Name,
+		Kind:           symbolClass,
+		Range:          f.toUTF16(spanRange(class.ClassPos, class.End)),
+		SelectionRange: f.toUTF16(identRange(class.Name)),
+		Children:       []DocumentSymbol{},
+	}
+	for _, dec := range class.Vars {
+		for _, name := range dec.Names {
+			kind := symbolField
+			if dec.Kind == "static" {
+				kind = symbolVariable
+			}
+			symbol.Children = append(symbol.Children, DocumentSymbol{name.Name, dec.Kind + " " + dec.Type, kind, f.toUTF16(identRange(name)), f.toUTF16(identRange(name)), nil})
+		}
+	}
+	for _, dec := range class.Constants {
+		symbol.Children = append(symbol.Children, DocumentSymbol{dec.Name.Name, "const " + dec.Type, symbolConstant, f.toUTF16(identRange(dec.Name)), f.toUTF16(identRange(dec.Name)), nil})
+	}
+	for _, sub := range class.Subroutines {
+		if sub.Name == nil {
+			continue
+		}
+		kind := symbolFunction
+		switch sub.Kind {
+		case "constructor":
+			kind = symbolConstructor
+		case "method":
+			kind = symbolMethod
+		}
+		params := make([]string, len(sub.Params))
+		for i, param := range sub.Params {
+			params[i] = param.Type + " " + param.Name.Name
+		}
+		detail := fmt.Sprintf("%s %s(%s)", sub.Kind, sub.ReturnType, strings.Join(params, ", "))
+		symbol.Children = append(symbol.Children, DocumentSymbol{sub.Name.Name, detail, kind, f.toUTF16(spanRange(sub.KindPos, sub.End)), f.toUTF16(identRange(sub.Name)), nil})
+	}
+	return []DocumentSymbol{symbol}, nil
+}
+
+// spanRange returns the range from start to the closing brace at end, which is zero when the
+// declaration was cut short by an error.
+func spanRange(start, end tokenizer.Pos) Range {
+	r := Range{Position{start.Line - 1, start.Column - 1}, Position{end.Line - 1, end.Column}}
+	if end.Line == 0 {
+		r.End = r.Start
+	}
+	return r
+}
+
+// memberAccess matches the name and dot before the cursor, with the part of a member name
+// typed so far.
+var memberAccess = regexp.MustCompile(`([A-Za-z_][A-Za-z_0-9]*)\.[A-Za-z_0-9]*$`)
+
+// completion lists the members that can follow ClassName. or objectVar. at the cursor: the
+// functions, constructors and constants of a class, or the methods of an object's class.
+func (s *Server) completion(params textDocumentPositionParams) (interface{}, error) {
+	p, f, err := s.document(params.TextDocument.URI)
+	if err != nil || f == nil {
+		return []CompletionItem{}, err
+	}
+	lines := strings.Split(f.text, "\n")
+	pos := f.fromUTF16(params.Position)
+	if pos.Line >= len(lines) || pos.Character > len([]rune(lines[pos.Line])) {
+		return []CompletionItem{}, nil
+	}
+	m := memberAccess.FindStringSubmatch(string([]rune(lines[pos.Line])[:pos.Character]))
+	if m == nil {
+		return []CompletionItem{}, nil
+	}
+	className, viaObject := m[1], false
+	if typ, ok := variableType(f.class, pos, m[1]); ok {
+		className, viaObject = typ, true
+	}
+	class, ok := p.index.Class(className)
+	if !ok {
+		return []CompletionItem{}, nil
+	}
+	items := []CompletionItem{}
+	for _, sub := range class.Subroutines {
+		if (sub.Kind == cache.Method) != viaObject {
+			continue
+		}
+		kind := completionFunction
+		switch sub.Kind {
+		case cache.Constructor:
+			kind = completionConstructor
+		case cache.Method:
+			kind = completionMethod
+		}
+		items = append(items, CompletionItem{sub.Name, kind, signature(className, sub)})
+	}
+	if !viaObject {
+		for _, constant := range class.Constants {
+			items = append(items, CompletionItem{constant.Name, completionConstant, "const " + constant.Type})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items, nil
+}
+
+// variableType returns the type of the variable name in scope at pos. The class may be the
+// partial result of a parse that failed on the line being edited.
+func variableType(class *ast.Class, pos Position, name string) (string, bool) {
+	if class == nil {
+		return "", false
+	}
+	line := pos.Line + 1
+	for _, sub := range class.Subroutines {
+		if sub.KindPos.Line > line || (sub.End.Line != 0 && sub.End.Line < line) {
+			continue
+		}
+		for _, param := range sub.Params {
+			if param.Name.Name == name {
+				return param.Type, true
+			}
+		}
+		for _, dec := range sub.Locals {
+			for _, ident := range dec.Names {
+				if ident.Name == name {
+					return dec.Type, true
+				}
+			}
+		}
+	}
+	for _, dec := range class.Vars {
+		for _, ident := range dec.Names {
+			if ident.Name == name {
+				return dec.Type, true
+			}
+		}
+	}
+	return "", false
+}
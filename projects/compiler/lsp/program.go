@@ -0,0 +1,151 @@
+package lsp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"example.com/ast"
+	"example.com/cache"
+	"example.com/engine"
+)
+
+// file is a class of the program. class is nil when the source does not start like a class,
+// otherwise it holds what was parsed before err.
+type file struct {
+	path  string
+	text  string
+	class *ast.Class
+	err   error
+}
+
+// program is the classes of the folder of a document, the compiler's unit of a program. The
+// open documents are read from the editor, the other classes from disk.
+type program struct {
+	files   map[string]*file
+	classes map[string]*file
+	// index holds the declarations of the OS and of every class that scans
+	index *cache.ClassIndex
+}
+
+// load parses the program that holds the document at path.
+func (s *Server) load(path string) *program {
+	p := &program{files: make(map[string]*file), classes: make(map[string]*file), index: cache.NewProgramIndex()}
+	paths, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*"))
+	for open := range s.documents {
+		if filepath.Dir(open) == filepath.Dir(path) {
+			paths = append(paths, open)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if !strings.EqualFold(filepath.Ext(path), ".jack") || p.files[path] != nil {
+			continue
+		}
+		text, ok := s.documents[path]
+		if !ok {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			text = string(data)
+		}
+		f := &file{path: path, text: text}
+		f.class, f.err = ast.ParseClass(strings.NewReader(text), s.mode())
+		if f.class.Name == nil {
+			f.class = nil
+		}
+		p.files[path] = f
+		if f.class != nil && p.classes[f.class.Name.Name] == nil {
+			p.classes[f.class.Name.Name] = f
+		}
+		if declarations, err := engine.ScanClass(strings.NewReader(text), s.options); err == nil {
+			p.index.Add(declarations)
+		}
+	}
+	engine.ResolveConstants(p.index, s.options)
+	return p
+}
+
+// subroutine returns the declaration of a subroutine of a class of the program.
+func (p *program) subroutine(className string, name string) (*file, *ast.Subroutine) {
+	f, ok := p.classes[className]
+	if !ok {
+		return nil, nil
+	}
+	for _, sub := range f.class.Subroutines {
+		if sub.Name != nil && sub.Name.Name == name {
+			return f, sub
+		}
+	}
+	return f, nil
+}
+
+// constant returns the declaration of a constant of a class of the program.
+func (p *program) constant(className string, name string) (*file, *ast.ConstDec) {
+	f, ok := p.classes[className]
+	if !ok {
+		return nil, nil
+	}
+	for _, dec := range f.class.Constants {
+		if dec.Name.Name == name {
+			return f, dec
+		}
+	}
+	return f, nil
+}
+
+// The protocol counts the characters of a line in UTF-16 code units, the tokenizer counts runes.
+// The features work in runes, the positions are converted as they come from and go to the editor.
+
+// line returns the zero based line n of the file.
+func (f *file) line(n int) string {
+	lines := strings.Split(f.text, "\n")
+	if n < 0 || n >= len(lines) {
+		return ""
+	}
+	return lines[n]
+}
+
+// fromUTF16 converts a position of the editor to one whose character counts runes.
+func (f *file) fromUTF16(pos Position) Position {
+	units, runes := pos.Character, 0
+	for _, r := range f.line(pos.Line) {
+		if units <= 0 {
+			break
+		}
+		units -= utf16Len(r)
+		runes++
+	}
+	if units > 0 {
+		runes += units
+	}
+	return Position{pos.Line, runes}
+}
+
+// toUTF16 converts a range whose characters count runes to a range of the editor.
+func (f *file) toUTF16(r Range) Range {
+	return Range{f.positionToUTF16(r.Start), f.positionToUTF16(r.End)}
+}
+
+func (f *file) positionToUTF16(pos Position) Position {
+	runes, units := pos.Character, 0
+	for _, r := range f.line(pos.Line) {
+		if runes <= 0 {
+			break
+		}
+		units += utf16Len(r)
+		runes--
+	}
+	return Position{pos.Line, units + runes}
+}
+
+// utf16Len returns the number of UTF-16 code units of r, runes past the basic multilingual plane
+// take a surrogate pair.
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
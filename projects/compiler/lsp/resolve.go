@@ -0,0 +1,185 @@
+package lsp
+
+import (
+	"example.com/ast"
+	"example.com/cache"
+	"example.com/tokenizer"
+)
+
+type referenceKind uint8
+
+const (
+	variableReference referenceKind = iota
+	classReference
+	subroutineReference
+	constantReference
+)
+
+// reference is a name in the source together with what it names. A variable carries its
+// symbol and declaration, the other kinds the class and member they name.
+type reference struct {
+	ident  *ast.Ident
+	kind   referenceKind
+	symbol cache.Symbol
+	decl   *ast.Ident
+	class  string
+	member string
+}
+
+// resolver walks a class with the compiler's symbol table, so variables resolve to the same
+// kind, type and segment index as in the compiled code.
+type resolver struct {
+	class      *ast.Class
+	symbols    *cache.SymbolTable
+	decls      map[string]*ast.Ident
+	classDecls map[string]*ast.Ident
+	references []reference
+}
+
+// references returns every resolved name of a class in source order of the declarations and
+// statements that hold them.
+func references(class *ast.Class) []reference {
+	r := &resolver{class: class, symbols: cache.NewSymbolTable(), classDecls: make(map[string]*ast.Ident)}
+	r.decls = r.classDecls
+	name := class.Name.Name
+	r.add(reference{ident: class.Name, kind: classReference, class: name})
+	for _, dec := range class.Vars {
+		r.typeReference(dec.TypePos, dec.Type)
+		for _, ident := range dec.Names {
+			r.define(ident, dec.Type, cache.ParseKind(dec.Kind))
+		}
+	}
+	for _, dec := range class.Constants {
+		r.typeReference(dec.TypePos, dec.Type)
+		r.add(reference{ident: dec.Name, kind: constantReference, class: name, member: dec.Name.Name})
+		r.expr(dec.Value)
+	}
+	for _, sub := range class.Subroutines {
+		if sub.Name == nil {
+			continue
+		}
+		r.symbols.StartSubroutine()
+		r.decls = make(map[string]*ast.Ident)
+		if sub.Kind == "method" {
+			r.symbols.Define("this", name, cache.Arg)
+		}
+		r.typeReference(sub.ReturnPos, sub.ReturnType)
+		r.add(reference{ident: sub.Name, kind: subroutineReference, class: name, member: sub.Name.Name})
+		for _, param := range sub.Params {
+			r.typeReference(param.TypePos, param.Type)
+			r.define(param.Name, param.Type, cache.Arg)
+		}
+		for _, dec := range sub.Locals {
+			r.typeReference(dec.TypePos, dec.Type)
+			for _, ident := range dec.Names {
+				r.define(ident, dec.Type, cache.Var)
+			}
+		}
+		for _, s := range sub.Body {
+			ast.Inspect(s, r.visit)
+		}
+	}
+	return r.references
+}
+
+func (r *resolver) add(ref reference) {
+	r.references = append(r.references, ref)
+}
+
+func (r *resolver) define(ident *ast.Ident, typ string, kind cache.Kind) {
+	symbol := r.symbols.Define(ident.Name, typ, kind)
+	r.decls[ident.Name] = ident
+	r.add(reference{ident: ident, kind: variableReference, symbol: symbol, decl: ident})
+}
+
+func (r *resolver) typeReference(pos tokenizer.Pos, typ string) {
+	switch typ {
+	case "int", "char", "boolean", "void", "":
+		return
+	}
+	r.add(reference{ident: &ast.Ident{NamePos: pos, Name: typ}, kind: classReference, class: typ})
+}
+
+// variable resolves a name used as a variable. A bare name that is not a variable may be an
+// extended-Jack constant of the class.
+func (r *resolver) variable(ident *ast.Ident) {
+	if symbol, ok := r.symbols.Lookup(ident.Name); ok {
+		decl, ok := r.decls[ident.Name]
+		if !ok {
+			decl = r.classDecls[ident.Name]
+		}
+		r.add(reference{ident: ident, kind: variableReference, symbol: symbol, decl: decl})
+		return
+	}
+	for _, dec := range r.class.Constants {
+		if dec.Name.Name == ident.Name {
+			r.add(reference{ident: ident, kind: constantReference, class: r.class.Name.Name, member: ident.Name})
+		}
+	}
+}
+
+func (r *resolver) expr(e ast.Expr) {
+	if e != nil {
+		ast.Inspect(e, r.visit)
+	}
+}
+
+// visit resolves the names of a statement or expression, the nodes whose names depend on
+// their place are handled here with their children.
+func (r *resolver) visit(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.LetStmt:
+		r.variable(n.Name)
+		r.expr(n.Index)
+		r.expr(n.Value)
+		return false
+	case *ast.Ident:
+		r.variable(n)
+	case *ast.IndexExpr:
+		r.variable(n.Name)
+		r.expr(n.Index)
+		return false
+	case *ast.SelectorExpr:
+		r.add(reference{ident: n.X, kind: classReference, class: n.X.Name})
+		r.add(reference{ident: n.Sel, kind: constantReference, class: n.X.Name, member: n.Sel.Name})
+		return false
+	case *ast.CallExpr:
+		className := r.class.Name.Name
+		if n.Receiver != nil {
+			if symbol, ok := r.symbols.Lookup(n.Receiver.Name); ok {
+				r.variable(n.Receiver)
+				className = symbol.Type
+			} else {
+				className = n.Receiver.Name
+				r.add(reference{ident: n.Receiver, kind: classReference, class: className})
+			}
+		}
+		r.add(reference{ident: n.Name, kind: subroutineReference, class: className, member: n.Name.Name})
+		for _, arg := range n.Args {
+			r.expr(arg)
+		}
+		return false
+	}
+	return true
+}
+
+// contains reports whether the zero based position is on the name.
+func contains(ident *ast.Ident, pos Position) bool {
+	start := ident.NamePos.Column - 1
+	return ident.NamePos.Line-1 == pos.Line && start <= pos.Character && pos.Character <= start+len(ident.Name)
+}
+
+// referenceAt returns the reference under the cursor.
+func referenceAt(class *ast.Class, pos Position) (reference, bool) {
+	for _, ref := range references(class) {
+		if contains(ref.ident, pos) {
+			return ref, true
+		}
+	}
+	return reference{}, false
+}
+
+func identRange(ident *ast.Ident) Range {
+	start := Position{ident.NamePos.Line - 1, ident.NamePos.Column - 1}
+	return Range{start, Position{start.Line, start.Character + len(ident.Name)}}
+}
@@ -0,0 +1,246 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"example.com/ast"
+	"example.com/engine"
+)
+
+// Server answers an editor speaking the Language Server Protocol over a JSON-RPC stream, such
+// as the standard input and output of the jackls command.
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	options   engine.Options
+	documents map[string]string
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, documents: make(map[string]string)}
+}
+
+func (s *Server) mode() ast.Mode {
+	var mode ast.Mode
+	if s.options.Extended {
+		mode |= ast.Extended
+	}
+	if s.options.Precedence {
+		mode |= ast.Precedence
+	}
+	return mode
+}
+
+// Serve handles messages until the editor sends exit or closes the stream. Messages are
+// handled one at a time in the order they arrive.
+func (s *Server) Serve() error {
+	for {
+		content, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(content, &msg); err != nil {
+			if err := s.respond(nil, nil, &responseError{parseErrorCode, err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+		result, respErr := s.handle(msg)
+		if msg.ID == nil {
+			continue
+		}
+		if err := s.respond(msg.ID, result, respErr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) respond(id json.RawMessage, result interface{}, respErr *responseError) error {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	resp := response{JSONRPC: "2.0", ID: id, Error: respErr}
+	if respErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resp.Result = data
+	}
+	return writeMessage(s.out, resp)
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return writeMessage(s.out, notification{"2.0", method, params})
+}
+
+// handle runs the handler of a message, a notification's result is dropped. After shutdown
+// only exit is handled, a request gets an error and a notification is ignored.
+func (s *Server) handle(msg message) (interface{}, *responseError) {
+	if s.shutdown {
+		return nil, &responseError{invalidRequest, fmt.Sprintf("%s after shutdown", msg.Method)}
+	}
+	var err error
+	var result interface{}
+	switch msg.Method {
+	case "initialize":
+		var params initializeParams
+		if err = unmarshal(msg.Params, &params); err == nil {
+			s.options.Extended = params.InitializationOptions.Extended
+			s.options.Precedence = params.InitializationOptions.Precedence
+			s.options.Strict = params.InitializationOptions.Strict
+			result = s.capabilities()
+		}
+	case "initialized":
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err = unmarshal(msg.Params, &params); err == nil {
+			err = s.didOpen(params)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err = unmarshal(msg.Params, &params); err == nil {
+			err = s.didChange(params)
+		}
+	case "textDocument/didSave":
+		var params didSaveParams
+		if err = unmarshal(msg.Params, &params); err == nil {
+			err = s.didSave(params)
+		}
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err = unmarshal(msg.Params, &params); err == nil {
+			err = s.didClose(params)
+		}
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err = unmarshal(msg.Params, &params); err == nil {
+			result, err = s.definition(params)
+		}
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err = unmarshal(msg.Params, &params); err == nil {
+			result, err = s.hover(params)
+		}
+	case "textDocument/documentSymbol":
+		var params documentSymbolParams
+		if err = unmarshal(msg.Params, &params); err == nil {
+			result, err = s.documentSymbols(params)
+		}
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err = unmarshal(msg.Params, &params); err == nil {
+			result, err = s.completion(params)
+		}
+	default:
+		if msg.ID != nil {
+			return nil, &responseError{methodNotFound, fmt.Sprintf("method %s is not supported", msg.Method)}
+		}
+	}
+	if err != nil {
+		return nil, &responseError{invalidParams, err.Error()}
+	}
+	return result, nil
+}
+
+func unmarshal(params json.RawMessage, v interface{}) error {
+	if params == nil {
+		return nil
+	}
+	return json.Unmarshal(params, v)
+}
+
+func (s *Server) capabilities() interface{} {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			// positions count UTF-16 code units, the encoding every client supports
+			"positionEncoding": "utf-16",
+			"textDocumentSync": map[string]interface{}{
+				"openClose": true,
+				// the editor sends the whole document on each change
+				"change": 1,
+				"save":   map[string]interface{}{"includeText": true},
+			},
+			"definitionProvider":     true,
+			"hoverProvider":          true,
+			"documentSymbolProvider": true,
+			"completionProvider":     map[string]interface{}{"triggerCharacters": []string{"."}},
+		},
+		"serverInfo": map[string]string{"name": "jackls"},
+	}
+}
+
+func (s *Server) didOpen(params didOpenParams) error {
+	path, err := pathFromURI(params.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	s.documents[path] = params.TextDocument.Text
+	return s.publishDiagnostics(path)
+}
+
+func (s *Server) didChange(params didChangeParams) error {
+	path, err := pathFromURI(params.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	if n := len(params.ContentChanges); n > 0 {
+		s.documents[path] = params.ContentChanges[n-1].Text
+	}
+	return nil
+}
+
+func (s *Server) didSave(params didSaveParams) error {
+	path, err := pathFromURI(params.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	if params.Text != nil {
+		s.documents[path] = *params.Text
+	}
+	return s.publishDiagnostics(path)
+}
+
+func (s *Server) didClose(params didCloseParams) error {
+	path, err := pathFromURI(params.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	delete(s.documents, path)
+	return nil
+}
+
+func (s *Server) publishDiagnostics(path string) error {
+	p := s.load(path)
+	diagnostics := []Diagnostic{}
+	if f, ok := p.files[path]; ok {
+		diagnostics = s.diagnose(p, f)
+	}
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{uriFromPath(path), diagnostics})
+}
+
+// document returns the program of a document and the document's file.
+func (s *Server) document(uri string) (*program, *file, error) {
+	path, err := pathFromURI(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := s.load(path)
+	return p, p.files[path], nil
+}
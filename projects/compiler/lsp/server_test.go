@@ -0,0 +1,214 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// session runs the server over the messages and returns its replies by request ID, the
+// notifications are keyed by method and count, as in "textDocument/publishDiagnostics 1".
+func session(t *testing.T, messages ...interface{}) map[string]json.RawMessage {
+	var in, out bytes.Buffer
+	for _, m := range messages {
+		if err := writeMessage(&in, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := NewServer(&in, &out).Serve(); err != nil {
+		t.Fatal(err)
+	}
+	replies := make(map[string]json.RawMessage)
+	notifications := make(map[string]int)
+	r := bufio.NewReader(&out)
+	for {
+		content, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var reply struct {
+			ID     json.RawMessage
+			Method string
+			Result json.RawMessage
+			Params json.RawMessage
+			Error  *responseError
+		}
+		if err := json.Unmarshal(content, &reply); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case reply.Error != nil:
+			replies[string(reply.ID)] = json.RawMessage(reply.Error.Message)
+		case reply.Method != "":
+			notifications[reply.Method]++
+			replies[fmt.Sprintf("%s %d", reply.Method, notifications[reply.Method])] = reply.Params
+		default:
+			replies[string(reply.ID)] = reply.Result
+		}
+	}
+	return replies
+}
+
+func request(id int, method string, params interface{}) interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+}
+
+func notify(method string, params interface{}) interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+}
+
+func position(uri string, line, character int) interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     map[string]int{"line": line, "character": character},
+	}
+}
+
+const mainSource = `class Main {
+    function void main() {
+        var Point p;
+        var int unused;
+        let p = Point.new(1);
+        do Output.printInt(p.getX());
+        do p.
+        return;
+    }
+}
+`
+
+const pointSource = `class Point {
+    field int x;
+
+    constructor Point new(int ax) {
+        let x = ax;
+        return this;
+    }
+    /** Returns x. */
+    method int getX() {
+        return x;
+    }
+}
+`
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	pointPath := filepath.Join(dir, "Point.jack")
+	if err := ioutil.WriteFile(pointPath, []byte(pointSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mainURI := uriFromPath(filepath.Join(dir, "Main.jack"))
+	pointURI := uriFromPath(pointPath)
+
+	replies := session(t,
+		request(1, "initialize", map[string]interface{}{}),
+		notify("initialized", map[string]interface{}{}),
+		notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]string{"uri": mainURI, "languageId": "jack", "text": mainSource},
+		}),
+		request(2, "textDocument/definition", position(mainURI, 4, 25)),
+		request(3, "textDocument/definition", position(mainURI, 5, 30)),
+		request(4, "textDocument/hover", position(mainURI, 4, 12)),
+		request(5, "textDocument/completion", position(mainURI, 6, 13)),
+		request(6, "textDocument/completion", position(mainURI, 4, 22)),
+		request(7, "textDocument/documentSymbol", map[string]interface{}{"textDocument": map[string]string{"uri": pointURI}}),
+		request(8, "textDocument/hover", position(pointURI, 9, 16)),
+		request(9, "unknown/method", nil),
+		request(11, "textDocument/hover", position(mainURI, 5, 30)),
+		notify("textDocument/didSave", map[string]interface{}{
+			"textDocument": map[string]string{"uri": mainURI},
+			"text":         strings.Replace(mainSource, "        do p.\n", "", 1),
+		}),
+		request(10, "shutdown", nil),
+		request(12, "textDocument/hover", position(mainURI, 4, 12)),
+		notify("exit", nil),
+	)
+
+	checks := []struct {
+		key  string
+		want string
+	}{
+		{"textDocument/publishDiagnostics 1", `{"uri":"` + mainURI + `","diagnostics":[` +
+			`{"range":{"start":{"line":8,"character":4},"end":{"line":8,"character":5}},"severity":1,"source":"jack","message":"invalid term grammar } is not valid for a term"}]}`},
+		{"textDocument/publishDiagnostics 2", `{"uri":"` + mainURI + `","diagnostics":[` +
+			`{"range":{"start":{"line":3,"character":16},"end":{"line":3,"character":22}},"severity":2,"code":"unused","source":"jacklint","message":"local unused is never used"},` +
+			`{"range":{"start":{"line":4,"character":16},"end":{"line":4,"character":21}},"severity":2,"code":"dispose","source":"jacklint","message":"p allocated by Point.new is never disposed"}]}`},
+		{"2", `{"uri":"` + pointURI + `","range":{"start":{"line":3,"character":22},"end":{"line":3,"character":25}}}`},
+		{"3", `{"uri":"` + pointURI + `","range":{"start":{"line":8,"character":15},"end":{"line":8,"character":19}}}`},
+		{"4", `{"contents":{"kind":"markdown","value":"` + "```jack\\nvar Point p\\n```\\nlocal 0" + `"},"range":{"start":{"line":4,"character":12},"end":{"line":4,"character":13}}}`},
+		{"5", `[{"label":"getX","kind":2,"detail":"method int Point.getX()"}]`},
+		{"6", `[{"label":"new","kind":4,"detail":"constructor Point Point.new(int ax)"}]`},
+		{"8", `{"contents":{"kind":"markdown","value":"` + "```jack\\nfield int x\\n```\\nthis 0" + `"},"range":{"start":{"line":9,"character":15},"end":{"line":9,"character":16}}}`},
+		{"9", "method unknown/method is not supported"},
+		{"10", "null"},
+		{"12", "textDocument/hover after shutdown"},
+		{"11", `{"contents":{"kind":"markdown","value":"` + "```jack\\nmethod int Point.getX()\\n```\\nReturns x." + `"},"range":{"start":{"line":5,"character":29},"end":{"line":5,"character":33}}}`},
+	}
+	for _, check := range checks {
+		if got := string(replies[check.key]); got != check.want {
+			t.Errorf("Reply %s was incorrect, got: %s, wanted: %s", check.key, got, check.want)
+		}
+	}
+
+	var symbols []DocumentSymbol
+	if err := json.Unmarshal(replies["7"], &symbols); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, symbol := range symbols {
+		names = append(names, symbol.Name)
+		for _, child := range symbol.Children {
+			names = append(names, child.Name+" "+child.Detail)
+		}
+	}
+	want := "Point,x field int,new constructor Point(int ax),getX method int()"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("Document symbols were incorrect, got: %s, wanted: %s", got, want)
+	}
+}
+
+func TestUTF16Positions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	uri := uriFromPath(filepath.Join(dir, "Main.jack"))
+	// é is one UTF-16 code unit and 😀 two, the editor counts three where the tokenizer counts two
+	source := "class Main {\n    function int main() {\n        var int x; /* é😀 */ var int y;\n        /* é😀 */ let x = 1;\n        return x;\n    }\n}\n"
+
+	replies := session(t,
+		request(1, "initialize", map[string]interface{}{}),
+		notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri, "languageId": "jack", "text": source},
+		}),
+		request(2, "textDocument/hover", position(uri, 3, 22)),
+		request(3, "textDocument/definition", position(uri, 3, 22)),
+		request(4, "shutdown", nil),
+		notify("exit", nil),
+	)
+
+	checks := []struct {
+		key  string
+		want string
+	}{
+		{"textDocument/publishDiagnostics 1", `{"uri":"` + uri + `","diagnostics":[` +
+			`{"range":{"start":{"line":2,"character":37},"end":{"line":2,"character":38}},"severity":2,"code":"unused","source":"jacklint","message":"local y is never used"}]}`},
+		{"2", `{"contents":{"kind":"markdown","value":"` + "```jack\\nvar int x\\n```\\nlocal 0" + `"},"range":{"start":{"line":3,"character":22},"end":{"line":3,"character":23}}}`},
+		{"3", `{"uri":"` + uri + `","range":{"start":{"line":2,"character":16},"end":{"line":2,"character":17}}}`},
+	}
+	for _, check := range checks {
+		if got := string(replies[check.key]); got != check.want {
+			t.Errorf("Reply %s was incorrect, got: %s, wanted: %s", check.key, got, check.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package compiler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/cache"
+	"example.com/engine"
+)
+
+// Version identifies the code generated by the compiler. It is recorded in the manifests of
+// incremental builds and must change whenever the same source would compile to different VM
+// code, so that every class is compiled again.
+const Version = "1.1"
+
+// manifestName is the name of the manifest of an incremental build, one per program folder.
+const manifestName = ".jack-manifest.json"
+
+// manifest records how the classes of a folder were compiled, so an incremental build can skip
+// the classes whose output is still up to date.
+type manifest struct {
+	Version string                   `json:"version"`
+	Files   map[string]manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	// Key hashes everything the output depends on: the source, the options and the
+	// declarations of every class of the program.
+	Key string `json:"key"`
+	// Output hashes the .vm file written, so an edited or deleted output is compiled again.
+	Output   string   `json:"output"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// loadManifest reads the manifest of dir. A missing or unreadable manifest, or one written by
+// another version of the compiler, is replaced by an empty one.
+func loadManifest(dir string) *manifest {
+	m := &manifest{Version: Version, Files: make(map[string]manifestEntry)}
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return m
+	}
+	var loaded manifest
+	if err := json.Unmarshal(data, &loaded); err != nil || loaded.Version != Version || loaded.Files == nil {
+		return m
+	}
+	return &loaded
+}
+
+func (m *manifest) save(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, manifestName), append(data, '\n'), 0644)
+}
+
+// upToDate reports whether the output of path was compiled from the source and settings that
+// key describes, and returns the warnings found when it was. The sidecar files written with the
+// output must exist too.
+func (m *manifest) upToDate(path string, key string, sidecars []string) ([]string, bool) {
+	entry, ok := m.Files[filepath.Base(path)]
+	if !ok || entry.Key != key {
+		return nil, false
+	}
+	if output, err := hashFile(vmPath(path)); err != nil || output != entry.Output {
+		return nil, false
+	}
+	for _, sidecar := range sidecars {
+		if _, err := os.Stat(sidecar); err != nil {
+			return nil, false
+		}
+	}
+	return entry.Warnings, true
+}
+
+// record stores the result of compiling path, a class with errors is always compiled again.
+func (m *manifest) record(path string, key string, errs []error, warnings []error) {
+	name := filepath.Base(path)
+	output, err := hashFile(vmPath(path))
+	if len(errs) > 0 || err != nil {
+		delete(m.Files, name)
+		return
+	}
+	entry := manifestEntry{Key: key, Output: output}
+	for _, warning := range warnings {
+		entry.Warnings = append(entry.Warnings, warning.Error())
+	}
+	m.Files[name] = entry
+}
+
+// programKey hashes the declarations of every class of a program, which the code of each
+// class depends on: how a call is made, the value of a constant, what strict mode reports.
+func programKey(index *cache.ClassIndex) (string, error) {
+	data, err := json.Marshal(index.Classes())
+	if err != nil {
+		return "", err
+	}
+	return hash(data), nil
+}
+
+// fileKey hashes what the output of the class at path depends on.
+func fileKey(path string, options engine.Options, symbols bool, program string) (string, error) {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	settings := fmt.Sprintf("%s strict=%t precedence=%t extended=%t optimize=%t debug=%t symbols=%t program=%s",
+		Version, options.Strict, options.Precedence, options.Extended, options.Optimize, options.Debug, symbols, program)
+	return hash(append([]byte(settings+"\n"), source...)), nil
+}
+
+func hashFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return hash(data), nil
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func vmPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".vm"
+}
+
+func symbolsPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".symbols.json"
+}
+
+func debugMapPath(path string) string {
+	return vmPath(path) + ".map"
+}
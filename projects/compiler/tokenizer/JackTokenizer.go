@@ -1,13 +1,11 @@
 package tokenizer
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"strconv"
-	"unicode"
+	"strings"
 	"unicode/utf8"
 )
 
@@ -20,7 +18,12 @@ const (
 	Symbol
 	StringConst
 	IntConst
+	// CharConst is an extended-Jack character literal such as 'a'
+	CharConst
 	Identifier
+	// Comment is a // or /* */ comment, only returned by a Scanner in Comments mode
+	Comment
+	EOF
 )
 
 func (c Category) String() string {
@@ -33,8 +36,14 @@ func (c Category) String() string {
 		return "stringConstant"
 	case IntConst:
 		return "integerConstant"
+	case CharConst:
+		return "charConstant"
 	case Identifier:
 		return "identifier"
+	case Comment:
+		return "comment"
+	case EOF:
+		return "EOF"
 	default:
 		return ""
 	}
@@ -76,6 +85,15 @@ func isKeyword(token string) bool {
 	return false
 }
 
+// isExtendedKeyword reports whether token is a keyword only in extended-Jack.
+func isExtendedKeyword(token string) bool {
+	switch token {
+	case "for", "break", "continue", "switch", "case", "default", "const":
+		return true
+	}
+	return false
+}
+
 func isSymbol(token string) bool {
 	switch token {
 	case "{", "}", "(", ")", "[", "]", ".", ",", ";", "+", "-", "*", "/", "&", "|", "<", ">", "=", "~":
@@ -85,7 +103,11 @@ func isSymbol(token string) bool {
 }
 
 func isStringConstant(token string) bool {
-	return string(token[0]) == `"`
+	return token != "" && token[0] == '"'
+}
+
+func isCharConstant(token string) bool {
+	return token != "" && token[0] == '\''
 }
 
 func isIntConstant(token string) bool {
@@ -96,17 +118,26 @@ func isIntConstant(token string) bool {
 }
 
 func isIdentifier(token string) bool {
-	if isIntConstant(string(token[0])) {
+	if token == "" || isDigit(rune(token[0])) {
 		return false
 	}
 	for _, char := range token {
-		if !unicode.IsDigit(char) && !unicode.IsLetter(char) && char != '_' {
+		if !isIdentifierChar(char) {
 			return false
 		}
 	}
 	return true
 }
 
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
+
+// isIdentifierChar reports whether r may appear in an identifier, Jack identifiers are ASCII.
+func isIdentifierChar(r rune) bool {
+	return isDigit(r) || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_'
+}
+
 func tokenCategory(token string) Category {
 	if isKeyword(token) {
 		return Keyword
@@ -114,6 +145,8 @@ func tokenCategory(token string) Category {
 		return Symbol
 	} else if isStringConstant(token) {
 		return StringConst
+	} else if isCharConstant(token) {
+		return CharConst
 	} else if isIntConstant(token) {
 		return IntConst
 	} else if isIdentifier(token) {
@@ -122,51 +155,55 @@ func tokenCategory(token string) Category {
 	return Unknown
 }
 
-func formatSymbol(token string) (updatedToken string) {
-	switch token {
-	case "<":
-		token = "&lt;"
-	case ">":
-		token = "&gt;"
-	case "&":
-		token = "&amp;"
-	case `"`:
-		token = "&quot;"
-	}
-	return token
-}
+var xmlEscaper = strings.NewReplacer("<", "&lt;", ">", "&gt;", "&", "&amp;", `"`, "&quot;")
 
 func formatStringConst(token string) (updatedToken string) {
 	token = token[1 : len(token)-1]
 	return token
 }
 
-type token struct {
+// Pos is a position in a source file, lines and columns count from 1 and columns count runes.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Error is a lexical error at a position in the source.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// Token is a lexical element of Jack source. Value holds the raw text, without the quotes of a
+// string constant.
+type Token struct {
 	Value    string
 	Category Category
+	Pos      Pos
 }
 
-func newToken(tokenValue string) (*token, error) {
-	Category := tokenCategory(tokenValue)
-	switch Category {
-	case Keyword:
-		return &token{tokenValue, Category}, nil
-	case Symbol:
-		tokenValue := formatSymbol(tokenValue)
-		return &token{tokenValue, Category}, nil
-	case StringConst:
-		tokenValue := formatStringConst(tokenValue)
-		return &token{tokenValue, Category}, nil
-	case IntConst:
-		return &token{tokenValue, Category}, nil
-	case Identifier:
-		return &token{tokenValue, Category}, nil
+func newToken(tokenValue string, pos Pos) Token {
+	category := tokenCategory(tokenValue)
+	if category == StringConst || category == CharConst {
+		tokenValue = formatStringConst(tokenValue)
 	}
-	// return an error here if the token is unknown
-	return &token{tokenValue, Category}, fmt.Errorf("invalid token: %s", tokenValue)
+	return Token{tokenValue, category, pos}
+}
+
+// Escaped returns the value escaped for the XML token and parse tree files, < becomes &lt;.
+func (t Token) Escaped() string {
+	return xmlEscaper.Replace(t.Value)
 }
 
-func (t *token) IsType() bool {
+func (t Token) IsType() bool {
 	if t.Category == Identifier {
 		return true
 	}
@@ -179,16 +216,16 @@ func (t *token) IsType() bool {
 	}
 }
 
-func (t *token) IsOp() bool {
+func (t Token) IsOp() bool {
 	switch t.Value {
-	case "+", "-", "*", "/", "&amp;", "|", "&lt;", "&gt;", "=":
+	case "+", "-", "*", "/", "&", "|", "<", ">", "=", "&&", "||":
 		return true
 	default:
 		return false
 	}
 }
 
-func (t *token) IsUnaryOp() bool {
+func (t Token) IsUnaryOp() bool {
 	switch t.Value {
 	case "-", "~":
 		return true
@@ -197,7 +234,7 @@ func (t *token) IsUnaryOp() bool {
 	}
 }
 
-func (t *token) isKeywordConstant() bool {
+func (t Token) IsKeywordConstant() bool {
 	switch t.Value {
 	case "true", "false", "null", "this":
 		return true
@@ -206,71 +243,284 @@ func (t *token) isKeywordConstant() bool {
 	}
 }
 
+// Scanner splits Jack source into a stream of tokens. The whole source is read up front so
+// neither lines nor files are limited in size.
 type Scanner struct {
-	*bufio.Scanner
-	Token *token
+	lexer     *lexer
+	lookahead []lexeme
+	pos       Pos
+	err       error
 }
 
+// lexeme is a token read ahead of the stream together with the error that ended the source.
+type lexeme struct {
+	token Token
+	err   error
+}
+
+// Mode selects the language the Scanner accepts.
+type Mode uint
+
+const (
+	// Extended accepts the extended-Jack keywords and operators on top of standard Jack.
+	Extended Mode = 1 << iota
+	// Comments returns comments as tokens instead of skipping them, for tools that rewrite
+	// the source.
+	Comments
+)
+
 func NewScanner(file io.Reader) *Scanner {
-	bufioScanner := bufio.NewScanner(file)
-	bufioScanner.Split(scanTokens)
-	const maxCap = 4096 * 2
-	buf := make([]byte, maxCap)
-	bufioScanner.Buffer(buf, maxCap)
-	return &Scanner{bufioScanner, &token{}}
+	return NewModeScanner(file, 0)
+}
+
+// NewModeScanner returns a Scanner for the language selected by mode.
+func NewModeScanner(file io.Reader, mode Mode) *Scanner {
+	src, err := ioutil.ReadAll(file)
+	s := &Scanner{lexer: &lexer{src: src, pos: Pos{1, 1}, mode: mode}, pos: Pos{1, 1}}
+	if err != nil {
+		s.lookahead = append(s.lookahead, lexeme{Token{"", EOF, s.pos}, err})
+	}
+	return s
+}
+
+// Err returns the first error met while reading or tokenizing the source, once the stream has
+// reached it.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Peek returns the token n places ahead without consuming it, Peek(0) is the token the next
+// call to Next returns. Past the end of the source, or past an error, the token is EOF.
+func (s *Scanner) Peek(n int) Token {
+	for len(s.lookahead) <= n {
+		last := len(s.lookahead) - 1
+		if last >= 0 && s.lookahead[last].token.Category == EOF {
+			s.lookahead = append(s.lookahead, lexeme{s.lookahead[last].token, nil})
+			continue
+		}
+		token, err := s.lexer.next()
+		if err != nil {
+			s.lookahead = append(s.lookahead, lexeme{Token{"", EOF, err.Pos}, err})
+		} else {
+			s.lookahead = append(s.lookahead, lexeme{token, nil})
+		}
+	}
+	return s.lookahead[n].token
+}
+
+// Next consumes and returns the next token.
+func (s *Scanner) Next() Token {
+	s.Peek(0)
+	next := s.lookahead[0]
+	s.lookahead = s.lookahead[1:]
+	if next.err != nil && s.err == nil {
+		s.err = next.err
+	}
+	s.pos = next.token.Pos
+	return next.token
+}
+
+// Pos returns the position of the token most recently returned by Next.
+func (s *Scanner) Pos() Pos {
+	return s.pos
 }
 
-// ScanTokens is a split function for a Scanner that returns each token in a jack file.
-func scanTokens(data []byte, atEOF bool) (advance int, token []byte, err error) {
+type lexer struct {
+	src    []byte
+	offset int
+	pos    Pos
+	mode   Mode
+}
+
+func (l *lexer) peek(n int) rune {
+	offset := l.offset
 	var r rune
-	var width int
-	start := 0
-	// Skip leading spaces and comments.
-	for width = 0; start < len(data); start += width {
-		r, width = utf8.DecodeRune(data[start:])
-		if comment, commentWidth := isComment(data[start:]); comment {
-			width = commentWidth
-		} else if !isSpace(r) {
-			break
+	for i := 0; i <= n; i++ {
+		if offset >= len(l.src) {
+			return -1
 		}
+		var width int
+		r, width = utf8.DecodeRune(l.src[offset:])
+		offset += width
 	}
+	return r
+}
 
-	// If the first rune is a symbol or string constant return it
-	r, width = utf8.DecodeRune(data[start:])
-	if isSymbol(string(r)) {
-		return start + width, data[start : start+width], nil
-	} else if isStringConstant(string(r)) {
-		constantEndIndex := bytes.IndexByte(data[start+1:], '"') + 2
-		return start + constantEndIndex, data[start : start+constantEndIndex], nil
+func (l *lexer) read() rune {
+	r, width := utf8.DecodeRune(l.src[l.offset:])
+	l.offset += width
+	if r == '\n' {
+		l.pos.Line++
+		l.pos.Column = 1
+	} else {
+		l.pos.Column++
 	}
+	return r
+}
 
-	// Scan until space or comment, marking end of word.
-	for width, i := 0, start; i < len(data); i += width {
-		r, width = utf8.DecodeRune(data[i:])
-		if isSpace(r) || isSymbol(string(r)) {
-			return i, data[start:i], nil
+// skip moves past white space and, unless they are kept, comments.
+func (l *lexer) skip() *Error {
+	for l.offset < len(l.src) {
+		r := l.peek(0)
+		switch {
+		case isSpace(r):
+			l.read()
+		case l.atComment() && l.mode&Comments == 0:
+			if err := l.comment(); err != nil {
+				return err
+			}
+		default:
+			return nil
 		}
 	}
+	return nil
+}
+
+func (l *lexer) atComment() bool {
+	return l.peek(0) == '/' && (l.peek(1) == '/' || l.peek(1) == '*')
+}
 
-	// If we're at EOF, we have a final, non-empty, non-terminated word. Return it.
-	if atEOF && len(data) > start {
-		return len(data), data[start:], nil
+// comment reads a // comment up to the end of the line or a /* */ comment up to its end.
+func (l *lexer) comment() *Error {
+	start := l.pos
+	l.read()
+	if l.read() == '/' {
+		for l.offset < len(l.src) && l.peek(0) != '\n' {
+			l.read()
+		}
+		return nil
 	}
+	for !(l.peek(0) == '*' && l.peek(1) == '/') {
+		if l.offset >= len(l.src) {
+			return &Error{start, "unterminated comment"}
+		}
+		l.read()
+	}
+	l.read()
+	l.read()
+	return nil
+}
 
-	// Request more data.
-	return start, nil, nil
+func (l *lexer) next() (Token, *Error) {
+	if err := l.skip(); err != nil {
+		return Token{}, err
+	}
+	start := l.pos
+	if l.offset >= len(l.src) {
+		return Token{"", EOF, start}, nil
+	}
+	begin := l.offset
+	if l.atComment() {
+		if err := l.comment(); err != nil {
+			return Token{}, err
+		}
+		return Token{strings.TrimRight(string(l.src[begin:l.offset]), "\r"), Comment, start}, nil
+	}
+	r := l.read()
+	switch {
+	case (r == '&' || r == '|') && l.peek(0) == r && l.mode&Extended != 0:
+		l.read()
+	case isSymbol(string(r)):
+	case r == ':' && l.mode&Extended != 0:
+	case r == '"':
+		if !l.readQuoted('"') {
+			return Token{}, &Error{start, "unterminated string constant"}
+		}
+	case r == '\'' && l.mode&Extended != 0:
+		if !l.readQuoted('\'') {
+			return Token{}, &Error{start, "unterminated character constant"}
+		}
+	case isDigit(r):
+		for isIdentifierChar(l.peek(0)) {
+			l.read()
+		}
+		value := string(l.src[begin:l.offset])
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return Token{}, &Error{start, fmt.Sprintf("invalid integer constant %s", value)}
+		}
+		if n > 32767 {
+			return Token{}, &Error{start, fmt.Sprintf("integer constant %s is out of range, the maximum is 32767", value)}
+		}
+	case isIdentifierChar(r):
+		for isIdentifierChar(l.peek(0)) {
+			l.read()
+		}
+	default:
+		return Token{}, &Error{start, fmt.Sprintf("illegal character %q", r)}
+	}
+	token := newToken(string(l.src[begin:l.offset]), start)
+	if l.mode&Extended != 0 {
+		token.Category = extendedCategory(token)
+	}
+	return token, nil
+}
+
+// readQuoted reads up to and including the closing quote, it reports false when the line or
+// the source ends first. In extended-Jack a backslash escapes the character after it.
+func (l *lexer) readQuoted(quote rune) bool {
+	for {
+		next := l.peek(0)
+		if next == -1 || next == '\n' {
+			return false
+		}
+		l.read()
+		if next == '\\' && l.mode&Extended != 0 && l.peek(0) != -1 && l.peek(0) != '\n' {
+			l.read()
+		} else if next == quote {
+			return true
+		}
+	}
+}
+
+// Hack character codes that have no printable ASCII equivalent.
+const (
+	NewLine   = 128
+	Backspace = 129
+)
+
+// CharCodes returns the Hack character codes of the value of a string or character constant.
+// In extended-Jack the escape sequences \" \' \\ \n and \b are decoded, in standard Jack a
+// backslash is an ordinary character. Characters outside the Hack character set are errors.
+func CharCodes(value string, mode Mode) ([]int, error) {
+	var codes []int
+	runes := []rune(value)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\\' && mode&Extended != 0 {
+			i++
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated escape sequence")
+			}
+			switch runes[i] {
+			case '"', '\'', '\\':
+				codes = append(codes, int(runes[i]))
+			case 'n':
+				codes = append(codes, NewLine)
+			case 'b':
+				codes = append(codes, Backspace)
+			default:
+				return nil, fmt.Errorf("unknown escape sequence \\%c", runes[i])
+			}
+			continue
+		}
+		if r < ' ' || r > '~' {
+			return nil, fmt.Errorf("character %q is not in the Hack character set", r)
+		}
+		codes = append(codes, int(r))
+	}
+	return codes, nil
 }
 
-func isComment(data []byte) (bool, int) {
-	var width int
-	if string(data[:2]) == "//" {
-		width = bytes.IndexByte(data, '\n') + 1
-		return true, width
-	} else if len(data) > 2 && string(data[:3]) == "/**" {
-		width = bytes.Index(data, []byte("*/")) + 2
-		return true, width
+// extendedCategory returns the category of token in extended-Jack.
+func extendedCategory(token Token) Category {
+	switch {
+	case token.Category == Identifier && isExtendedKeyword(token.Value):
+		return Keyword
+	case token.Value == ":", token.Value == "&&", token.Value == "||":
+		return Symbol
 	}
-	return false, -1
+	return token.Category
 }
 
 // isSpace reports whether the character is a Unicode white space character.
@@ -297,13 +547,3 @@ func isSpace(r rune) bool {
 	}
 	return false
 }
-
-func (s *Scanner) Advance() {
-	s.Scan()
-	tokenValue := s.Text()
-	token, err := newToken(tokenValue)
-	if err != nil {
-		log.Fatal(err)
-	}
-	s.Token = token
-}
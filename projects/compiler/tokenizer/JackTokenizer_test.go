@@ -0,0 +1,306 @@
+package tokenizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanner(t *testing.T) {
+	source := `/** doc comment */
+class Main { // line comment
+	/* block
+	   comment */ field int x_1;
+	let s = "a < b"; if (x<32767) {}
+}`
+	tokens := []struct {
+		value    string
+		category Category
+		pos      Pos
+	}{
+		{"class", Keyword, Pos{2, 1}},
+		{"Main", Identifier, Pos{2, 7}},
+		{"{", Symbol, Pos{2, 12}},
+		{"field", Keyword, Pos{4, 16}},
+		{"int", Keyword, Pos{4, 22}},
+		{"x_1", Identifier, Pos{4, 26}},
+		{";", Symbol, Pos{4, 29}},
+		{"let", Keyword, Pos{5, 2}},
+		{"s", Identifier, Pos{5, 6}},
+		{"=", Symbol, Pos{5, 8}},
+		{"a < b", StringConst, Pos{5, 10}},
+		{";", Symbol, Pos{5, 17}},
+		{"if", Keyword, Pos{5, 19}},
+		{"(", Symbol, Pos{5, 22}},
+		{"x", Identifier, Pos{5, 23}},
+		{"<", Symbol, Pos{5, 24}},
+		{"32767", IntConst, Pos{5, 25}},
+		{")", Symbol, Pos{5, 30}},
+		{"{", Symbol, Pos{5, 32}},
+		{"}", Symbol, Pos{5, 33}},
+		{"}", Symbol, Pos{6, 1}},
+		{"", EOF, Pos{6, 2}},
+	}
+	s := NewScanner(strings.NewReader(source))
+	for _, token := range tokens {
+		next := s.Next()
+		if next.Value != token.value || next.Category != token.category || next.Pos != token.pos {
+			t.Errorf("Token was incorrect, got: %q %s at %s, wanted: %q %s at %s",
+				next.Value, next.Category, next.Pos, token.value, token.category, token.pos)
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestScannerErrors(t *testing.T) {
+	sources := []struct {
+		source string
+		err    string
+	}{
+		{`let s = "abc;`, `1:9: unterminated string constant`},
+		{"let s = \"ab\nc\";", `1:9: unterminated string constant`},
+		{"class /* never closed", `1:7: unterminated comment`},
+		{"let x = 32768;", `1:9: integer constant 32768 is out of range, the maximum is 32767`},
+		{"let x = 12ab;", `1:9: invalid integer constant 12ab`},
+		{"let x = 1 # 2;", `1:11: illegal character '#'`},
+		{"let\n  x = 'a';", `2:7: illegal character '\''`},
+		{"/", ``},
+	}
+	for _, source := range sources {
+		s := NewScanner(strings.NewReader(source.source))
+		for s.Next().Category != EOF {
+		}
+		err := ""
+		if s.Err() != nil {
+			err = s.Err().Error()
+		}
+		if err != source.err {
+			t.Errorf("Error for %q was incorrect, got: %s, wanted: %s", source.source, err, source.err)
+		}
+	}
+}
+
+func TestScannerLongInput(t *testing.T) {
+	long := strings.Repeat("x", 20000)
+	s := NewScanner(strings.NewReader("// " + long + "\n" + long))
+	token := s.Next()
+	if token.Value != long || token.Pos != (Pos{2, 1}) {
+		t.Errorf("Long identifier was incorrect, got %d characters at %s", len(token.Value), token.Pos)
+	}
+}
+
+func TestScannerPeek(t *testing.T) {
+	s := NewScanner(strings.NewReader("a < b & 'c"))
+	if got := s.Peek(2).Value; got != "b" {
+		t.Errorf("Peek(2) was incorrect, got: %s, wanted: %s", got, "b")
+	}
+	if got := s.Peek(5); got.Category != EOF || got.Pos != (Pos{1, 9}) {
+		t.Errorf("Peek(5) was incorrect, got: %s at %s, wanted: %s at %s", got.Category, got.Pos, EOF, Pos{1, 9})
+	}
+	if s.Err() != nil {
+		t.Errorf("Err was incorrect before the error was reached, got: %v", s.Err())
+	}
+	want := []string{"a", "<", "b", "&"}
+	for _, value := range want {
+		if got := s.Next().Value; got != value {
+			t.Errorf("Next was incorrect, got: %s, wanted: %s", got, value)
+		}
+	}
+	if got := s.Pos(); got != (Pos{1, 7}) {
+		t.Errorf("Pos was incorrect, got: %s, wanted: %s", got, Pos{1, 7})
+	}
+	if got := s.Next(); got.Category != EOF || s.Err() == nil {
+		t.Errorf("Next was incorrect, got: %s with error %v, wanted: %s with an error", got.Category, s.Err(), EOF)
+	}
+}
+
+func TestTokenEscaped(t *testing.T) {
+	tokens := []struct {
+		token Token
+		want  string
+	}{
+		{newToken("<", Pos{}), "&lt;"},
+		{newToken(">", Pos{}), "&gt;"},
+		{newToken("&", Pos{}), "&amp;"},
+		{newToken(`"a < "`, Pos{}), "a &lt; "},
+		{newToken("x", Pos{}), "x"},
+	}
+	for _, token := range tokens {
+		if got := token.token.Escaped(); got != token.want {
+			t.Errorf("Escaped value was incorrect, got: %s, wanted: %s", got, token.want)
+		}
+	}
+}
+
+func TestExtendedMode(t *testing.T) {
+	modes := []struct {
+		mode     Mode
+		category Category
+	}{
+		{0, Identifier},
+		{Extended, Keyword},
+	}
+	for _, m := range modes {
+		s := NewModeScanner(strings.NewReader("for break continue switch case default const"), m.mode)
+		for token := s.Next(); token.Category != EOF; token = s.Next() {
+			if token.Category != m.category {
+				t.Errorf("Category of %s in mode %d was incorrect, got: %s, wanted: %s", token.Value, m.mode, token.Category, m.category)
+			}
+		}
+	}
+	symbols := []struct {
+		mode Mode
+		want []string
+	}{
+		{0, []string{"&", "&", "|", "|", "|"}},
+		{Extended, []string{"&&", "||", "|", ":"}},
+	}
+	for _, m := range symbols {
+		s := NewModeScanner(strings.NewReader("&& ||| :"), m.mode)
+		for _, want := range m.want {
+			if token := s.Next(); token.Value != want || token.Category != Symbol {
+				t.Errorf("Symbol in mode %d was incorrect, got: %q %s, wanted: %q %s", m.mode, token.Value, token.Category, want, Symbol)
+			}
+		}
+	}
+}
+
+func TestCharCodes(t *testing.T) {
+	sources := []struct {
+		source string
+		mode   Mode
+		codes  []int
+		err    string
+	}{
+		{`"Hi!"`, 0, []int{72, 105, 33}, ""},
+		{`"[\]"`, 0, []int{91, 92, 93}, ""},
+		{`"a\"b"`, Extended, []int{97, 34, 98}, ""},
+		{`"\\\n\b\'"`, Extended, []int{92, NewLine, Backspace, 39}, ""},
+		{`'x'`, Extended, []int{120}, ""},
+		{`'\''`, Extended, []int{39}, ""},
+		{`"\t"`, Extended, nil, `unknown escape sequence \t`},
+		{`"é"`, 0, nil, `character 'é' is not in the Hack character set`},
+		{"\"\t\"", 0, nil, `character '\t' is not in the Hack character set`},
+	}
+	for _, source := range sources {
+		s := NewModeScanner(strings.NewReader(source.source), source.mode)
+		token := s.Next()
+		if s.Err() != nil {
+			t.Errorf("Unexpected error for %s: %v", source.source, s.Err())
+			continue
+		}
+		codes, err := CharCodes(token.Value, source.mode)
+		if fmt.Sprint(codes) != fmt.Sprint(source.codes) {
+			t.Errorf("Codes of %s were incorrect, got: %v, wanted: %v", source.source, codes, source.codes)
+		}
+		errString := ""
+		if err != nil {
+			errString = err.Error()
+		}
+		if errString != source.err {
+			t.Errorf("Error for %s was incorrect, got: %s, wanted: %s", source.source, errString, source.err)
+		}
+	}
+	for _, source := range []string{`"a\"`, `'a`, `'\'`} {
+		s := NewModeScanner(strings.NewReader(source), Extended)
+		s.Next()
+		if s.Err() == nil {
+			t.Errorf("Error for %s was incorrect, got: nil, wanted: an unterminated constant", source)
+		}
+	}
+}
+
+func TestCommentsMode(t *testing.T) {
+	source := "/** doc\n */ class // line\r\nx /* a */;"
+	want := []struct {
+		value    string
+		category Category
+		pos      Pos
+	}{
+		{"/** doc\n */", Comment, Pos{1, 1}},
+		{"class", Keyword, Pos{2, 5}},
+		{"// line", Comment, Pos{2, 11}},
+		{"x", Identifier, Pos{3, 1}},
+		{"/* a */", Comment, Pos{3, 3}},
+		{";", Symbol, Pos{3, 10}},
+		{"", EOF, Pos{3, 11}},
+	}
+	s := NewModeScanner(strings.NewReader(source), Comments)
+	for _, token := range want {
+		next := s.Next()
+		if next.Value != token.value || next.Category != token.category || next.Pos != token.pos {
+			t.Errorf("Token was incorrect, got: %q %s at %s, wanted: %q %s at %s",
+				next.Value, next.Category, next.Pos, token.value, token.category, token.pos)
+		}
+	}
+}
+
+// TestTokensXML compares the tokens of the programs of project 10 with its comparison files.
+func TestTokensXML(t *testing.T) {
+	paths, err := filepath.Glob("../../10/*/*.jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no programs in ../../10")
+	}
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := os.ReadFile(strings.TrimSuffix(path, ".jack") + "T.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got strings.Builder
+		got.WriteString("<tokens>\n")
+		s := NewScanner(strings.NewReader(string(source)))
+		for token := s.Next(); token.Category != EOF; token = s.Next() {
+			fmt.Fprintf(&got, "<%s> %s </%s>\n", token.Category, token.Escaped(), token.Category)
+		}
+		got.WriteString("</tokens>\n")
+		if s.Err() != nil {
+			t.Errorf("Unexpected error for %s: %v", path, s.Err())
+		}
+		if got.String() != strings.ReplaceAll(string(want), "\r\n", "\n") {
+			t.Errorf("Tokens of %s were incorrect, got:\n%s", path, got.String())
+		}
+	}
+}
+
+// FuzzScanner checks that any source is split into tokens or stops at an error without
+// panicking, and that the positions of the tokens never go back.
+func FuzzScanner(f *testing.F) {
+	for _, pattern := range []string{"../../10/*/*.jack", "../../11/*/*.jack", "../../12/*.jack", "../../12/*/*.jack"} {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, path := range paths {
+			source, err := os.ReadFile(path)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(string(source), uint8(0))
+		}
+	}
+	f.Add(`const char C = '\n'; for (;;) { break; } a && b`, uint8(Extended))
+	f.Fuzz(func(t *testing.T, source string, mode uint8) {
+		s := NewModeScanner(strings.NewReader(source), Mode(mode)&(Extended|Comments))
+		last := Pos{1, 1}
+		for token := s.Next(); token.Category != EOF; token = s.Next() {
+			if token.Pos.Line < last.Line || token.Pos.Line == last.Line && token.Pos.Column < last.Column {
+				t.Fatalf("Position of %q was incorrect, got: %s, wanted: after %s", token.Value, token.Pos, last)
+			}
+			last = token.Pos
+			if token.Category == StringConst || token.Category == CharConst {
+				CharCodes(token.Value, Mode(mode)&Extended)
+			}
+		}
+	})
+}
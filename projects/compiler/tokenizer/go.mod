@@ -1,3 +1,3 @@
 module tokenizer
 
-go 1.13
+go 1.18
@@ -0,0 +1,144 @@
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The Hack memory map, the screen and keyboard are mapped into RAM.
+const (
+	Screen   = 16384
+	Keyboard = 24576
+	RAMSize  = 32768
+)
+
+// jump is the unconditional jump 0;JMP, which with the A instruction before it makes the loop
+// programs halt in.
+const jump = 0xea87
+
+// Computer is the Hack computer: a CPU running the machine code of its ROM over a RAM that holds
+// the screen and keyboard memory maps. Keys are pressed by writing RAM[Keyboard].
+type Computer struct {
+	ROM []uint16
+	RAM []int16
+	A   int16
+	D   int16
+	PC  int
+}
+
+func New(rom []uint16) *Computer {
+	return &Computer{ROM: rom, RAM: make([]int16, RAMSize)}
+}
+
+// ReadHack reads the machine code of a .hack file, one 16 character line of 0s and 1s per
+// instruction.
+func ReadHack(r io.Reader) ([]uint16, error) {
+	var rom []uint16
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		instruction, err := strconv.ParseUint(text, 2, 16)
+		if err != nil || len(text) != 16 {
+			return nil, fmt.Errorf("line %d: invalid instruction %s", line, text)
+		}
+		rom = append(rom, uint16(instruction))
+	}
+	return rom, scanner.Err()
+}
+
+// Reset clears RAM and the registers, keeping the program.
+func (c *Computer) Reset() {
+	for i := range c.RAM {
+		c.RAM[i] = 0
+	}
+	c.A, c.D, c.PC = 0, 0, 0
+}
+
+// Halted reports whether the computer is in an infinite loop of the form "(L) @L 0;JMP", the way
+// Hack programs end.
+func (c *Computer) Halted() bool {
+	return c.PC+1 < len(c.ROM) && c.ROM[c.PC] == uint16(c.PC) && c.ROM[c.PC+1] == jump
+}
+
+// Run executes instructions until the computer halts or steps instructions have run.
+func (c *Computer) Run(steps int) error {
+	for i := 0; i < steps && !c.Halted(); i++ {
+		if err := c.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step executes a single instruction.
+func (c *Computer) Step() error {
+	if c.PC < 0 || c.PC >= len(c.ROM) {
+		return fmt.Errorf("program counter %d is outside the ROM", c.PC)
+	}
+	instruction := c.ROM[c.PC]
+	if instruction&0x8000 == 0 {
+		c.A = int16(instruction)
+		c.PC++
+		return nil
+	}
+	address := int(uint16(c.A))
+	y := c.A
+	if instruction&0x1000 != 0 {
+		if address >= RAMSize {
+			return fmt.Errorf("%d: address %d is outside the RAM", c.PC, address)
+		}
+		y = c.RAM[address]
+	}
+	out := alu(c.D, y, instruction>>6&0x3f)
+	if instruction&0x08 != 0 {
+		if address >= RAMSize {
+			return fmt.Errorf("%d: address %d is outside the RAM", c.PC, address)
+		}
+		c.RAM[address] = out
+	}
+	if instruction&0x10 != 0 {
+		c.D = out
+	}
+	if instruction&0x20 != 0 {
+		c.A = out
+	}
+	if out < 0 && instruction&0x4 != 0 || out == 0 && instruction&0x2 != 0 || out > 0 && instruction&0x1 != 0 {
+		c.PC = address
+	} else {
+		c.PC++
+	}
+	return nil
+}
+
+// alu computes the function selected by the control bits zx nx zy ny f no of x, the D register,
+// and y, the A register or the memory word it addresses.
+func alu(x int16, y int16, control uint16) int16 {
+	if control&0x20 != 0 {
+		x = 0
+	}
+	if control&0x10 != 0 {
+		x = ^x
+	}
+	if control&0x08 != 0 {
+		y = 0
+	}
+	if control&0x04 != 0 {
+		y = ^y
+	}
+	var out int16
+	if control&0x02 != 0 {
+		out = x + y
+	} else {
+		out = x & y
+	}
+	if control&0x01 != 0 {
+		out = ^out
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStep(t *testing.T) {
+	instructions := []struct {
+		code    string
+		a, d    int16
+		pc      int
+		address int16
+	}{
+		{"0000000000000111", 7, 5, 1, 0},   // @7
+		{"1110110000010000", 3, 3, 1, 0},   // D=A
+		{"1111110111001000", 3, 5, 1, 10},  // M=M+1
+		{"1110010011010000", 3, 2, 1, 0},   // D=D-A
+		{"1110001101100000", -6, 5, 1, 0},  // A=!D
+		{"1111000010110000", 14, 14, 1, 0}, // AD=D+M
+		{"1110001100000001", 3, 5, 3, 0},   // D;JGT
+		{"1110001100000100", 3, 5, 1, 0},   // D;JLT
+		{"1110101010000111", 3, 5, 3, 0},   // 0;JMP
+	}
+	for _, inst := range instructions {
+		rom, err := ReadHack(strings.NewReader(inst.code))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := New(rom)
+		c.A, c.D, c.RAM[3] = 3, 5, 9
+		if err := c.Step(); err != nil {
+			t.Errorf("%s failed: %v", inst.code, err)
+			continue
+		}
+		if c.A != inst.a || c.D != inst.d || c.PC != inst.pc || (inst.address != 0 && c.RAM[3] != inst.address) {
+			t.Errorf("State after %s was incorrect, got: A=%d D=%d PC=%d RAM[3]=%d, wanted: A=%d D=%d PC=%d RAM[3]=%d", inst.code, c.A, c.D, c.PC, c.RAM[3], inst.a, inst.d, inst.pc, inst.address)
+		}
+	}
+}
+
+func TestPrograms(t *testing.T) {
+	programs := []struct {
+		path   string
+		inputs []int16
+		want   int16
+	}{
+		{filepath.Join("..", "06", "max", "Max.hack"), []int16{3, 5}, 5},
+		{filepath.Join("..", "06", "max", "Max.hack"), []int16{-1, -7}, -1},
+		{filepath.Join("..", "04", "mult", "Mult.hack"), []int16{6, 7}, 42},
+		{filepath.Join("..", "04", "mult", "Mult.hack"), []int16{0, 7}, 0},
+	}
+	for _, p := range programs {
+		file, err := os.Open(p.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rom, err := ReadHack(file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := New(rom)
+		c.RAM[0], c.RAM[1] = p.inputs[0], p.inputs[1]
+		if err := c.Run(1000); err != nil {
+			t.Errorf("%s failed: %v", p.path, err)
+			continue
+		}
+		if !c.Halted() {
+			t.Errorf("%s did not halt", p.path)
+		}
+		if c.RAM[2] != p.want {
+			t.Errorf("R2 of %s with %v was incorrect, got: %d, wanted: %d", p.path, p.inputs, c.RAM[2], p.want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	programs := []struct {
+		code string
+		err  string
+	}{
+		{"0000000000000001\n101", "line 2: invalid instruction 101"},
+		{"0000000000000001\n000000000000000x", "line 2: invalid instruction 000000000000000x"},
+	}
+	for _, p := range programs {
+		_, err := ReadHack(strings.NewReader(p.code))
+		if err == nil || err.Error() != p.err {
+			t.Errorf("Error of %q was incorrect, got: %v, wanted: %s", p.code, err, p.err)
+		}
+	}
+
+	// A=-1 then M=0 writes outside of the RAM
+	c := New([]uint16{0xeca0, 0xea88})
+	c.Step()
+	if err := c.Step(); err == nil || err.Error() != "1: address 65535 is outside the RAM" {
+		t.Errorf("Error of M=0 at A=-1 was incorrect, got: %v, wanted: 1: address 65535 is outside the RAM", err)
+	}
+	c = New(nil)
+	if err := c.Step(); err == nil || err.Error() != "program counter 0 is outside the ROM" {
+		t.Errorf("Error of an empty ROM was incorrect, got: %v, wanted: program counter 0 is outside the ROM", err)
+	}
+}
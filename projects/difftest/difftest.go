@@ -0,0 +1,421 @@
+package difftest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"example.com/assembler"
+	"example.com/compiler"
+	"example.com/cpu"
+	"example.com/interp"
+	"vm/interpreter"
+	"vm/translater"
+)
+
+// The RAM of the translated code that the VM has no counterpart for.
+const (
+	// R13 to R15 are the scratch registers of the translated code.
+	scratchBase = 13
+	scratchEnd  = 16
+	heapBase    = 2048
+)
+
+// defaultMaxSteps bounds the VM commands a program may run when Program.MaxSteps is 0.
+const defaultMaxSteps = 50000000
+
+// maxInstructions bounds the instructions the CPU may run for a single VM command, the
+// translation of a command that takes longer has lost its way.
+const maxInstructions = 100000
+
+// Program is a Jack program to run at the three levels: interpreted from its source, compiled
+// and run on the VM interpreter, and translated to machine code run on the CPU emulator.
+type Program struct {
+	// Dir is the folder of the program's .jack files.
+	Dir string
+	// OS is the folder of the VM code of the Jack OS, linked for the classes the program does not
+	// implement.
+	OS string
+	// Input is the text typed on the keyboard, a newline is the newline key.
+	Input string
+	// RAM holds words set before the program starts, such as an input it reads from memory.
+	RAM map[int]int16
+	// Compare lists the ranges of RAM, besides the screen, in which the Jack interpreter must end
+	// with the values of the compiled program. Its heap is laid out by an OS written in Go, so only
+	// the words the program itself places are comparable.
+	Compare []Range
+	// MaxSteps bounds the number of VM commands the program may run, 0 means 50 million.
+	MaxSteps int
+}
+
+// Range is the words of RAM from From to To, inclusive.
+type Range struct {
+	From int
+	To   int
+}
+
+// Divergence is a word of RAM that two levels disagree on. Levels are named jack, vm and cpu.
+type Divergence struct {
+	Levels [2]string
+	// Command is the VM command after which the levels diverged, as "File.vm:line: command". It is
+	// empty when the difference was found comparing the final states.
+	Command string
+	Address int
+	Values  [2]int16
+}
+
+func (d *Divergence) Error() string {
+	where := "at the end"
+	if d.Command != "" {
+		where = "after " + d.Command
+	}
+	return fmt.Sprintf("%s and %s diverge %s: RAM[%d] is %d in %s and %d in %s", d.Levels[0], d.Levels[1], where,
+		d.Address, d.Values[0], d.Levels[0], d.Values[1], d.Levels[1])
+}
+
+// Run runs the program at the three levels and returns a *Divergence if they disagree. The VM
+// and the CPU run in lockstep, one VM command at a time, until the program calls Sys.halt; their
+// registers, the top of the stack and the word a command pops to are compared after every
+// command, and the whole RAM at the end. The Jack interpreter runs the program to its end and is
+// compared with the VM on the screen and the ranges of Compare.
+func Run(p Program) error {
+	m, err := load(p)
+	if err != nil {
+		return err
+	}
+	if err := m.lockstep(); err != nil {
+		return err
+	}
+	if err := m.compareEnd(); err != nil {
+		return err
+	}
+	return m.compareJack()
+}
+
+// machines are the VM and the CPU running the same program. addresses maps each VM command to
+// the ROM address of its translation. keys are the keys still to type, the first one is held
+// down while pressed is set.
+type machines struct {
+	program   Program
+	vm        *interpreter.VM
+	cpu       *cpu.Computer
+	addresses []int
+	keys      []int16
+	pressed   bool
+}
+
+// load compiles the program in a temporary folder, then loads its VM code with the OS into the
+// VM and its machine code into the CPU, both ready to run Sys.init.
+func load(p Program) (*machines, error) {
+	tmp, err := ioutil.TempDir("", "difftest")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, filepath.Base(p.Dir))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	sources, err := filepath.Glob(filepath.Join(p.Dir, "*.jack"))
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range sources {
+		data, err := ioutil.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.Base(source)), data, 0644); err != nil {
+			return nil, err
+		}
+	}
+	if err := compiler.Compile(dir, compiler.Options{}); err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.vm"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	implemented := make(map[string]bool)
+	for _, path := range paths {
+		implemented[filepath.Base(path)] = true
+	}
+	osPaths, err := filepath.Glob(filepath.Join(p.OS, "*.vm"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(osPaths)
+	for _, path := range osPaths {
+		if !implemented[filepath.Base(path)] {
+			paths = append(paths, path)
+		}
+	}
+
+	m := &machines{program: p, vm: interpreter.New()}
+	var asm bytes.Buffer
+	program, err := translater.NewProgram(&asm)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".vm")
+		if err := m.vm.Load(name, bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		if err := program.Translate(name, bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+	}
+	m.addresses = program.Addresses()
+	var hack bytes.Buffer
+	if err := assembler.Assemble(&asm, &hack); err != nil {
+		return nil, err
+	}
+	rom, err := cpu.ReadHack(&hack)
+	if err != nil {
+		return nil, err
+	}
+	m.cpu = cpu.New(rom)
+
+	for _, key := range p.Input {
+		m.keys = append(m.keys, keyCode(key))
+	}
+	m.vm.Reset()
+	for address, value := range p.RAM {
+		m.vm.RAM[address] = value
+		m.cpu.RAM[address] = value
+	}
+	if err := m.vm.Start("Sys.init"); err != nil {
+		return nil, err
+	}
+	// the CPU runs the bootstrap code up to Sys.init
+	if err := m.follow(); err != nil {
+		return nil, fmt.Errorf("cpu: bootstrap: %v", err)
+	}
+	return m, nil
+}
+
+// keyCode is the Hack key code of a character typed, as the Jack interpreter reads it.
+func keyCode(key rune) int16 {
+	switch key {
+	case '\n':
+		return 128
+	case '\b', 127:
+		return 129
+	}
+	return int16(key)
+}
+
+// lockstep runs the VM one command at a time up to the call of Sys.halt, the CPU following it
+// to the translation of the next command. After each command the machines are compared and the
+// keyboard is updated if the command read it.
+func (m *machines) lockstep() error {
+	maxSteps := m.program.MaxSteps
+	if maxSteps == 0 {
+		maxSteps = defaultMaxSteps
+	}
+	for steps := 0; ; steps++ {
+		pc, command := m.vm.PC()
+		if pc < 0 || strings.HasPrefix(command, "function Sys.halt ") {
+			return nil
+		}
+		if steps == maxSteps {
+			return fmt.Errorf("stopped after %d VM commands", steps)
+		}
+		destination := m.destination(command)
+		if err := m.vm.Step(); err != nil {
+			return fmt.Errorf("vm: %v", err)
+		}
+		if err := m.follow(); err != nil {
+			return fmt.Errorf("cpu: %s: %s: %v", m.vm.Source(pc), command, err)
+		}
+		if d := m.compareStep(destination); d != nil {
+			d.Command = fmt.Sprintf("%s: %s", m.vm.Source(pc), command)
+			return d
+		}
+		if m.readsKeyboard(command) {
+			m.typeKey()
+		}
+	}
+}
+
+// follow runs the CPU up to the translation of the VM's next command.
+func (m *machines) follow() error {
+	pc, _ := m.vm.PC()
+	if pc < 0 {
+		return nil
+	}
+	target := m.addresses[pc]
+	for i := 0; m.cpu.PC != target; i++ {
+		if i == maxInstructions {
+			return fmt.Errorf("did not reach ROM address %d after %d instructions", target, i)
+		}
+		if err := m.cpu.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// operand splits a push or pop command into its segment and index.
+func operand(command string) (string, string, int) {
+	fields := strings.Fields(command)
+	if len(fields) != 3 {
+		return "", "", 0
+	}
+	index, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return "", "", 0
+	}
+	return fields[0], fields[1], index
+}
+
+// destination is the address a pop command is about to write, -1 for any other command. A pop
+// to a static variable returns StaticBase, all the statics are compared then.
+func (m *machines) destination(command string) int {
+	kind, segment, index := operand(command)
+	if kind != "pop" {
+		return -1
+	}
+	ram := m.vm.RAM
+	switch segment {
+	case "local":
+		return int(ram[interpreter.LCL]) + index
+	case "argument":
+		return int(ram[interpreter.ARG]) + index
+	case "this":
+		return int(uint16(ram[interpreter.THIS])) + index
+	case "that":
+		return int(uint16(ram[interpreter.THAT])) + index
+	case "pointer":
+		return interpreter.THIS + index
+	case "temp":
+		return interpreter.TempBase + index
+	case "static":
+		return interpreter.StaticBase
+	}
+	return -1
+}
+
+// compareStep compares the words a command can change: the registers, the top of the stack
+// and the destination of a pop.
+func (m *machines) compareStep(destination int) *Divergence {
+	for address := 0; address < scratchBase; address++ {
+		if d := m.compare(address); d != nil {
+			return d
+		}
+	}
+	if sp := int(m.vm.RAM[interpreter.SP]); sp > interpreter.StackBase {
+		if d := m.compare(sp - 1); d != nil {
+			return d
+		}
+	}
+	if destination == interpreter.StaticBase {
+		for address := interpreter.StaticBase; address < interpreter.StackBase; address++ {
+			if d := m.compare(address); d != nil {
+				return d
+			}
+		}
+	} else if destination >= 0 && destination < interpreter.RAMSize {
+		return m.compare(destination)
+	}
+	return nil
+}
+
+func (m *machines) compare(address int) *Divergence {
+	if m.vm.RAM[address] != m.cpu.RAM[address] {
+		return &Divergence{Levels: [2]string{"vm", "cpu"}, Address: address, Values: [2]int16{m.vm.RAM[address], m.cpu.RAM[address]}}
+	}
+	return nil
+}
+
+// compareEnd compares the whole RAM except for the words the machines use differently: the
+// scratch registers, the stack above its pointer and the return addresses, which are command
+// numbers on the VM and ROM addresses on the CPU.
+func (m *machines) compareEnd() error {
+	ram := m.vm.RAM
+	skip := make(map[int]bool)
+	for frame := int(ram[interpreter.LCL]); frame > interpreter.StackBase; frame = int(ram[frame-4]) {
+		skip[frame-5] = true
+	}
+	sp := int(ram[interpreter.SP])
+	for address := range ram {
+		if address >= scratchBase && address < scratchEnd || address >= sp && address < heapBase || skip[address] {
+			continue
+		}
+		if d := m.compare(address); d != nil {
+			return d
+		}
+	}
+	return nil
+}
+
+// readsKeyboard reports whether the command just run pushed the keyboard's word.
+func (m *machines) readsKeyboard(command string) bool {
+	kind, segment, index := operand(command)
+	if kind != "push" || segment != "this" && segment != "that" {
+		return false
+	}
+	pointer := interpreter.THIS
+	if segment == "that" {
+		pointer = interpreter.THAT
+	}
+	return int(uint16(m.vm.RAM[pointer]))+index == interpreter.Keyboard
+}
+
+// typeKey types the input one key at a time as the program reads the keyboard: a key is
+// pressed until the program has seen it, then released until the program has seen that too,
+// which is what Keyboard.readChar waits for.
+func (m *machines) typeKey() {
+	var key int16
+	if m.pressed {
+		m.pressed = false
+		m.keys = m.keys[1:]
+	} else if len(m.keys) > 0 {
+		m.pressed = true
+		key = m.keys[0]
+	}
+	m.vm.RAM[interpreter.Keyboard] = key
+	m.cpu.RAM[interpreter.Keyboard] = key
+}
+
+// compareJack runs the program on the Jack interpreter and compares its screen and the ranges
+// of Compare with the VM's.
+func (m *machines) compareJack() error {
+	p := m.program
+	in := interp.New(0)
+	if err := in.LoadDir(p.Dir); err != nil {
+		return err
+	}
+	in.MaxSteps = p.MaxSteps
+	if in.MaxSteps == 0 {
+		in.MaxSteps = defaultMaxSteps
+	}
+	in.Input = strings.NewReader(p.Input)
+	for address, value := range p.RAM {
+		in.RAM[address] = value
+	}
+	if _, err := in.Call("Sys.init"); err != nil && !in.Halted() {
+		return fmt.Errorf("jack: %v", err)
+	}
+	ranges := append([]Range{{interp.Screen, interp.Keyboard - 1}}, p.Compare...)
+	for _, r := range ranges {
+		for address := r.From; address <= r.To; address++ {
+			if in.RAM[address] != m.vm.RAM[address] {
+				return &Divergence{Levels: [2]string{"jack", "vm"}, Address: address, Values: [2]int16{in.RAM[address], m.vm.RAM[address]}}
+			}
+		}
+	}
+	return nil
+}
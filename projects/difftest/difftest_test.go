@@ -0,0 +1,41 @@
+package difftest
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func program(name string) Program {
+	return Program{Dir: filepath.Join("..", "11", name), OS: filepath.Join("..", "build", "os")}
+}
+
+func TestPrograms(t *testing.T) {
+	average := program("Average")
+	average.Input = "3\n10\n20\n33\n"
+	convertToBin := program("ConvertToBin")
+	convertToBin.RAM = map[int]int16{8000: 0x5aa5}
+	convertToBin.Compare = []Range{{8000, 8016}}
+	for _, p := range []Program{program("Seven"), convertToBin, average, program("ComplexArrays")} {
+		if err := Run(p); err != nil {
+			t.Errorf("%s failed: %v", filepath.Base(p.Dir), err)
+		}
+	}
+}
+
+func TestDivergence(t *testing.T) {
+	m, err := load(program("Seven"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fourth command of Main.main is push constant 3, the CPU is made to push 4
+	address := m.addresses[3]
+	if m.cpu.ROM[address] != 3 {
+		t.Fatalf("Instruction of push constant 3 was incorrect, got: %016b, wanted: @3", m.cpu.ROM[address])
+	}
+	m.cpu.ROM[address] = 4
+	err = m.lockstep()
+	want := "vm and cpu diverge after Main.vm:4: push constant 3: RAM[268] is 3 in vm and 4 in cpu"
+	if err == nil || err.Error() != want {
+		t.Errorf("Divergence was incorrect, got: %v, wanted: %s", err, want)
+	}
+}
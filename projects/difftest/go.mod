@@ -0,0 +1,33 @@
+module difftest
+
+go 1.13
+
+require (
+	example.com/assembler v0.0.0
+	example.com/ast v0.0.0
+	example.com/cache v0.0.0
+	example.com/compiler v0.0.0
+	example.com/cpu v0.0.0
+	example.com/engine v0.0.0
+	example.com/interp v0.0.0
+	example.com/tokenizer v0.0.0
+	example.com/writer v0.0.0
+	vm/interpreter v0.0.0
+	vm/parser v0.0.0
+	vm/translater v0.0.0
+)
+
+replace (
+	example.com/assembler => ../assembler
+	example.com/ast => ../compiler/ast
+	example.com/cache => ../compiler/cache
+	example.com/compiler => ../compiler
+	example.com/cpu => ../cpu
+	example.com/engine => ../compiler/engine
+	example.com/interp => ../compiler/interp
+	example.com/tokenizer => ../compiler/tokenizer
+	example.com/writer => ../compiler/writer
+	vm/interpreter => ../vm/interpreter
+	vm/parser => ../vm/parser
+	vm/translater => ../vm/translater
+)
@@ -0,0 +1,172 @@
+package hdl
+
+import (
+	"strconv"
+	"strings"
+)
+
+// builtin is a chip implemented in Go, used when the folder of a chip has no .hdl file for a part.
+// eval computes the outputs from the inputs, both in the order of the declaration of the pins.
+// Clocked chips have a state per part instead, made by newState, and their outputs do not depend
+// on the inputs listed in clocked, which they only read at ticks.
+type builtin struct {
+	in, out  []Pin
+	eval     func(in, out []uint16)
+	clocked  []string
+	newState func() state
+}
+
+// pins declares pins the way IN and OUT do, "a b[16]" is the pin a and the 16 bit bus b.
+func pins(declaration string) []Pin {
+	var pins []Pin
+	for _, field := range strings.Fields(declaration) {
+		pin := Pin{Name: field, Width: 1}
+		if i := strings.Index(field, "["); i >= 0 {
+			pin.Name = field[:i]
+			pin.Width, _ = strconv.Atoi(field[i+1 : len(field)-1])
+		}
+		pins = append(pins, pin)
+	}
+	return pins
+}
+
+func bit(b bool) uint16 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// dmux sends in to the output of index sel, the others are 0.
+func dmux(in uint16, sel uint16, out []uint16) {
+	for i := range out {
+		out[i] = 0
+	}
+	out[sel] = in
+}
+
+// The outputs are masked to the width of their pin after eval, so the gates can compute on whole
+// words.
+var builtins = map[string]*builtin{
+	"Nand": {in: pins("a b"), out: pins("out"), eval: func(in, out []uint16) {
+		out[0] = ^(in[0] & in[1])
+	}},
+	"Not": {in: pins("in"), out: pins("out"), eval: func(in, out []uint16) {
+		out[0] = ^in[0]
+	}},
+	"And": {in: pins("a b"), out: pins("out"), eval: func(in, out []uint16) {
+		out[0] = in[0] & in[1]
+	}},
+	"Or": {in: pins("a b"), out: pins("out"), eval: func(in, out []uint16) {
+		out[0] = in[0] | in[1]
+	}},
+	"Xor": {in: pins("a b"), out: pins("out"), eval: func(in, out []uint16) {
+		out[0] = in[0] ^ in[1]
+	}},
+	"Mux": {in: pins("a b sel"), out: pins("out"), eval: func(in, out []uint16) {
+		out[0] = in[in[2]]
+	}},
+	"DMux": {in: pins("in sel"), out: pins("a b"), eval: func(in, out []uint16) {
+		dmux(in[0], in[1], out)
+	}},
+	"Not16": {in: pins("in[16]"), out: pins("out[16]"), eval: func(in, out []uint16) {
+		out[0] = ^in[0]
+	}},
+	"And16": {in: pins("a[16] b[16]"), out: pins("out[16]"), eval: func(in, out []uint16) {
+		out[0] = in[0] & in[1]
+	}},
+	"Or16": {in: pins("a[16] b[16]"), out: pins("out[16]"), eval: func(in, out []uint16) {
+		out[0] = in[0] | in[1]
+	}},
+	"Mux16": {in: pins("a[16] b[16] sel"), out: pins("out[16]"), eval: func(in, out []uint16) {
+		out[0] = in[in[2]]
+	}},
+	"Or8Way": {in: pins("in[8]"), out: pins("out"), eval: func(in, out []uint16) {
+		out[0] = bit(in[0] != 0)
+	}},
+	"Mux4Way16": {in: pins("a[16] b[16] c[16] d[16] sel[2]"), out: pins("out[16]"), eval: func(in, out []uint16) {
+		out[0] = in[in[4]]
+	}},
+	"Mux8Way16": {in: pins("a[16] b[16] c[16] d[16] e[16] f[16] g[16] h[16] sel[3]"), out: pins("out[16]"), eval: func(in, out []uint16) {
+		out[0] = in[in[8]]
+	}},
+	"DMux4Way": {in: pins("in sel[2]"), out: pins("a b c d"), eval: func(in, out []uint16) {
+		dmux(in[0], in[1], out)
+	}},
+	"DMux8Way": {in: pins("in sel[3]"), out: pins("a b c d e f g h"), eval: func(in, out []uint16) {
+		dmux(in[0], in[1], out)
+	}},
+	"HalfAdder": {in: pins("a b"), out: pins("sum carry"), eval: func(in, out []uint16) {
+		out[0], out[1] = in[0]^in[1], in[0]&in[1]
+	}},
+	"FullAdder": {in: pins("a b c"), out: pins("sum carry"), eval: func(in, out []uint16) {
+		sum := in[0] + in[1] + in[2]
+		out[0], out[1] = sum, sum>>1
+	}},
+	"Add16": {in: pins("a[16] b[16]"), out: pins("out[16]"), eval: func(in, out []uint16) {
+		out[0] = in[0] + in[1]
+	}},
+	"Inc16": {in: pins("in[16]"), out: pins("out[16]"), eval: func(in, out []uint16) {
+		out[0] = in[0] + 1
+	}},
+	"ALU": {in: pins("x[16] y[16] zx nx zy ny f no"), out: pins("out[16] zr ng"), eval: func(in, out []uint16) {
+		x, y := in[0], in[1]
+		if in[2] != 0 {
+			x = 0
+		}
+		if in[3] != 0 {
+			x = ^x
+		}
+		if in[4] != 0 {
+			y = 0
+		}
+		if in[5] != 0 {
+			y = ^y
+		}
+		if in[6] != 0 {
+			out[0] = x + y
+		} else {
+			out[0] = x & y
+		}
+		if in[7] != 0 {
+			out[0] = ^out[0]
+		}
+		out[1], out[2] = bit(out[0] == 0), out[0]>>15
+	}},
+	"DFF": {in: pins("in"), out: pins("out"), clocked: []string{"in"}, newState: func() state {
+		return &register{alwaysLoads: true}
+	}},
+	"Bit":       registerBuiltin("in load", "out"),
+	"Register":  registerBuiltin("in[16] load", "out[16]"),
+	"ARegister": registerBuiltin("in[16] load", "out[16]"),
+	"DRegister": registerBuiltin("in[16] load", "out[16]"),
+	"PC": {in: pins("in[16] load inc reset"), out: pins("out[16]"), clocked: []string{"in", "load", "inc", "reset"}, newState: func() state {
+		return &counter{}
+	}},
+	"RAM8":   ramBuiltin(3),
+	"RAM64":  ramBuiltin(6),
+	"RAM512": ramBuiltin(9),
+	"RAM4K":  ramBuiltin(12),
+	"RAM16K": ramBuiltin(14),
+	"Screen": ramBuiltin(13),
+	"ROM32K": {in: pins("address[15]"), out: pins("out[16]"), newState: func() state {
+		return &memory{words: make([]uint16, 1<<15)}
+	}},
+	"Keyboard": {out: pins("out[16]"), newState: func() state {
+		return &memory{words: make([]uint16, 1), addressPin: -1}
+	}},
+}
+
+func registerBuiltin(in string, out string) *builtin {
+	return &builtin{in: pins(in), out: pins(out), clocked: []string{"in", "load"}, newState: func() state {
+		return &register{}
+	}}
+}
+
+// ramBuiltin is a RAM of 2^addressWidth words.
+func ramBuiltin(addressWidth int) *builtin {
+	in := pins("in[16] load address[" + strconv.Itoa(addressWidth) + "]")
+	return &builtin{in: in, out: pins("out[16]"), clocked: []string{"in", "load"}, newState: func() state {
+		return &memory{words: make([]uint16, 1<<uint(addressWidth)), addressPin: 2, writable: true}
+	}}
+}
@@ -0,0 +1,585 @@
+package hdl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Chip is a chip ready to simulate: its parts flattened down to builtin chips and the wires
+// between their pins, sorted so that every node comes after the nodes computing its inputs. An
+// evaluation is then a single pass over the nodes.
+type Chip struct {
+	Name  string
+	In    []Pin
+	Out   []Pin
+	pins  map[string]net
+	nodes []node
+	// clocked holds the parts of clocked builtin chips, in the order of the chip's definition
+	clocked []*gate
+	// values holds a word per net, the bits above the width of the net are 0
+	values []uint16
+}
+
+// net is a value of the chip: a pin of the chip, of one of its parts or an internal pin.
+type net struct {
+	index int
+	width int
+}
+
+// The constants true and false are the first two nets.
+const (
+	falseNet = iota
+	trueNet
+)
+
+// node computes some of the values of a chip from others.
+type node interface {
+	eval(values []uint16)
+	reads() []int
+	writes() []int
+}
+
+// gate is a builtin part, with its state when the chip is clocked. combinational holds the inputs
+// its outputs depend on.
+type gate struct {
+	name          string
+	builtin       *builtin
+	state         state
+	in, out       []int
+	combinational []int
+	inValues      []uint16
+	outValues     []uint16
+}
+
+func (g *gate) eval(values []uint16) {
+	g.read(values)
+	if g.state != nil {
+		g.state.eval(g.inValues, g.outValues)
+	} else {
+		g.builtin.eval(g.inValues, g.outValues)
+	}
+	for i, index := range g.out {
+		values[index] = g.outValues[i] & mask(g.builtin.out[i].Width)
+	}
+}
+
+func (g *gate) read(values []uint16) {
+	for i, index := range g.in {
+		g.inValues[i] = values[index]
+	}
+}
+
+func (g *gate) reads() []int  { return g.combinational }
+func (g *gate) writes() []int { return g.out }
+
+// wire copies width bits of the net from, starting at bit fromLo, into the net to at bit toLo.
+type wire struct {
+	from, to     int
+	fromLo, toLo int
+	width        int
+}
+
+func (w *wire) eval(values []uint16) {
+	m := mask(w.width) << w.toLo
+	values[w.to] = values[w.to]&^m | values[w.from]>>w.fromLo<<w.toLo&m
+}
+
+func (w *wire) reads() []int  { return []int{w.from} }
+func (w *wire) writes() []int { return []int{w.to} }
+
+func mask(width int) uint16 {
+	return uint16(1<<uint(width) - 1)
+}
+
+// Load builds the chip name from its .hdl file in dir. Its parts are the chips of the .hdl files
+// of dir, or the builtin chips for the ones dir does not have, and so is the chip itself.
+func Load(dir string, name string) (*Chip, error) {
+	b := &builder{dir: dir, defs: make(map[string]*ChipDef), widths: []int{maxWidth, maxWidth}}
+	def, err := b.def(name)
+	if err != nil {
+		return nil, err
+	}
+	pins := make(map[string]net)
+	if def == nil {
+		builtin := builtins[name]
+		if builtin == nil {
+			return nil, fmt.Errorf("no chip %s in %s", name, dir)
+		}
+		def = &ChipDef{Name: name, In: builtin.in, Out: builtin.out}
+		b.pins(def.In, def.Out, pins)
+		b.add(b.gate(name, builtin, pins), name)
+	} else {
+		b.pins(def.In, def.Out, pins)
+		internal, err := b.instantiate(def, pins)
+		if err != nil {
+			return nil, err
+		}
+		for name, n := range internal {
+			pins[name] = n
+		}
+	}
+	nodes, err := b.sort()
+	if err != nil {
+		return nil, err
+	}
+	c := &Chip{Name: def.Name, In: def.In, Out: def.Out, pins: pins, nodes: nodes, clocked: b.clocked, values: make([]uint16, len(b.widths))}
+	c.values[trueNet] = mask(maxWidth)
+	c.Eval()
+	return c, nil
+}
+
+// Eval computes the values of the chip from its inputs.
+func (c *Chip) Eval() {
+	for _, n := range c.nodes {
+		n.eval(c.values)
+	}
+}
+
+// Tick raises the clock: the clocked parts read their inputs.
+func (c *Chip) Tick() {
+	c.Eval()
+	for _, g := range c.clocked {
+		g.read(c.values)
+		g.state.tick(g.inValues)
+	}
+	c.Eval()
+}
+
+// Tock lowers the clock: the clocked parts show their new state.
+func (c *Chip) Tock() {
+	for _, g := range c.clocked {
+		g.state.tock()
+	}
+	c.Eval()
+}
+
+// Press sets the key held down on the keyboards of the chip.
+func (c *Chip) Press(key int16) {
+	for _, g := range c.clocked {
+		if g.name == "Keyboard" {
+			word, _ := g.state.word(0)
+			*word = uint16(key)
+		}
+	}
+}
+
+// word returns the word of memory of a clocked part, RAM16K[3] is the word 3 of the first RAM16K
+// part of the chip and ARegister[] the value of the first ARegister.
+func (c *Chip) word(name string) (*uint16, error) {
+	i := strings.Index(name, "[")
+	if i < 0 || !strings.HasSuffix(name, "]") {
+		return nil, fmt.Errorf("%s has no pin %s", c.Name, name)
+	}
+	address := 0
+	if index := name[i+1 : len(name)-1]; index != "" {
+		var err error
+		if address, err = strconv.Atoi(index); err != nil {
+			return nil, fmt.Errorf("invalid address %s", index)
+		}
+	}
+	for _, g := range c.clocked {
+		if g.name == name[:i] {
+			word, ok := g.state.word(address)
+			if !ok {
+				return nil, fmt.Errorf("%s has no word %d", g.name, address)
+			}
+			return word, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no part %s", c.Name, name[:i])
+}
+
+// Set sets an input of the chip, keeping the bits that fit in its width, or a word of the memory
+// of one of its parts.
+func (c *Chip) Set(pin string, value int16) error {
+	if strings.Contains(pin, "[") {
+		word, err := c.word(pin)
+		if err != nil {
+			return err
+		}
+		*word = uint16(value)
+		return nil
+	}
+	if !c.isInput(pin) {
+		return fmt.Errorf("%s is not an input of %s", pin, c.Name)
+	}
+	n := c.pins[pin]
+	c.values[n.index] = uint16(value) & mask(n.width)
+	return nil
+}
+
+// Get returns the value of a pin of the chip, an input, an output or an internal pin, or of a
+// word of the memory of one of its parts.
+func (c *Chip) Get(pin string) (int16, error) {
+	if strings.Contains(pin, "[") {
+		word, err := c.word(pin)
+		if err != nil {
+			return 0, err
+		}
+		return int16(*word), nil
+	}
+	n, ok := c.pins[pin]
+	if !ok {
+		return 0, fmt.Errorf("%s has no pin %s", c.Name, pin)
+	}
+	return int16(c.values[n.index]), nil
+}
+
+func (c *Chip) isInput(pin string) bool {
+	for _, in := range c.In {
+		if in.Name == pin {
+			return true
+		}
+	}
+	return false
+}
+
+// builder flattens a chip into nodes.
+type builder struct {
+	dir  string
+	defs map[string]*ChipDef
+	// widths holds the width of each net
+	widths []int
+	nodes  []node
+	// places holds the part of each node, for the errors
+	places  []string
+	clocked []*gate
+	// loading holds the chips being instantiated, a chip cannot be one of its own parts
+	loading []string
+}
+
+func (b *builder) net(width int) net {
+	b.widths = append(b.widths, width)
+	return net{index: len(b.widths) - 1, width: width}
+}
+
+// pins adds a net to pins for each of the IN and OUT pins of a chip.
+func (b *builder) pins(in, out []Pin, pins map[string]net) {
+	for _, list := range [][]Pin{in, out} {
+		for _, pin := range list {
+			pins[pin.Name] = b.net(pin.Width)
+		}
+	}
+}
+
+// gate makes a part of a builtin chip whose pins are the nets of pins.
+func (b *builder) gate(name string, builtin *builtin, pins map[string]net) *gate {
+	g := &gate{name: name, builtin: builtin, inValues: make([]uint16, len(builtin.in)), outValues: make([]uint16, len(builtin.out))}
+	clocked := make(map[string]bool)
+	for _, pin := range builtin.clocked {
+		clocked[pin] = true
+	}
+	for _, pin := range builtin.in {
+		g.in = append(g.in, pins[pin.Name].index)
+		if !clocked[pin.Name] {
+			g.combinational = append(g.combinational, pins[pin.Name].index)
+		}
+	}
+	for _, pin := range builtin.out {
+		g.out = append(g.out, pins[pin.Name].index)
+	}
+	if builtin.newState != nil {
+		g.state = builtin.newState()
+		b.clocked = append(b.clocked, g)
+	}
+	return g
+}
+
+// def returns the definition of the chip name in the folder of the builder, nil when there is no
+// .hdl file for it.
+func (b *builder) def(name string) (*ChipDef, error) {
+	if def, ok := b.defs[name]; ok {
+		return def, nil
+	}
+	file, err := os.Open(filepath.Join(b.dir, name+".hdl"))
+	if os.IsNotExist(err) {
+		b.defs[name] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	def, err := Parse(name+".hdl", file)
+	if err != nil {
+		return nil, err
+	}
+	if def.Name != name {
+		return nil, fmt.Errorf("%s.hdl defines the chip %s", name, def.Name)
+	}
+	b.defs[name] = def
+	return def, nil
+}
+
+// part is a part of a chip being instantiated, with the nets of its pins.
+type part struct {
+	Part
+	def     *ChipDef
+	builtin *builtin
+	in, out []Pin
+	pins    map[string]net
+	// connected holds the bits of each input connected so far
+	connected map[string]uint16
+}
+
+func (p *part) pin(name string) (Pin, bool) {
+	for _, list := range [][]Pin{p.in, p.out} {
+		for _, pin := range list {
+			if pin.Name == name {
+				return pin, true
+			}
+		}
+	}
+	return Pin{}, false
+}
+
+func (p *part) isOutput(name string) bool {
+	for _, pin := range p.out {
+		if pin.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// instantiate adds the nodes of def, whose IN and OUT pins are the nets of pins, and returns its
+// internal pins.
+func (b *builder) instantiate(def *ChipDef, pins map[string]net) (map[string]net, error) {
+	for _, name := range b.loading {
+		if name == def.Name {
+			return nil, fmt.Errorf("%s: the chip %s is one of its own parts", strings.Join(b.loading, " > "), def.Name)
+		}
+	}
+	b.loading = append(b.loading, def.Name)
+	defer func() { b.loading = b.loading[:len(b.loading)-1] }()
+
+	errorf := func(line int, format string, args ...interface{}) error {
+		return fmt.Errorf("%s:%d: %s", def.File, line, fmt.Sprintf(format, args...))
+	}
+	parts := make([]*part, len(def.Parts))
+	for i, dp := range def.Parts {
+		p := &part{Part: dp, pins: make(map[string]net), connected: make(map[string]uint16)}
+		var err error
+		if p.def, err = b.def(dp.Name); err != nil {
+			return nil, err
+		}
+		if p.def != nil {
+			p.in, p.out = p.def.In, p.def.Out
+		} else if p.builtin = builtins[dp.Name]; p.builtin != nil {
+			p.in, p.out = p.builtin.in, p.builtin.out
+		} else {
+			return nil, errorf(dp.Line, "unknown chip %s", dp.Name)
+		}
+		b.pins(p.in, p.out, p.pins)
+		for _, c := range dp.Connections {
+			pin, ok := p.pin(c.Part.Name)
+			if !ok {
+				return nil, errorf(c.Line, "%s has no pin %s", dp.Name, c.Part.Name)
+			}
+			if err := checkBus(c.Part, pin.Width); err != nil {
+				return nil, errorf(c.Line, "%v", err)
+			}
+		}
+		parts[i] = p
+	}
+
+	isIn := make(map[string]bool)
+	for _, pin := range def.In {
+		isIn[pin.Name] = true
+	}
+	// the outputs of the parts come first, they define the internal pins
+	internal := make(map[string]net)
+	written := make(map[string]uint16)
+	for _, p := range parts {
+		for _, c := range p.Connections {
+			if !p.isOutput(c.Part.Name) {
+				continue
+			}
+			from := p.pins[c.Part.Name]
+			fromLo, width := bits(c.Part, from.width)
+			to, ok := pins[c.Chip.Name]
+			switch {
+			case c.Chip.Name == "true" || c.Chip.Name == "false":
+				return nil, errorf(c.Line, "the output %s of %s is connected to the constant %s", c.Part.Name, p.Name, c.Chip.Name)
+			case isIn[c.Chip.Name]:
+				return nil, errorf(c.Line, "%s is an input of %s, a part cannot write it", c.Chip.Name, def.Name)
+			case !ok && c.Chip.Sub:
+				return nil, errorf(c.Line, "%s is an internal pin, its bits cannot be selected", c.Chip.Name)
+			case !ok:
+				if _, ok := internal[c.Chip.Name]; !ok {
+					internal[c.Chip.Name] = b.net(width)
+				}
+				to = internal[c.Chip.Name]
+			}
+			toLo, toWidth := bits(c.Chip, to.width)
+			if err := checkBus(c.Chip, to.width); err != nil {
+				return nil, errorf(c.Line, "%v", err)
+			}
+			if width != toWidth {
+				return nil, errorf(c.Line, "%s and %s have different widths, %d and %d", c.Part, c.Chip, width, toWidth)
+			}
+			m := mask(width) << toLo
+			if written[c.Chip.Name]&m != 0 {
+				return nil, errorf(c.Line, "%s has more than one source", c.Chip)
+			}
+			written[c.Chip.Name] |= m
+			b.add(&wire{from: from.index, to: to.index, fromLo: fromLo, toLo: toLo, width: width}, place(def, p.Part))
+		}
+	}
+	for _, p := range parts {
+		for _, c := range p.Connections {
+			if p.isOutput(c.Part.Name) {
+				continue
+			}
+			to := p.pins[c.Part.Name]
+			toLo, width := bits(c.Part, to.width)
+			m := mask(width) << toLo
+			if p.connected[c.Part.Name]&m != 0 {
+				return nil, errorf(c.Line, "%s of %s is connected more than once", c.Part, p.Name)
+			}
+			p.connected[c.Part.Name] |= m
+			var from net
+			switch c.Chip.Name {
+			case "true":
+				from = net{index: trueNet, width: maxWidth}
+			case "false":
+				from = net{index: falseNet, width: maxWidth}
+			default:
+				var ok bool
+				if from, ok = pins[c.Chip.Name]; ok && !isIn[c.Chip.Name] {
+					return nil, errorf(c.Line, "%s is an output of %s, a part cannot read it", c.Chip.Name, def.Name)
+				}
+				if !ok {
+					if from, ok = internal[c.Chip.Name]; !ok {
+						return nil, errorf(c.Line, "undefined pin %s", c.Chip.Name)
+					}
+					if c.Chip.Sub {
+						return nil, errorf(c.Line, "%s is an internal pin, its bits cannot be selected", c.Chip.Name)
+					}
+				}
+				if err := checkBus(c.Chip, from.width); err != nil {
+					return nil, errorf(c.Line, "%v", err)
+				}
+				if _, fromWidth := bits(c.Chip, from.width); fromWidth != width {
+					return nil, errorf(c.Line, "%s and %s have different widths, %d and %d", c.Part, c.Chip, width, fromWidth)
+				}
+			}
+			fromLo, _ := bits(c.Chip, from.width)
+			b.add(&wire{from: from.index, to: to.index, fromLo: fromLo, toLo: toLo, width: width}, place(def, p.Part))
+		}
+	}
+
+	for _, p := range parts {
+		if p.def != nil {
+			if _, err := b.instantiate(p.def, p.pins); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		b.add(b.gate(p.Name, p.builtin, p.pins), place(def, p.Part))
+	}
+	return internal, nil
+}
+
+// bits returns the first bit and the number of bits a bus selects of a net of the given width.
+func bits(bus Bus, width int) (lo int, n int) {
+	if !bus.Sub {
+		return 0, width
+	}
+	return bus.Lo, bus.Hi - bus.Lo + 1
+}
+
+func checkBus(bus Bus, width int) error {
+	if bus.Sub && bus.Hi >= width {
+		return fmt.Errorf("%s is out of the %d bits of %s", bus, width, bus.Name)
+	}
+	return nil
+}
+
+func (b *builder) add(n node, place string) {
+	b.nodes = append(b.nodes, n)
+	b.places = append(b.places, place)
+}
+
+func place(def *ChipDef, p Part) string {
+	return fmt.Sprintf("%s at %s:%d", p.Name, def.File, p.Line)
+}
+
+// sort orders the nodes so that the nodes writing a net come before the ones reading it, which
+// fails when the parts form a combinational loop.
+func (b *builder) sort() ([]node, error) {
+	writers := make([][]int, len(b.widths))
+	for i, n := range b.nodes {
+		for _, index := range n.writes() {
+			writers[index] = append(writers[index], i)
+		}
+	}
+	next := make([][]int, len(b.nodes))
+	previous := make([][]int, len(b.nodes))
+	waiting := make([]int, len(b.nodes))
+	for i, n := range b.nodes {
+		for _, index := range n.reads() {
+			for _, w := range writers[index] {
+				next[w] = append(next[w], i)
+				previous[i] = append(previous[i], w)
+				waiting[i]++
+			}
+		}
+	}
+	var ready []int
+	for i := range b.nodes {
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	sorted := make([]node, 0, len(b.nodes))
+	for len(ready) > 0 {
+		i := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, b.nodes[i])
+		for _, j := range next[i] {
+			if waiting[j]--; waiting[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+	if len(sorted) == len(b.nodes) {
+		return sorted, nil
+	}
+
+	// every node left waits for another one left, going back from one of them ends in a loop
+	i := 0
+	for waiting[i] == 0 {
+		i++
+	}
+	seen := make(map[int]int)
+	var path []int
+	for {
+		if start, ok := seen[i]; ok {
+			path = path[start:]
+			break
+		}
+		seen[i] = len(path)
+		path = append(path, i)
+		for _, j := range previous[i] {
+			if waiting[j] > 0 {
+				i = j
+				break
+			}
+		}
+	}
+	var places []string
+	for k := len(path) - 1; k >= 0; k-- {
+		place := b.places[path[k]]
+		if len(places) == 0 || places[len(places)-1] != place {
+			places = append(places, place)
+		}
+	}
+	if len(places) > 1 && places[0] == places[len(places)-1] {
+		places = places[:len(places)-1]
+	}
+	return nil, fmt.Errorf("combinational loop through %s", strings.Join(places, ", "))
+}
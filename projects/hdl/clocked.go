@@ -0,0 +1,94 @@
+package hdl
+
+// state is the state of a part of a clocked builtin chip. At tick, when the clock rises, the part
+// reads its inputs, at tock, when it falls, it shows its new state on its outputs.
+type state interface {
+	eval(in, out []uint16)
+	tick(in []uint16)
+	tock()
+	// word returns the word of memory at address, false when the part has no such word
+	word(address int) (*uint16, bool)
+}
+
+// register is DFF, Bit and the registers: value takes in at tick when load is 1, always for a
+// DFF, and out takes value at tock. Scripts see value as the register's memory.
+type register struct {
+	value       uint16
+	out         uint16
+	alwaysLoads bool
+}
+
+func (r *register) eval(in, out []uint16) {
+	out[0] = r.out
+}
+
+func (r *register) tick(in []uint16) {
+	if r.alwaysLoads || in[1] != 0 {
+		r.value = in[0]
+	}
+}
+
+func (r *register) tock() {
+	r.out = r.value
+}
+
+func (r *register) word(address int) (*uint16, bool) {
+	return &r.value, address == 0
+}
+
+// counter is PC, a register that resets, loads in or increments, in this order of priority.
+type counter struct {
+	register
+}
+
+func (c *counter) tick(in []uint16) {
+	switch {
+	case in[3] != 0:
+		c.value = 0
+	case in[1] != 0:
+		c.value = in[0]
+	case in[2] != 0:
+		c.value++
+	}
+}
+
+// memory is the RAMs, the screen, the ROM and the keyboard. out is the word at the address input,
+// read at once. The writable memories take in at tick when load is 1 and store it at tock.
+type memory struct {
+	words []uint16
+	// addressPin is the index of the address input, -1 for the single word of the keyboard
+	addressPin int
+	writable   bool
+	// the write taken at tick
+	write   bool
+	address uint16
+	value   uint16
+}
+
+func (m *memory) eval(in, out []uint16) {
+	if m.addressPin < 0 {
+		out[0] = m.words[0]
+		return
+	}
+	out[0] = m.words[in[m.addressPin]]
+}
+
+func (m *memory) tick(in []uint16) {
+	if m.writable && in[1] != 0 {
+		m.write, m.address, m.value = true, in[m.addressPin], in[0]
+	}
+}
+
+func (m *memory) tock() {
+	if m.write {
+		m.words[m.address] = m.value
+		m.write = false
+	}
+}
+
+func (m *memory) word(address int) (*uint16, bool) {
+	if address < 0 || address >= len(m.words) {
+		return nil, false
+	}
+	return &m.words[address], true
+}
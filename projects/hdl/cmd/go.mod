@@ -0,0 +1,13 @@
+module main
+
+go 1.13
+
+require (
+	example.com/cpu v0.0.0
+	example.com/hdl v0.0.0
+)
+
+replace (
+	example.com/cpu => ../../cpu
+	example.com/hdl => ../
+)
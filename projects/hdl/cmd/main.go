@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"example.com/hdl"
+)
+
+// main runs the .tst test script given as the first argument, writing its output-file next to it.
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("usage: hdl file.tst")
+	}
+	err := hdl.RunScript(os.Args[1], hdl.Options{Echo: func(message string) {
+		fmt.Println(message)
+	}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("End of script - Comparison ended successfully")
+}
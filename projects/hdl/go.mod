@@ -0,0 +1,7 @@
+module hdl
+
+go 1.16
+
+require example.com/cpu v0.0.0
+
+replace example.com/cpu => ../cpu
@@ -0,0 +1,208 @@
+package hdl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func scripts(t *testing.T, patterns ...string) []string {
+	var paths []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join("..", pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, matches...)
+	}
+	return paths
+}
+
+// keyboard holds down the key that the echo messages of a script ask for, like "hold down the 'K'
+// key".
+func keyboard(options *Options) {
+	var key int16
+	options.Echo = func(message string) {
+		key = 0
+		if i := strings.Index(strings.ToLower(message), "hold down"); i >= 0 {
+			if j := strings.Index(message[i:], "'"); j >= 0 {
+				key = int16(message[i+j+1])
+			}
+		}
+	}
+	options.Keyboard = func() int16 {
+		return key
+	}
+}
+
+// TestScripts runs the test scripts of the projects with the chips of their folder, the output
+// must be the .out file the hardware simulator of the course wrote.
+func TestScripts(t *testing.T) {
+	for _, path := range scripts(t, "01/*.tst", "02/*.tst", "03/*/*.tst", "05/*.tst") {
+		var output bytes.Buffer
+		options := Options{Output: &output}
+		keyboard(&options)
+		if err := RunScript(path, options); err != nil {
+			t.Errorf("Unexpected error for %s: %v", path, err)
+			continue
+		}
+		want, err := ioutil.ReadFile(strings.TrimSuffix(path, ".tst") + ".out")
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := strings.Split(output.String(), "\n")
+		for i, line := range strings.Split(strings.ReplaceAll(string(want), "\r", ""), "\n") {
+			gotLine := "<missing>"
+			if i < len(got) {
+				gotLine = got[i]
+			}
+			if gotLine != line {
+				t.Errorf("Line %d of the output of %s was incorrect, got: %s, wanted: %s", i+1, path, gotLine, line)
+				break
+			}
+		}
+	}
+}
+
+// TestBuiltins runs the test scripts in a folder without .hdl files, which tests the builtin chips.
+func TestBuiltins(t *testing.T) {
+	for _, path := range scripts(t, "01/*.tst", "02/*.tst", "03/*/*.tst") {
+		dir := t.TempDir()
+		name := strings.TrimSuffix(filepath.Base(path), ".tst")
+		for _, ext := range []string{".tst", ".cmp"} {
+			source, err := ioutil.ReadFile(strings.TrimSuffix(path, ".tst") + ext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, name+ext), source, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := RunScript(filepath.Join(dir, name+".tst"), Options{Output: ioutil.Discard}); err != nil {
+			t.Errorf("Unexpected error for %s: %v", path, err)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	chips := []struct {
+		source string
+		err    string
+	}{
+		{`CHIP Bad { IN a; OUT out; PARTS: Not(in=a, out=out) }`, "Bad.hdl:1: expected ;, got \"}\""},
+		{"CHIP Bad {\n IN a;\n OUT out;\n PARTS:\n Not(in=b, out=out);\n}", "Bad.hdl:5: undefined pin b"},
+		{"CHIP Bad {\n IN a;\n OUT out;\n PARTS:\n Not(in=a, out=w);\n And(a=w, b=x, out=out);\n}", "Bad.hdl:6: undefined pin x"},
+		{"CHIP Bad {\n IN a;\n OUT out;\n PARTS:\n Not(input=a, out=out);\n}", "Bad.hdl:5: Not has no pin input"},
+		{"CHIP Bad {\n IN a[16];\n OUT out;\n PARTS:\n Not(in=a, out=out);\n}", "Bad.hdl:5: in and a have different widths, 1 and 16"},
+		{"CHIP Bad {\n IN a;\n OUT out[16];\n PARTS:\n Not16(in[0..7]=a, out=out);\n}", "Bad.hdl:5: in[0..7] and a have different widths, 8 and 1"},
+		{"CHIP Bad {\n IN a[8];\n OUT out;\n PARTS:\n Or8Way(in=a[0..8], out=out);\n}", "Bad.hdl:5: a[0..8] is out of the 8 bits of a"},
+		{"CHIP Bad {\n IN a;\n OUT out;\n PARTS:\n Not(in=a, out=w);\n Not(in=a, out=w);\n And(a=w, b=a, out=out);\n}", "Bad.hdl:6: w has more than one source"},
+		{"CHIP Bad {\n IN a;\n OUT out;\n PARTS:\n Not(in=a, out=a);\n}", "Bad.hdl:5: a is an input of Bad, a part cannot write it"},
+		{"CHIP Bad {\n IN a;\n OUT out, out2;\n PARTS:\n Not(in=a, out=out);\n Not(in=out, out=out2);\n}", "Bad.hdl:6: out is an output of Bad, a part cannot read it"},
+		{"CHIP Bad {\n IN a;\n OUT out;\n PARTS:\n Xnor(a=a, b=a, out=out);\n}", "Bad.hdl:5: unknown chip Xnor"},
+		{"CHIP Bad {\n IN a;\n OUT out;\n PARTS:\n Bad(a=a, out=out);\n}", "Bad: the chip Bad is one of its own parts"},
+		{"CHIP Bad {\n IN a;\n OUT out;\n PARTS:\n Not(in=a, out=x);\n And(a=x, b=y, out=w);\n Not(in=w, out=y);\n Not(in=y, out=out);\n}",
+			"combinational loop through Not at Bad.hdl:7, And at Bad.hdl:6"},
+	}
+	for _, chip := range chips {
+		dir := t.TempDir()
+		if err := ioutil.WriteFile(filepath.Join(dir, "Bad.hdl"), []byte(chip.source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(dir, "Bad")
+		if err == nil || err.Error() != chip.err {
+			t.Errorf("Error for %q was incorrect, got: %v, wanted: %s", chip.source, err, chip.err)
+		}
+	}
+}
+
+func TestChip(t *testing.T) {
+	dir := t.TempDir()
+	source := `CHIP Swap {
+    IN in[16], sel;
+    OUT out[16], zero;
+    PARTS:
+    Mux16(a=in, b[0..7]=in[8..15], b[8..15]=in[0..7], sel=sel, out=out, out[0..7]=low);
+    Or8Way(in=low, out=nonzero);
+    Not(in=nonzero, out=zero);
+}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "Swap.hdl"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chip, err := Load(dir, "Swap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []struct {
+		in, sel   int16
+		out, zero int16
+	}{
+		{0x1234, 0, 0x1234, 0},
+		{0x1234, 1, 0x3412, 0},
+		{0x1200, 0, 0x1200, 1},
+		{0x1200, 1, 0x0012, 0},
+		{-1, 1, -1, 0},
+	}
+	for _, v := range values {
+		chip.Set("in", v.in)
+		chip.Set("sel", v.sel)
+		chip.Eval()
+		out, _ := chip.Get("out")
+		zero, _ := chip.Get("zero")
+		if out != v.out || zero != v.zero {
+			t.Errorf("Outputs for in=%d sel=%d were incorrect, got: %d %d, wanted: %d %d", v.in, v.sel, out, zero, v.out, v.zero)
+		}
+	}
+	if err := chip.Set("out", 1); err == nil {
+		t.Errorf("Setting an output did not fail")
+	}
+}
+
+func TestClock(t *testing.T) {
+	dir := t.TempDir()
+	source := `CHIP Toggle {
+    IN enable;
+    OUT out;
+    PARTS:
+    Xor(a=enable, b=state, out=next);
+    DFF(in=next, out=state, out=out);
+}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "Toggle.hdl"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chip, err := Load(dir, "Toggle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	phases := []struct {
+		phase    string
+		enable   int16
+		out, dff int16
+	}{
+		{"tick", 1, 0, 1},
+		{"tock", 1, 1, 1},
+		{"tick", 0, 1, 1},
+		{"tock", 0, 1, 1},
+		{"tick", 1, 1, 0},
+		{"tock", 1, 0, 0},
+	}
+	for i, p := range phases {
+		chip.Set("enable", p.enable)
+		if p.phase == "tick" {
+			chip.Tick()
+		} else {
+			chip.Tock()
+		}
+		out, _ := chip.Get("out")
+		dff, _ := chip.Get("DFF[]")
+		if out != p.out || dff != p.dff {
+			t.Errorf("out and DFF[] after %s %d were incorrect, got: %d %d, wanted: %d %d", p.phase, i, out, dff, p.out, p.dff)
+		}
+	}
+}
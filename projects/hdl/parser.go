@@ -0,0 +1,309 @@
+package hdl
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ChipDef is the definition of a chip in a .hdl file.
+type ChipDef struct {
+	Name  string
+	File  string
+	In    []Pin
+	Out   []Pin
+	Parts []Part
+}
+
+// Pin is an IN or OUT pin of a chip, a bus when Width is more than 1.
+type Pin struct {
+	Name  string
+	Width int
+}
+
+// Part is a chip used by another one, connecting its pins to the pins of the chip.
+type Part struct {
+	Name        string
+	Line        int
+	Connections []Connection
+}
+
+// Connection connects the pin of a part, on the left of the =, to a pin of the chip, on the right.
+type Connection struct {
+	Part Bus
+	Chip Bus
+	Line int
+}
+
+// Bus is a pin name with the bits it selects, a[3] or a[0..7] when Sub is set, all of them
+// otherwise. The chip side of a connection can be the constant true or false.
+type Bus struct {
+	Name   string
+	Sub    bool
+	Lo, Hi int
+}
+
+func (b Bus) String() string {
+	switch {
+	case !b.Sub:
+		return b.Name
+	case b.Lo == b.Hi:
+		return fmt.Sprintf("%s[%d]", b.Name, b.Lo)
+	default:
+		return fmt.Sprintf("%s[%d..%d]", b.Name, b.Lo, b.Hi)
+	}
+}
+
+// maxWidth is the width of the widest bus, the values of a chip are 16 bit words.
+const maxWidth = 16
+
+// Parse reads the chip definition of a .hdl file, file names it in the errors.
+func Parse(file string, r io.Reader) (*ChipDef, error) {
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{file: file, source: string(source), line: 1}
+	def, err := p.chip()
+	if err != nil {
+		return nil, err
+	}
+	def.File = file
+	return def, nil
+}
+
+type parser struct {
+	file   string
+	source string
+	line   int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", p.file, p.line, fmt.Sprintf(format, args...))
+}
+
+// skip moves past white space and comments.
+func (p *parser) skip() {
+	for {
+		switch {
+		case p.source == "":
+			return
+		case strings.HasPrefix(p.source, "//"):
+			end := strings.Index(p.source, "\n")
+			if end < 0 {
+				end = len(p.source)
+			}
+			p.source = p.source[end:]
+		case strings.HasPrefix(p.source, "/*"):
+			end := strings.Index(p.source[2:], "*/")
+			if end < 0 {
+				end = len(p.source)
+			} else {
+				end += 4
+			}
+			p.line += strings.Count(p.source[:end], "\n")
+			p.source = p.source[end:]
+		case unicode.IsSpace(rune(p.source[0])):
+			if p.source[0] == '\n' {
+				p.line++
+			}
+			p.source = p.source[1:]
+		default:
+			return
+		}
+	}
+}
+
+// next returns the next token: a name, a number, .. or a single symbol, "" at the end.
+func (p *parser) next() string {
+	p.skip()
+	if p.source == "" {
+		return ""
+	}
+	n := 1
+	if isNameChar(p.source[0]) {
+		for n < len(p.source) && isNameChar(p.source[n]) {
+			n++
+		}
+	} else if strings.HasPrefix(p.source, "..") {
+		n = 2
+	}
+	token := p.source[:n]
+	p.source = p.source[n:]
+	return token
+}
+
+func (p *parser) peek() string {
+	source, line := p.source, p.line
+	token := p.next()
+	p.source, p.line = source, line
+	return token
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p *parser) expect(want string) error {
+	if token := p.next(); token != want {
+		return p.errorf("expected %s, got %q", want, token)
+	}
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	token := p.next()
+	if token == "" || !isNameChar(token[0]) || token[0] >= '0' && token[0] <= '9' {
+		return "", p.errorf("expected a name, got %q", token)
+	}
+	return token, nil
+}
+
+func (p *parser) number() (int, error) {
+	token := p.next()
+	n, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, p.errorf("expected a number, got %q", token)
+	}
+	return n, nil
+}
+
+func (p *parser) chip() (*ChipDef, error) {
+	if err := p.expect("CHIP"); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	def := &ChipDef{Name: name}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	if p.peek() == "IN" {
+		p.next()
+		if def.In, err = p.pins(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek() == "OUT" {
+		p.next()
+		if def.Out, err = p.pins(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect("PARTS"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	for p.peek() != "}" {
+		part, err := p.part()
+		if err != nil {
+			return nil, err
+		}
+		def.Parts = append(def.Parts, part)
+	}
+	p.next()
+	if token := p.next(); token != "" {
+		return nil, p.errorf("unexpected %q after the chip", token)
+	}
+	return def, nil
+}
+
+// pins reads the pin declarations of IN or OUT up to the semicolon.
+func (p *parser) pins() ([]Pin, error) {
+	var pins []Pin
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		pin := Pin{Name: name, Width: 1}
+		if p.peek() == "[" {
+			p.next()
+			if pin.Width, err = p.number(); err != nil {
+				return nil, err
+			}
+			if pin.Width < 1 || pin.Width > maxWidth {
+				return nil, p.errorf("the width of %s must be between 1 and %d", name, maxWidth)
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		}
+		pins = append(pins, pin)
+		switch token := p.next(); token {
+		case ",":
+		case ";":
+			return pins, nil
+		default:
+			return nil, p.errorf("expected , or ;, got %q", token)
+		}
+	}
+}
+
+func (p *parser) part() (Part, error) {
+	name, err := p.name()
+	if err != nil {
+		return Part{}, err
+	}
+	part := Part{Name: name, Line: p.line}
+	if err := p.expect("("); err != nil {
+		return Part{}, err
+	}
+	for {
+		partBus, err := p.bus()
+		if err != nil {
+			return Part{}, err
+		}
+		line := p.line
+		if err := p.expect("="); err != nil {
+			return Part{}, err
+		}
+		chipBus, err := p.bus()
+		if err != nil {
+			return Part{}, err
+		}
+		part.Connections = append(part.Connections, Connection{Part: partBus, Chip: chipBus, Line: line})
+		switch token := p.next(); token {
+		case ",":
+		case ")":
+			return part, p.expect(";")
+		default:
+			return Part{}, p.errorf("expected , or ), got %q", token)
+		}
+	}
+}
+
+// bus reads a pin name and its optional sub-bus, a[3] or a[0..7].
+func (p *parser) bus() (Bus, error) {
+	name, err := p.name()
+	if err != nil {
+		return Bus{}, err
+	}
+	b := Bus{Name: name}
+	if p.peek() != "[" {
+		return b, nil
+	}
+	p.next()
+	b.Sub = true
+	if b.Lo, err = p.number(); err != nil {
+		return Bus{}, err
+	}
+	b.Hi = b.Lo
+	if p.peek() == ".." {
+		p.next()
+		if b.Hi, err = p.number(); err != nil {
+			return Bus{}, err
+		}
+	}
+	if b.Lo > b.Hi {
+		return Bus{}, p.errorf("%s has its bits in the wrong order", b)
+	}
+	return b, p.expect("]")
+}
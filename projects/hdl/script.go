@@ -0,0 +1,506 @@
+package hdl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"example.com/cpu"
+)
+
+// Options are the settings of RunScript.
+type Options struct {
+	// Output receives the output of the script instead of the output-file it names.
+	Output io.Writer
+	// Echo receives the messages of the echo commands.
+	Echo func(message string)
+	// Keyboard returns the key held down, which the Keyboard chips read before every evaluation.
+	Keyboard func() int16
+}
+
+// RunScript runs the .tst test script at path the way the hardware simulator of the course does:
+// it loads a chip of the folder of the script, sets its inputs and writes the values of the
+// output-list to the output-file, which must match the compare-to file.
+func RunScript(path string, options Options) error {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	commands, err := parseScript(string(source))
+	if err != nil {
+		return fmt.Errorf("%s:%v", filepath.Base(path), err)
+	}
+	r := &runner{dir: filepath.Dir(path), options: options, output: options.Output}
+	err = r.run(commands)
+	if r.file != nil {
+		if flushErr := r.output.(*bufio.Writer).Flush(); err == nil {
+			err = flushErr
+		}
+		if closeErr := r.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s:%v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// command is a command of a script with its arguments, the body of repeat and while holds the
+// commands they run.
+type command struct {
+	line int
+	name string
+	args []string
+	body []command
+}
+
+type token struct {
+	text string
+	line int
+}
+
+// scriptTokens splits a script into words, strings in double quotes, the separators , ; ! and
+// braces.
+func scriptTokens(source string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for source != "" {
+		n := 1
+		switch c := source[0]; {
+		case c == '\n':
+			line++
+			source = source[1:]
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			source = source[1:]
+			continue
+		case strings.HasPrefix(source, "//"):
+			if n = strings.Index(source, "\n"); n < 0 {
+				n = len(source)
+			}
+			source = source[n:]
+			continue
+		case strings.HasPrefix(source, "/*"):
+			if n = strings.Index(source, "*/"); n < 0 {
+				return nil, &scriptError{line, fmt.Errorf("unterminated comment")}
+			}
+			line += strings.Count(source[:n], "\n")
+			source = source[n+2:]
+			continue
+		case c == '"':
+			if n = strings.Index(source[1:], `"`); n < 0 {
+				return nil, &scriptError{line, fmt.Errorf("unterminated string")}
+			}
+			n += 2
+		case isSeparator(c) || c == '{' || c == '}':
+		default:
+			for n < len(source) && !strings.ContainsRune(",;!{}\" \t\r\n", rune(source[n])) {
+				n++
+			}
+		}
+		tokens = append(tokens, token{source[:n], line})
+		source = source[n:]
+	}
+	return tokens, nil
+}
+
+func isSeparator(c byte) bool {
+	return c == ',' || c == ';' || c == '!'
+}
+
+func parseScript(source string) ([]command, error) {
+	tokens, err := scriptTokens(source)
+	if err != nil {
+		return nil, err
+	}
+	commands, rest, err := parseCommands(tokens)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, &scriptError{rest[0].line, fmt.Errorf("unexpected %s", rest[0].text)}
+	}
+	return commands, nil
+}
+
+// parseCommands reads commands up to a closing brace or the end of the tokens and returns the
+// tokens left.
+func parseCommands(tokens []token) ([]command, []token, error) {
+	var commands []command
+	for len(tokens) > 0 && tokens[0].text != "}" {
+		if isSeparator(tokens[0].text[0]) {
+			tokens = tokens[1:]
+			continue
+		}
+		c := command{line: tokens[0].line, name: tokens[0].text}
+		tokens = tokens[1:]
+		for len(tokens) > 0 && !isSeparator(tokens[0].text[0]) && tokens[0].text != "{" && tokens[0].text != "}" {
+			c.args = append(c.args, tokens[0].text)
+			tokens = tokens[1:]
+		}
+		if len(tokens) > 0 && tokens[0].text == "{" {
+			var err error
+			if c.body, tokens, err = parseCommands(tokens[1:]); err != nil {
+				return nil, nil, err
+			}
+			if len(tokens) == 0 {
+				return nil, nil, &scriptError{c.line, fmt.Errorf("%s has no closing brace", c.name)}
+			}
+			tokens = tokens[1:]
+		}
+		commands = append(commands, c)
+	}
+	return commands, tokens, nil
+}
+
+// scriptError is an error at a line of a script.
+type scriptError struct {
+	line int
+	err  error
+}
+
+func (e *scriptError) Error() string {
+	return fmt.Sprintf("%d: %v", e.line, e.err)
+}
+
+// column is an entry of the output-list: the pin name printed with format, B for binary, D for
+// decimal, X for hexadecimal and S for a string, in width characters padded by left and right
+// spaces.
+type column struct {
+	name        string
+	format      byte
+	left, width int
+	right       int
+}
+
+func parseColumn(entry string) (column, error) {
+	i := strings.Index(entry, "%")
+	if i < 0 || i+1 >= len(entry) {
+		return column{}, fmt.Errorf("%s has no format", entry)
+	}
+	c := column{name: entry[:i], format: entry[i+1]}
+	sizes := strings.Split(entry[i+2:], ".")
+	if !strings.ContainsRune("BDXS", rune(c.format)) || len(sizes) != 3 {
+		return column{}, fmt.Errorf("invalid format %s", entry[i:])
+	}
+	for j, size := range []*int{&c.left, &c.width, &c.right} {
+		n, err := strconv.Atoi(sizes[j])
+		if err != nil || n < 0 {
+			return column{}, fmt.Errorf("invalid format %s", entry[i:])
+		}
+		*size = n
+	}
+	return c, nil
+}
+
+// header is the name of the column centered in its spaces, cut when it does not fit.
+func (c column) header() string {
+	size := c.left + c.width + c.right
+	name := c.name
+	if len(name) > size {
+		name = name[:size]
+	}
+	left := (size - len(name)) / 2
+	return strings.Repeat(" ", left) + name + strings.Repeat(" ", size-len(name)-left)
+}
+
+func (c column) value(v int16) string {
+	var s string
+	switch c.format {
+	case 'B':
+		s = fmt.Sprintf("%016b", uint16(v))
+		s = s[len(s)-c.width:]
+	case 'X':
+		s = fmt.Sprintf("%04X", uint16(v))
+		if len(s) > c.width {
+			s = s[len(s)-c.width:]
+		}
+	default:
+		s = fmt.Sprintf("%*d", c.width, v)
+	}
+	return strings.Repeat(" ", c.left) + s + strings.Repeat(" ", c.right)
+}
+
+func (c column) text(s string) string {
+	return strings.Repeat(" ", c.left) + fmt.Sprintf("%-*s", c.width, s) + strings.Repeat(" ", c.right)
+}
+
+// parseValue reads a value of set or of a condition: decimal, or binary, hexadecimal or decimal
+// after %B, %X or %D.
+func parseValue(s string) (int16, error) {
+	base, digits := 10, s
+	if len(s) > 2 && s[0] == '%' {
+		switch s[1] {
+		case 'B':
+			base = 2
+		case 'X':
+			base = 16
+		case 'D':
+		default:
+			return 0, fmt.Errorf("invalid value %s", s)
+		}
+		digits = s[2:]
+	}
+	n, err := strconv.ParseInt(digits, base, 32)
+	if err != nil || n < -1<<15 || n >= 1<<16 {
+		return 0, fmt.Errorf("invalid value %s", s)
+	}
+	return int16(n), nil
+}
+
+type runner struct {
+	dir     string
+	options Options
+	chip    *Chip
+	// output receives the output lines, a buffer of file, the output-file, when the options have
+	// no Output
+	output  io.Writer
+	file    *os.File
+	columns []column
+	// compare holds the lines of the compare-to file, outputs counts the lines written
+	compare []string
+	outputs int
+	time    int
+	ticked  bool
+}
+
+func (r *runner) run(commands []command) error {
+	for _, c := range commands {
+		if err := r.execute(c); err != nil {
+			if _, ok := err.(*scriptError); !ok {
+				err = &scriptError{c.line, err}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *runner) execute(c command) error {
+	if r.chip == nil && c.name != "load" && c.name != "echo" && c.name != "clear-echo" {
+		return fmt.Errorf("%s before load", c.name)
+	}
+	switch c.name {
+	case "load":
+		if len(c.args) != 1 {
+			return fmt.Errorf("load takes the .hdl file of a chip")
+		}
+		chip, err := Load(r.dir, strings.TrimSuffix(c.args[0], ".hdl"))
+		if err != nil {
+			return err
+		}
+		r.chip = chip
+	case "output-file":
+		if len(c.args) != 1 {
+			return fmt.Errorf("output-file takes a file")
+		}
+		if r.options.Output != nil {
+			return nil
+		}
+		file, err := os.Create(filepath.Join(r.dir, c.args[0]))
+		if err != nil {
+			return err
+		}
+		r.file, r.output = file, bufio.NewWriter(file)
+	case "compare-to":
+		if len(c.args) != 1 {
+			return fmt.Errorf("compare-to takes a file")
+		}
+		compare, err := ioutil.ReadFile(filepath.Join(r.dir, c.args[0]))
+		if err != nil {
+			return err
+		}
+		r.compare = strings.Split(strings.ReplaceAll(string(compare), "\r", ""), "\n")
+	case "output-list":
+		r.columns = nil
+		headers := make([]string, len(c.args))
+		for i, arg := range c.args {
+			column, err := parseColumn(arg)
+			if err != nil {
+				return err
+			}
+			if _, err := r.value(column); err != nil {
+				return err
+			}
+			r.columns = append(r.columns, column)
+			headers[i] = column.header()
+		}
+		return r.writeLine(headers)
+	case "set":
+		if len(c.args) != 2 {
+			return fmt.Errorf("set takes a pin and a value")
+		}
+		value, err := parseValue(c.args[1])
+		if err != nil {
+			return err
+		}
+		return r.chip.Set(c.args[0], value)
+	case "eval":
+		r.press()
+		r.chip.Eval()
+	case "tick":
+		r.press()
+		r.chip.Tick()
+		r.ticked = true
+	case "tock":
+		r.press()
+		r.chip.Tock()
+		r.ticked = false
+		r.time++
+	case "output":
+		values := make([]string, len(r.columns))
+		for i, column := range r.columns {
+			value, err := r.value(column)
+			if err != nil {
+				return err
+			}
+			values[i] = value
+		}
+		return r.writeLine(values)
+	case "echo":
+		if r.options.Echo != nil {
+			r.options.Echo(strings.Trim(strings.Join(c.args, " "), `"`))
+		}
+	case "clear-echo":
+	case "repeat":
+		n, err := strconv.Atoi(strings.Join(c.args, ""))
+		if err != nil || c.body == nil {
+			return fmt.Errorf("repeat takes a count and a block")
+		}
+		for i := 0; i < n; i++ {
+			if err := r.run(c.body); err != nil {
+				return err
+			}
+		}
+	case "while":
+		if len(c.args) != 3 || c.body == nil {
+			return fmt.Errorf("while takes a condition and a block")
+		}
+		for {
+			holds, err := r.condition(c.args)
+			if err != nil {
+				return err
+			}
+			if !holds {
+				return nil
+			}
+			if err := r.run(c.body); err != nil {
+				return err
+			}
+		}
+	default:
+		// a part loading its memory, ROM32K load Max.hack
+		if len(c.args) != 2 || c.args[0] != "load" {
+			return fmt.Errorf("unknown command %s", c.name)
+		}
+		file, err := os.Open(filepath.Join(r.dir, c.args[1]))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		words, err := cpu.ReadHack(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", c.args[1], err)
+		}
+		for address, word := range words {
+			if err := r.chip.Set(fmt.Sprintf("%s[%d]", c.name, address), int16(word)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *runner) press() {
+	if r.options.Keyboard != nil {
+		r.chip.Press(r.options.Keyboard())
+	}
+}
+
+// value formats the value of the pin of a column, or the time of the clock: the number of tocks,
+// followed by a + after a tick.
+func (r *runner) value(c column) (string, error) {
+	if c.name == "time" {
+		time := strconv.Itoa(r.time)
+		if r.ticked {
+			time += "+"
+		}
+		return c.text(time), nil
+	}
+	v, err := r.chip.Get(c.name)
+	if err != nil {
+		return "", err
+	}
+	if c.format == 'S' {
+		return c.text(strconv.Itoa(int(v))), nil
+	}
+	return c.value(v), nil
+}
+
+// condition evaluates the condition of while, a pin compared to a value.
+func (r *runner) condition(args []string) (bool, error) {
+	v, err := r.chip.Get(args[0])
+	if err != nil {
+		return false, err
+	}
+	value, err := parseValue(args[2])
+	if err != nil {
+		return false, err
+	}
+	switch args[1] {
+	case "=":
+		return v == value, nil
+	case "<>":
+		return v != value, nil
+	case "<":
+		return v < value, nil
+	case ">":
+		return v > value, nil
+	case "<=":
+		return v <= value, nil
+	case ">=":
+		return v >= value, nil
+	}
+	return false, fmt.Errorf("invalid comparison %s", args[1])
+}
+
+// writeLine writes the cells of a line of output and compares it to the compare-to file, where a
+// * matches any character.
+func (r *runner) writeLine(cells []string) error {
+	line := "|" + strings.Join(cells, "|") + "|"
+	if r.output != nil {
+		if _, err := io.WriteString(r.output, line+"\n"); err != nil {
+			return err
+		}
+	}
+	r.outputs++
+	if r.compare == nil {
+		return nil
+	}
+	if r.outputs > len(r.compare) || !matches(line, r.compare[r.outputs-1]) {
+		want := ""
+		if r.outputs <= len(r.compare) {
+			want = r.compare[r.outputs-1]
+		}
+		return fmt.Errorf("comparison failure at line %d, got: %s, wanted: %s", r.outputs, line, want)
+	}
+	return nil
+}
+
+func matches(line string, want string) bool {
+	if len(line) != len(want) {
+		return false
+	}
+	for i := range line {
+		if line[i] != want[i] && want[i] != '*' {
+			return false
+		}
+	}
+	return true
+}
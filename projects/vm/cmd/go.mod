@@ -3,11 +3,15 @@ module main
 go 1.12
 
 require (
+	example.com/assembler v0.0.0
+	example.com/cpu v0.0.0
 	vm/parser v0.0.0
 	vm/translater v0.0.0
 )
 
 replace (
+	example.com/assembler => ../../assembler
+	example.com/cpu => ../../cpu
 	vm/parser => ../parser
 	vm/translater => ../translater
 )
@@ -7,7 +7,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	"vm/parser"
 	"vm/translater"
 )
 
@@ -39,15 +38,10 @@ func main() {
 	}()
 	
 	// write init for output file
-	var aw translater.Translater
-	aw = &translater.AssemblyWriter{
-		Filename: "",
-		FunctionName: "",
-		CommandType: "",
-		Arg1: "Sys.init",
-		Arg2: 0,
+	program, err := translater.NewProgram(w)
+	if err != nil {
+		log.Fatal(err)
 	}
-	w.WriteString(aw.WriteInit())
 
 	// if a directory process all files in directory else just process file
 	if isPathDir {
@@ -62,11 +56,11 @@ func main() {
 
 		for _, file := range files {
 			if filepath.Ext(file) == ".vm" {
-				processFile(file, w)
+				processFile(file, program)
 			}
 		}
 	} else {
-		processFile(path, w)
+		processFile(path, program)
 	}
 }
 
@@ -90,7 +84,7 @@ func createOutputPath(path string, isDir bool) string {
 	return outPath
 }
 
-func processFile(path string, w *bufio.Writer) {
+func processFile(path string, program *translater.Program) {
 	fname := filepath.Base(path)
 	fnameNoExt := strings.Replace(fname, ".vm", "", 1)
 	file, err := os.Open(path)
@@ -103,68 +97,7 @@ func processFile(path string, w *bufio.Writer) {
 		}
 	}()
 
-	var p parser.VmParser
-	var aw translater.Translater
-	equalityCheckCount := 0
-	functionName := ""
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		p = &parser.Command{Line: scanner.Text()}
-		formattedCommand := p.FormatLine()
-		if formattedCommand == "" {
-			continue
-		}
-		commandType, err := p.CommandType()
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		firstArg, err := p.Arg1(commandType)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		secondArg, err := p.Arg2(commandType)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		if commandType == "C_FUNCTION" {
-			functionName = firstArg
-		}
-
-		aw = &translater.AssemblyWriter{
-			Filename:    fnameNoExt,
-			FunctionName: functionName,
-			CommandType: commandType,
-			Arg1:        firstArg,
-			Arg2:        secondArg,
-		}
-
-		var assemblyCode string
-		var equalityInc int
-		switch commandType {
-		case "C_ARITHMETIC":
-			assemblyCode, equalityInc = aw.WriteArithmetic(equalityCheckCount)
-		case "C_PUSH", "C_POP":
-			assemblyCode = aw.WritePushPop()
-		case "C_LABEL":
-			assemblyCode = aw.WriteLabel()
-		case "C_GOTO":
-			assemblyCode = aw.WriteGoto()
-		case "C_IF":
-			assemblyCode = aw.WriteIf()
-		case "C_FUNCTION":
-			assemblyCode = aw.WriteFunction()
-		case "C_RETURN":
-			assemblyCode = aw.WriteReturn()
-		case "C_CALL":
-			assemblyCode, equalityInc = aw.WriteCall(equalityCheckCount)
-		}
-
-		equalityCheckCount += equalityInc
-
-		w.WriteString(assemblyCode)
+	if err := program.Translate(fnameNoExt, file); err != nil {
+		log.Fatal(err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,45 @@
+package interpreter
+
+import "fmt"
+
+// RegisterMath installs Go versions of the Math class with the results the Jack OS gives,
+// products wrap around at 16 bits and quotients are truncated towards zero.
+func (vm *VM) RegisterMath() {
+	vm.Register("Math.multiply", func(vm *VM, args []int16) (int16, error) {
+		return args[0] * args[1], nil
+	})
+	vm.Register("Math.divide", func(vm *VM, args []int16) (int16, error) {
+		if args[1] == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return args[0] / args[1], nil
+	})
+	vm.Register("Math.abs", func(vm *VM, args []int16) (int16, error) {
+		if args[0] < 0 {
+			return -args[0], nil
+		}
+		return args[0], nil
+	})
+	vm.Register("Math.min", func(vm *VM, args []int16) (int16, error) {
+		if args[0] < args[1] {
+			return args[0], nil
+		}
+		return args[1], nil
+	})
+	vm.Register("Math.max", func(vm *VM, args []int16) (int16, error) {
+		if args[0] > args[1] {
+			return args[0], nil
+		}
+		return args[1], nil
+	})
+	vm.Register("Math.sqrt", func(vm *VM, args []int16) (int16, error) {
+		if args[0] < 0 {
+			return 0, fmt.Errorf("square root of a negative number")
+		}
+		var root int16
+		for (root+1)*(root+1) <= args[0] && root < 181 {
+			root++
+		}
+		return root, nil
+	})
+}
@@ -0,0 +1,7 @@
+module interpreter
+
+go 1.12
+
+require vm/parser v0.0.0
+
+replace vm/parser => ../parser
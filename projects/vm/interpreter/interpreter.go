@@ -0,0 +1,487 @@
+package interpreter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"vm/parser"
+)
+
+// The Hack memory map, shared with the translated assembly so that RAM can be compared.
+const (
+	SP         = 0
+	LCL        = 1
+	ARG        = 2
+	THIS       = 3
+	THAT       = 4
+	TempBase   = 5
+	StaticBase = 16
+	StackBase  = 256
+	Screen     = 16384
+	Keyboard   = 24576
+	RAMSize    = 32768
+)
+
+// returnToHost is the return address of a call made by the host through Call, returning to it
+// stops execution.
+const returnToHost = -1
+
+type instruction struct {
+	commandType string
+	arg1        string
+	arg2        int
+	file        string
+	function    string
+	line        int
+	target      int
+}
+
+func (i instruction) String() string {
+	switch i.commandType {
+	case "C_ARITHMETIC", "C_RETURN":
+		return i.arg1
+	case "C_LABEL", "C_GOTO", "C_IF":
+		return fmt.Sprintf("%s %s", strings.ToLower(i.commandType[2:]), i.arg1)
+	default:
+		return fmt.Sprintf("%s %s %d", strings.ToLower(i.commandType[2:]), i.arg1, i.arg2)
+	}
+}
+
+// Builtin implements a VM function in Go, it receives the call's arguments and returns the
+// value to push.
+type Builtin func(vm *VM, args []int16) (int16, error)
+
+// VM executes VM commands directly over a Hack sized RAM using the same stack frame layout
+// as the translator, so its memory can be compared with the CPU emulator.
+type VM struct {
+	RAM []int16
+	// MaxSteps bounds the number of commands a single Run may execute, 0 means no bound.
+	MaxSteps int
+
+	program   []instruction
+	functions map[string]int
+	labels    map[string]int
+	statics   map[string]int
+	builtins  map[string]Builtin
+	linked    bool
+	pc        int
+	halted    bool
+}
+
+func New() *VM {
+	return &VM{
+		RAM:       make([]int16, RAMSize),
+		functions: make(map[string]int),
+		labels:    make(map[string]int),
+		statics:   make(map[string]int),
+		builtins:  make(map[string]Builtin),
+	}
+}
+
+// Register installs a Go implementation of a function. Functions loaded from VM code take
+// precedence over builtins of the same name.
+func (vm *VM) Register(name string, fn Builtin) {
+	vm.builtins[name] = fn
+}
+
+// Load reads the VM commands of one file, file is the name used for its static segment.
+func (vm *VM) Load(file string, r io.Reader) error {
+	function := ""
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		var p parser.VmParser = &parser.Command{Line: scanner.Text()}
+		if p.FormatLine() == "" {
+			continue
+		}
+		commandType, err := p.CommandType()
+		if err != nil {
+			return fmt.Errorf("%s.vm:%d: %v", file, line, err)
+		}
+		arg1, err := p.Arg1(commandType)
+		if err != nil {
+			return fmt.Errorf("%s.vm:%d: %v", file, line, err)
+		}
+		arg2, err := p.Arg2(commandType)
+		if err != nil {
+			return fmt.Errorf("%s.vm:%d: %v", file, line, err)
+		}
+		if commandType == "C_FUNCTION" {
+			function = arg1
+			if _, ok := vm.functions[arg1]; ok {
+				return fmt.Errorf("%s.vm:%d: function %s is defined more than once", file, line, arg1)
+			}
+			vm.functions[arg1] = len(vm.program)
+		}
+		if commandType == "C_LABEL" {
+			vm.labels[function+"$"+arg1] = len(vm.program)
+		}
+		if (commandType == "C_PUSH" || commandType == "C_POP") && arg1 == "static" {
+			vm.static(file, arg2)
+		}
+		vm.program = append(vm.program, instruction{commandType, arg1, arg2, file, function, line, 0})
+	}
+	vm.linked = false
+	return scanner.Err()
+}
+
+// LoadFile loads a single .vm file.
+func (vm *VM) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return vm.Load(strings.TrimSuffix(filepath.Base(path), ".vm"), file)
+}
+
+// LoadDir loads every .vm file of a folder in lexical order, the order the translator uses.
+func (vm *VM) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.vm"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := vm.LoadFile(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// static returns the address of static variable index of file. Like the assembler, addresses
+// are handed out in order of first use.
+func (vm *VM) static(file string, index int) int {
+	name := fmt.Sprintf("%s.%d", file, index)
+	address, ok := vm.statics[name]
+	if !ok {
+		address = StaticBase + len(vm.statics)
+		vm.statics[name] = address
+	}
+	return address
+}
+
+func (vm *VM) link() error {
+	if vm.linked {
+		return nil
+	}
+	for i := range vm.program {
+		inst := &vm.program[i]
+		switch inst.commandType {
+		case "C_GOTO", "C_IF":
+			target, ok := vm.labels[inst.function+"$"+inst.arg1]
+			if !ok {
+				return vm.errorAt(i, "unknown label %s", inst.arg1)
+			}
+			inst.target = target
+		case "C_CALL":
+			target, ok := vm.functions[inst.arg1]
+			if !ok {
+				if _, ok := vm.builtins[inst.arg1]; !ok {
+					return vm.errorAt(i, "unknown function %s", inst.arg1)
+				}
+				target = -1
+			}
+			inst.target = target
+		}
+	}
+	vm.linked = true
+	return nil
+}
+
+func (vm *VM) errorAt(pc int, format string, a ...interface{}) error {
+	inst := vm.program[pc]
+	return fmt.Errorf("%s.vm:%d: %s: %s", inst.file, inst.line, inst, fmt.Sprintf(format, a...))
+}
+
+// Halted reports whether the program reached an infinite loop of the form "label L, goto L",
+// the way Sys.halt stops the machine.
+func (vm *VM) Halted() bool {
+	return vm.halted
+}
+
+// Reset clears RAM and places the stack pointer at its base, keeping the loaded program.
+func (vm *VM) Reset() {
+	for i := range vm.RAM {
+		vm.RAM[i] = 0
+	}
+	vm.RAM[SP] = StackBase
+	vm.halted = false
+}
+
+// Boot runs the program from Sys.init as the bootstrap code of the translator does.
+func (vm *VM) Boot() error {
+	if err := vm.link(); err != nil {
+		return err
+	}
+	vm.Reset()
+	if err := vm.Start("Sys.init"); err != nil {
+		return err
+	}
+	return vm.Run()
+}
+
+// Start calls function with the given arguments on the current stack without running it, Step
+// then executes its commands one at a time and the call is over when PC returns -1.
+func (vm *VM) Start(function string, args ...int16) error {
+	if err := vm.link(); err != nil {
+		return err
+	}
+	entry, ok := vm.functions[function]
+	if !ok {
+		return fmt.Errorf("function %s is not defined", function)
+	}
+	if vm.RAM[SP] < StackBase {
+		vm.RAM[SP] = StackBase
+	}
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	vm.pushFrame(returnToHost, len(args))
+	vm.pc = entry
+	return nil
+}
+
+// Call runs function with the given arguments on the current stack and returns its result.
+func (vm *VM) Call(function string, args ...int16) (int16, error) {
+	if err := vm.link(); err != nil {
+		return 0, err
+	}
+	if builtin, ok := vm.builtins[function]; ok {
+		if _, ok := vm.functions[function]; !ok {
+			if vm.RAM[SP] < StackBase {
+				vm.RAM[SP] = StackBase
+			}
+			for _, arg := range args {
+				vm.push(arg)
+			}
+			return vm.callBuiltin(builtin, len(args))
+		}
+	}
+	if err := vm.Start(function, args...); err != nil {
+		return 0, err
+	}
+	if err := vm.Run(); err != nil {
+		return 0, err
+	}
+	if vm.halted {
+		return 0, fmt.Errorf("%s halted before returning", function)
+	}
+	return vm.pop(), nil
+}
+
+// Run executes commands until the host's call returns, the program halts or an error occurs.
+func (vm *VM) Run() error {
+	for steps := 0; vm.pc != returnToHost && !vm.halted; steps++ {
+		if vm.MaxSteps > 0 && steps >= vm.MaxSteps {
+			return fmt.Errorf("stopped after %d steps", steps)
+		}
+		if err := vm.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PC returns the index of the next command and the command itself, for tracing.
+func (vm *VM) PC() (int, string) {
+	if vm.pc < 0 || vm.pc >= len(vm.program) {
+		return vm.pc, ""
+	}
+	return vm.pc, vm.program[vm.pc].String()
+}
+
+// Source returns where command pc was read from, as "File.vm:line".
+func (vm *VM) Source(pc int) string {
+	if pc < 0 || pc >= len(vm.program) {
+		return ""
+	}
+	return fmt.Sprintf("%s.vm:%d", vm.program[pc].file, vm.program[pc].line)
+}
+
+// Step executes a single command.
+func (vm *VM) Step() error {
+	if err := vm.link(); err != nil {
+		return err
+	}
+	if vm.pc < 0 || vm.pc >= len(vm.program) {
+		return fmt.Errorf("program counter %d is outside the program", vm.pc)
+	}
+	pc := vm.pc
+	inst := vm.program[pc]
+	vm.pc++
+	switch inst.commandType {
+	case "C_ARITHMETIC":
+		return vm.arithmetic(pc, inst.arg1)
+	case "C_PUSH":
+		address, err := vm.address(pc, inst)
+		if err != nil {
+			return err
+		}
+		if address < 0 {
+			vm.push(int16(inst.arg2))
+		} else {
+			vm.push(vm.RAM[address])
+		}
+	case "C_POP":
+		address, err := vm.address(pc, inst)
+		if err != nil {
+			return err
+		}
+		if address < 0 {
+			return vm.errorAt(pc, "cannot pop to constant")
+		}
+		vm.RAM[address] = vm.pop()
+	case "C_LABEL":
+	case "C_GOTO":
+		vm.halted = inst.target == pc-1
+		vm.pc = inst.target
+	case "C_IF":
+		if vm.pop() != 0 {
+			vm.pc = inst.target
+		}
+	case "C_FUNCTION":
+		for i := 0; i < inst.arg2; i++ {
+			vm.push(0)
+		}
+	case "C_CALL":
+		if inst.target < 0 {
+			if _, err := vm.callBuiltin(vm.builtins[inst.arg1], inst.arg2); err != nil {
+				return vm.errorAt(pc, "%v", err)
+			}
+			return nil
+		}
+		vm.pushFrame(vm.pc, inst.arg2)
+		vm.pc = inst.target
+	case "C_RETURN":
+		vm.doReturn()
+	}
+	return nil
+}
+
+func (vm *VM) push(value int16) {
+	vm.RAM[vm.RAM[SP]] = value
+	vm.RAM[SP]++
+}
+
+func (vm *VM) pop() int16 {
+	vm.RAM[SP]--
+	return vm.RAM[vm.RAM[SP]]
+}
+
+func (vm *VM) callBuiltin(builtin Builtin, nArgs int) (int16, error) {
+	args := make([]int16, nArgs)
+	for i := nArgs - 1; i >= 0; i-- {
+		args[i] = vm.pop()
+	}
+	result, err := builtin(vm, args)
+	if err != nil {
+		return 0, err
+	}
+	vm.push(result)
+	return result, nil
+}
+
+// pushFrame saves the caller's frame the way the translated "call" command does.
+func (vm *VM) pushFrame(returnAddress int, nArgs int) {
+	vm.push(int16(returnAddress))
+	vm.push(vm.RAM[LCL])
+	vm.push(vm.RAM[ARG])
+	vm.push(vm.RAM[THIS])
+	vm.push(vm.RAM[THAT])
+	vm.RAM[ARG] = vm.RAM[SP] - int16(nArgs) - 5
+	vm.RAM[LCL] = vm.RAM[SP]
+}
+
+func (vm *VM) doReturn() {
+	frame := vm.RAM[LCL]
+	returnAddress := vm.RAM[frame-5]
+	vm.RAM[vm.RAM[ARG]] = vm.pop()
+	vm.RAM[SP] = vm.RAM[ARG] + 1
+	vm.RAM[THAT] = vm.RAM[frame-1]
+	vm.RAM[THIS] = vm.RAM[frame-2]
+	vm.RAM[ARG] = vm.RAM[frame-3]
+	vm.RAM[LCL] = vm.RAM[frame-4]
+	vm.pc = int(returnAddress)
+}
+
+// address resolves a push/pop operand to a RAM address, constants resolve to -1.
+func (vm *VM) address(pc int, inst instruction) (int, error) {
+	index := inst.arg2
+	var address int
+	switch inst.arg1 {
+	case "constant":
+		return -1, nil
+	case "local":
+		address = int(vm.RAM[LCL]) + index
+	case "argument":
+		address = int(vm.RAM[ARG]) + index
+	case "this":
+		address = int(uint16(vm.RAM[THIS])) + index
+	case "that":
+		address = int(uint16(vm.RAM[THAT])) + index
+	case "pointer":
+		if index > 1 {
+			return 0, vm.errorAt(pc, "pointer index must be 0 or 1")
+		}
+		address = THIS + index
+	case "temp":
+		if index > 7 {
+			return 0, vm.errorAt(pc, "temp index must be between 0 and 7")
+		}
+		address = TempBase + index
+	case "static":
+		address = vm.static(inst.file, index)
+	default:
+		return 0, vm.errorAt(pc, "unknown segment %s", inst.arg1)
+	}
+	if address < 0 || address >= len(vm.RAM) {
+		return 0, vm.errorAt(pc, "address %d is outside RAM", address)
+	}
+	return address, nil
+}
+
+func (vm *VM) arithmetic(pc int, command string) error {
+	if command == "neg" || command == "not" {
+		x := vm.pop()
+		if command == "neg" {
+			vm.push(-x)
+		} else {
+			vm.push(^x)
+		}
+		return nil
+	}
+	y := vm.pop()
+	x := vm.pop()
+	switch command {
+	case "add":
+		vm.push(x + y)
+	case "sub":
+		vm.push(x - y)
+	case "and":
+		vm.push(x & y)
+	case "or":
+		vm.push(x | y)
+	case "eq":
+		vm.push(boolean(x == y))
+	case "gt":
+		vm.push(boolean(x > y))
+	case "lt":
+		vm.push(boolean(x < y))
+	default:
+		return vm.errorAt(pc, "unknown arithmetic command")
+	}
+	return nil
+}
+
+func boolean(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
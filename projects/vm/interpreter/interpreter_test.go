@@ -0,0 +1,271 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+)
+
+// load returns a VM with the Math builtins and the VM code of the files, named Sys and Main.
+func load(t *testing.T, files map[string]string) *VM {
+	t.Helper()
+	vm := New()
+	vm.RegisterMath()
+	vm.MaxSteps = 100000
+	for _, name := range []string{"Sys", "Main"} {
+		if source, ok := files[name]; ok {
+			if err := vm.Load(name, strings.NewReader(source)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return vm
+}
+
+func TestArithmetic(t *testing.T) {
+	operations := []struct {
+		x, y int16
+		op   string
+		want int16
+	}{
+		{7, 5, "add", 12},
+		{32767, 1, "add", -32768},
+		{5, 7, "sub", -2},
+		{-32768, 1, "sub", 32767},
+		{12, 10, "and", 8},
+		{12, 10, "or", 14},
+		{5, 5, "eq", -1},
+		{5, 6, "eq", 0},
+		{3, 2, "gt", -1},
+		{2, 3, "gt", 0},
+		{-2, -1, "lt", -1},
+		{32767, -1, "gt", -1},
+		{-32768, 1, "lt", -1},
+		{32767, -32768, "lt", 0},
+	}
+	for _, o := range operations {
+		vm := load(t, map[string]string{"Main": "function Main.f 0\npush argument 0\npush argument 1\n" + o.op + "\nreturn"})
+		got, err := vm.Call("Main.f", o.x, o.y)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != o.want {
+			t.Errorf("%d %s %d was incorrect, got: %d, wanted: %d", o.x, o.op, o.y, got, o.want)
+		}
+	}
+	unary := []struct {
+		x    int16
+		op   string
+		want int16
+	}{
+		{5, "neg", -5},
+		{-32768, "neg", -32768},
+		{0, "not", -1},
+		{0x0f0f, "not", -0x0f10},
+	}
+	for _, o := range unary {
+		vm := load(t, map[string]string{"Main": "function Main.f 0\npush argument 0\n" + o.op + "\nreturn"})
+		got, err := vm.Call("Main.f", o.x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != o.want {
+			t.Errorf("%s %d was incorrect, got: %d, wanted: %d", o.op, o.x, got, o.want)
+		}
+	}
+}
+
+func TestSegments(t *testing.T) {
+	vm := load(t, map[string]string{"Main": `function Main.f 2
+push constant 3000
+pop pointer 0
+push constant 4000
+pop pointer 1
+push constant 11
+pop this 2
+push constant 12
+pop that 3
+push constant 13
+pop temp 6
+push argument 1
+pop local 1
+push this 2
+push that 3
+add
+pop static 0
+push temp 6
+pop static 1
+push local 0
+push local 1
+add
+return`})
+	got, err := vm.Call("Main.f", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 2 {
+		t.Errorf("Main.f(1, 2) was incorrect, got: %d, wanted: %d", got, 2)
+	}
+	memory := []struct {
+		address int
+		want    int16
+	}{
+		// the return restores the pointers of the host
+		{THIS, 0},
+		{THAT, 0},
+		{3002, 11},
+		{4003, 12},
+		{TempBase + 6, 13},
+		{StaticBase, 23},
+		{StaticBase + 1, 13},
+		{SP, StackBase},
+	}
+	for _, m := range memory {
+		if got := vm.RAM[m.address]; got != m.want {
+			t.Errorf("RAM[%d] was incorrect, got: %d, wanted: %d", m.address, got, m.want)
+		}
+	}
+}
+
+// TestCallReturn boots a program whose Sys.init calls a function that changes THIS and THAT and
+// a recursive one, the frame of Sys.init must be restored after each return.
+func TestCallReturn(t *testing.T) {
+	vm := load(t, map[string]string{"Main": `function Main.diff 2
+push constant 1
+pop pointer 0
+push constant 2
+pop pointer 1
+push argument 0
+push argument 1
+sub
+pop local 1
+push local 0
+push local 1
+add
+return
+function Main.sum 0
+push argument 0
+push constant 0
+eq
+if-goto BASE
+push argument 0
+push argument 0
+push constant 1
+sub
+call Main.sum 1
+add
+return
+label BASE
+push constant 0
+return
+`, "Sys": `function Sys.init 0
+push constant 3000
+pop pointer 0
+push constant 4000
+pop pointer 1
+push constant 7
+push constant 5
+call Main.diff 2
+pop static 0
+push pointer 0
+pop static 1
+push pointer 1
+pop static 2
+push constant 10
+call Main.sum 1
+pop static 3
+push constant 300
+push constant 300
+call Math.multiply 2
+pop static 4
+label END
+goto END
+`})
+	if err := vm.Boot(); err != nil {
+		t.Fatal(err)
+	}
+	if !vm.Halted() {
+		t.Fatal("The program did not halt")
+	}
+	memory := []struct {
+		name    string
+		address int
+		want    int16
+	}{
+		{"Main.diff(7, 5)", StaticBase, 2},
+		{"THIS", StaticBase + 1, 3000},
+		{"THAT", StaticBase + 2, 4000},
+		{"Main.sum(10)", StaticBase + 3, 55},
+		{"Math.multiply(300, 300)", StaticBase + 4, 24464},
+		// Sys.init is called with no arguments from the base of the stack
+		{"SP", SP, StackBase + 5},
+		{"LCL", LCL, StackBase + 5},
+		{"ARG", ARG, StackBase},
+	}
+	for _, m := range memory {
+		if got := vm.RAM[m.address]; got != m.want {
+			t.Errorf("%s was incorrect, got: %d, wanted: %d", m.name, got, m.want)
+		}
+	}
+}
+
+// TestRegisterMath checks that the Math builtins wrap around like the 16 bit Jack OS.
+func TestRegisterMath(t *testing.T) {
+	calls := []struct {
+		function string
+		args     []int16
+		want     int16
+		err      string
+	}{
+		{"Math.multiply", []int16{300, 300}, 24464, ""},
+		{"Math.multiply", []int16{-2, 16384}, -32768, ""},
+		{"Math.multiply", []int16{-181, 181}, -32761, ""},
+		{"Math.divide", []int16{-7, 2}, -3, ""},
+		{"Math.divide", []int16{-32768, -1}, -32768, ""},
+		{"Math.divide", []int16{1, 0}, 0, "division by zero"},
+		{"Math.abs", []int16{-5}, 5, ""},
+		{"Math.abs", []int16{-32768}, -32768, ""},
+		{"Math.min", []int16{-32768, 32767}, -32768, ""},
+		{"Math.max", []int16{-32768, 32767}, 32767, ""},
+		{"Math.sqrt", []int16{32767}, 181, ""},
+		{"Math.sqrt", []int16{24}, 4, ""},
+		{"Math.sqrt", []int16{-1}, 0, "square root of a negative number"},
+	}
+	for _, c := range calls {
+		vm := load(t, nil)
+		got, err := vm.Call(c.function, c.args...)
+		gotErr := ""
+		if err != nil {
+			gotErr = err.Error()
+		}
+		if got != c.want || gotErr != c.err {
+			t.Errorf("%s%v was incorrect, got: %d %q, wanted: %d %q", c.function, c.args, got, gotErr, c.want, c.err)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	programs := []struct {
+		source string
+		err    string
+	}{
+		{"function Main.f 0\ngoto NOWHERE", "Main.vm:2: goto NOWHERE: unknown label NOWHERE"},
+		{"function Main.f 0\ncall Main.g 0", "Main.vm:2: call Main.g 0: unknown function Main.g"},
+		{"function Main.f 0\npush pointer 2", "Main.vm:2: push pointer 2: pointer index must be 0 or 1"},
+		{"function Main.f 0\npush temp 8", "Main.vm:2: push temp 8: temp index must be between 0 and 7"},
+		{"function Main.f 0\npop constant 1", "Main.vm:2: pop constant 1: cannot pop to constant"},
+		{"function Main.f 0\npush constant 0\npush constant 0\ncall Math.divide 2", "Main.vm:4: call Math.divide 2: division by zero"},
+		{"function Main.f 0\nlabel L\ngoto L", "Main.f halted before returning"},
+	}
+	for _, p := range programs {
+		vm := load(t, map[string]string{"Main": p.source})
+		_, err := vm.Call("Main.f")
+		if err == nil || err.Error() != p.err {
+			t.Errorf("Error for %q was incorrect, got: %v, wanted: %s", p.source, err, p.err)
+		}
+	}
+	vm := New()
+	err := vm.Load("Main", strings.NewReader("function Main.f 0\nreturn\nfunction Main.f 0\nreturn"))
+	if want := "Main.vm:3: function Main.f is defined more than once"; err == nil || err.Error() != want {
+		t.Errorf("Error for a function defined twice was incorrect, got: %v, wanted: %s", err, want)
+	}
+}
@@ -79,17 +79,16 @@ func (c *Command) CommandType() (string, error) {
 	}
 }
 
+// Arg1 returns the first argument of the command, or the command itself for an arithmetic
+// command. A command with the wrong number of arguments is an error.
 func (c *Command) Arg1(commandType string) (string, error) {
 	switch commandType {
 	case "C_ARITHMETIC":
 		return c.Line, nil
 	case "C_LABEL", "C_GOTO", "C_IF":
-		spaceIndex := strings.Index(c.Line, " ")
-		return c.Line[spaceIndex+1:], nil
+		return c.arg(1, 1)
 	case "C_PUSH", "C_POP", "C_FUNCTION", "C_CALL":
-		firstSpaceIndex := strings.Index(c.Line, " ")
-		lastSpaceIndex := strings.LastIndex(c.Line, " ")
-		return c.Line[firstSpaceIndex+1 : lastSpaceIndex], nil
+		return c.arg(1, 2)
 	case "C_RETURN":
 		return "", nil
 	default:
@@ -100,8 +99,11 @@ func (c *Command) Arg1(commandType string) (string, error) {
 func (c *Command) Arg2(commandType string) (int, error) {
 	switch commandType {
 	case "C_PUSH", "C_POP", "C_FUNCTION", "C_CALL":
-		lastSpaceIndex := strings.LastIndex(c.Line, " ")
-		val, err := strconv.Atoi(c.Line[lastSpaceIndex+1:])
+		arg, err := c.arg(2, 2)
+		if err != nil {
+			return -1, err
+		}
+		val, err := strconv.Atoi(arg)
 		if err != nil {
 			return -1, err
 		}
@@ -112,3 +114,16 @@ func (c *Command) Arg2(commandType string) (int, error) {
 		return -1, fmt.Errorf("%s is not a valid command type", commandType)
 	}
 }
+
+// arg returns argument i of a command that takes n arguments.
+func (c *Command) arg(i int, n int) (string, error) {
+	fields := strings.Fields(c.Line)
+	if len(fields) != n+1 {
+		arguments := "one argument"
+		if n == 2 {
+			arguments = "two arguments"
+		}
+		return "", fmt.Errorf("%q must have %s", c.Line, arguments)
+	}
+	return fields[i], nil
+}
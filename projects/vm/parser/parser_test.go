@@ -1,6 +1,11 @@
 package parser
 
-import "testing"
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestParser(t *testing.T) {
 	commands := []struct {
@@ -51,3 +56,62 @@ func TestParser(t *testing.T) {
 		}
 	}
 }
+
+func TestParserErrors(t *testing.T) {
+	commands := []struct {
+		raw string
+		err string
+	}{
+		{"push", `"push" must have two arguments`},
+		{"pop local", `"pop local" must have two arguments`},
+		{"call f 1 2", `"call f 1 2" must have two arguments`},
+		{"goto", `"goto" must have one argument`},
+		{"label a b", `"label a b" must have one argument`},
+		{"push constant x", `strconv.Atoi: parsing "x": invalid syntax`},
+	}
+	for _, command := range commands {
+		var p VmParser = &Command{Line: command.raw}
+		p.FormatLine()
+		commandType, _ := p.CommandType()
+		_, err := p.Arg1(commandType)
+		if err == nil {
+			_, err = p.Arg2(commandType)
+		}
+		if err == nil || err.Error() != command.err {
+			t.Errorf("Error of %s was incorrect, got: %v, wanted: %s", command.raw, err, command.err)
+		}
+	}
+}
+
+// FuzzCommand checks that any line is parsed or rejected with an error without panicking.
+func FuzzCommand(f *testing.F) {
+	for _, pattern := range []string{"../../07/*/*/*.vm", "../../08/*/*/*.vm"} {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, path := range paths {
+			file, err := os.Open(path)
+			if err != nil {
+				f.Fatal(err)
+			}
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				f.Add(scanner.Text())
+			}
+			file.Close()
+		}
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		var p VmParser = &Command{Line: line}
+		if p.FormatLine() == "" {
+			return
+		}
+		commandType, err := p.CommandType()
+		if err != nil {
+			return
+		}
+		p.Arg1(commandType)
+		p.Arg2(commandType)
+	})
+}
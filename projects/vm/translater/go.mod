@@ -1,3 +1,15 @@
 module translater
 
 go 1.12
+
+require (
+	example.com/assembler v0.0.0
+	example.com/cpu v0.0.0
+	vm/parser v0.0.0
+)
+
+replace (
+	example.com/assembler => ../../assembler
+	example.com/cpu => ../../cpu
+	vm/parser => ../parser
+)
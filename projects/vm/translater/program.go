@@ -0,0 +1,116 @@
+package translater
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"vm/parser"
+)
+
+// Program translates the VM files of one program into a single assembly file.
+type Program struct {
+	w io.Writer
+	// labels numbers the labels of comparisons and calls. It is shared by every file so that
+	// two files calling the same function do not both define RETURN.<function>.0.
+	labels int
+	// rom is the ROM address of the next instruction, addresses the one of the first instruction
+	// of each command translated.
+	rom       int
+	addresses []int
+}
+
+// NewProgram writes the bootstrap code, which calls Sys.init, and returns the program to
+// translate the files into.
+func NewProgram(w io.Writer) (*Program, error) {
+	aw := &AssemblyWriter{Arg1: "Sys.init"}
+	bootstrap := aw.WriteInit()
+	if _, err := io.WriteString(w, bootstrap); err != nil {
+		return nil, err
+	}
+	return &Program{w: w, labels: 1, rom: instructions(bootstrap)}, nil
+}
+
+// Addresses returns the ROM address of the first instruction of each command translated so far.
+// Commands are numbered in the order they were translated, skipping blank and comment lines,
+// the way the VM interpreter numbers the commands it loads.
+func (p *Program) Addresses() []int {
+	return p.addresses
+}
+
+// instructions counts the instructions of assembly code, labels take no ROM.
+func instructions(assemblyCode string) int {
+	n := 0
+	for _, line := range strings.Split(assemblyCode, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && line[0] != '(' {
+			n++
+		}
+	}
+	return n
+}
+
+// Translate writes the assembly of the VM commands read from r, name is the file name without
+// the .vm extension and names the static segment of the file.
+func (p *Program) Translate(name string, r io.Reader) error {
+	functionName := ""
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		var c parser.VmParser = &parser.Command{Line: scanner.Text()}
+		if c.FormatLine() == "" {
+			continue
+		}
+		commandType, err := c.CommandType()
+		if err != nil {
+			return fmt.Errorf("%s.vm:%d: %v", name, line, err)
+		}
+		firstArg, err := c.Arg1(commandType)
+		if err != nil {
+			return fmt.Errorf("%s.vm:%d: %v", name, line, err)
+		}
+		secondArg, err := c.Arg2(commandType)
+		if err != nil {
+			return fmt.Errorf("%s.vm:%d: %v", name, line, err)
+		}
+		if commandType == "C_FUNCTION" {
+			functionName = firstArg
+		}
+
+		var aw Translater = &AssemblyWriter{
+			Filename:     name,
+			FunctionName: functionName,
+			CommandType:  commandType,
+			Arg1:         firstArg,
+			Arg2:         secondArg,
+		}
+		var assemblyCode string
+		var labelInc int
+		switch commandType {
+		case "C_ARITHMETIC":
+			assemblyCode, labelInc = aw.WriteArithmetic(p.labels)
+		case "C_PUSH", "C_POP":
+			assemblyCode = aw.WritePushPop()
+		case "C_LABEL":
+			assemblyCode = aw.WriteLabel()
+		case "C_GOTO":
+			assemblyCode = aw.WriteGoto()
+		case "C_IF":
+			assemblyCode = aw.WriteIf()
+		case "C_FUNCTION":
+			assemblyCode = aw.WriteFunction()
+		case "C_RETURN":
+			assemblyCode = aw.WriteReturn()
+		case "C_CALL":
+			assemblyCode, labelInc = aw.WriteCall(p.labels)
+		}
+		p.labels += labelInc
+		p.addresses = append(p.addresses, p.rom)
+		p.rom += instructions(assemblyCode)
+
+		if _, err := io.WriteString(p.w, assemblyCode); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
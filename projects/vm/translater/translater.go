@@ -3,6 +3,7 @@ package translater
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 type Translater interface {
@@ -25,256 +26,121 @@ type AssemblyWriter struct {
 	Arg2         int
 }
 
-func (aw *AssemblyWriter) WriteArithmetic(equalityCheckCount int) (string, int) {
-	var assemblyCode string
-	e := "$" + aw.FunctionName + strconv.Itoa(equalityCheckCount)
-	switch aw.Arg1 {
-	case "add":
-		assemblyCode = `@SP
-M=M-1
-A=M
-D=M
+// The code of a program with the OS must fit the 32K words of ROM an A instruction can address,
+// so the long sequences of call, return and the comparisons are written once by the bootstrap
+// and jumped to. pushD pushes D, popD pops into D.
+const (
+	pushD = `@SP
+AM=M+1
 A=A-1
-M=M+D
+M=D
 `
-		return assemblyCode, 0
-	case "sub":
-		assemblyCode = `@SP
-M=M-1
-A=M
+	popD = `@SP
+AM=M-1
 D=M
-A=A-1
-M=M-D
 `
-		return assemblyCode, 0
-	case "neg":
-		assemblyCode = `@SP
-A=M-1
-M=-M
-`
-		return assemblyCode, 0
-	case "eq":
-		assemblyCode = fmt.Sprintf(`@SP
-M=M-1
-A=M
-D=M
-A=A-1
-D=D-M
-@EQUAL%s
-D;JEQ
-@SP
-A=M-1
-M=0
-@END%s
+)
+
+// binaryOperations combine the two values on top of the stack.
+var binaryOperations = map[string]string{
+	"add": "M=D+M",
+	"sub": "M=M-D",
+	"and": "M=D&M",
+	"or":  "M=D|M",
+}
+
+// comparisons jump to their routine with the return address in D, the routine ends with the
+// jump of the comparison.
+var comparisons = map[string]string{
+	"eq": "JEQ",
+	"gt": "JGT",
+	"lt": "JLT",
+}
+
+func (aw *AssemblyWriter) WriteArithmetic(equalityCheckCount int) (string, int) {
+	e := "$" + aw.FunctionName + strconv.Itoa(equalityCheckCount)
+	if operation, ok := binaryOperations[aw.Arg1]; ok {
+		return popD + "A=A-1\n" + operation + "\n", 0
+	}
+	if _, ok := comparisons[aw.Arg1]; ok {
+		assemblyCode := fmt.Sprintf(`@END%s
+D=A
+@$%s
 0;JMP
-(EQUAL%s)
-@SP
-A=M-1
-M=-1
 (END%s)
-`, e, e, e, e)
-		return assemblyCode, 1
-	case "gt":
-		assemblyCode = fmt.Sprintf(`@SP
-M=M-1
-A=M
-D=M
-A=A-1
-D=M-D
-@GREATER%s
-D;JGT
-@SP
-A=M-1
-M=0
-@END%s
-0;JMP
-(GREATER%s)
-@SP
-A=M-1
-M=-1
-(END%s)	
-`, e, e, e, e)
+`, e, strings.ToUpper(aw.Arg1), e)
 		return assemblyCode, 1
-	case "lt":
-		assemblyCode = fmt.Sprintf(`@SP
-M=M-1
-A=M
-D=M
-A=A-1
-D=M-D
-@LESS%s
-D;JLT
-@SP
-A=M-1
-M=0
-@END%s
-0;JMP
-(LESS%s)
-@SP
+	}
+	switch aw.Arg1 {
+	case "neg":
+		return `@SP
 A=M-1
-M=-1
-(END%s)
-`, e, e, e, e)
-		return assemblyCode, 1
-	case "and":
-		assemblyCode = `@SP
-M=M-1
-A=M
-D=M
-A=A-1
-M=D&M
-`
-		return assemblyCode, 0
-	case "or":
-		assemblyCode = `@SP
-M=M-1
-A=M
-D=M
-A=A-1
-M=D|M
-`
-		return assemblyCode, 0
+M=-M
+`, 0
 	case "not":
-		assemblyCode = `@SP
+		return `@SP
 A=M-1
-M=!M	
-`
-		return assemblyCode, 0
+M=!M
+`, 0
 	default:
 		return "", 0
 	}
 }
 
+// segmentPointers are the registers holding the base address of a segment.
+var segmentPointers = map[string]string{
+	"local":    "LCL",
+	"argument": "ARG",
+	"this":     "THIS",
+	"that":     "THAT",
+}
+
+// fixedSegments are the segments at a fixed address.
+var fixedSegments = map[string]int{
+	"pointer": 3,
+	"temp":    5,
+}
+
 func (aw *AssemblyWriter) WritePushPop() string {
-	var assemblyCode string
+	pointer, isPointer := segmentPointers[aw.Arg1]
+	var address string
+	if base, ok := fixedSegments[aw.Arg1]; ok {
+		address = strconv.Itoa(base + aw.Arg2)
+	} else if aw.Arg1 == "static" {
+		address = fmt.Sprintf("%s.%d", aw.Filename, aw.Arg2)
+	}
+
 	if aw.CommandType == "C_PUSH" {
-		switch aw.Arg1 {
-		case "constant":
-			assemblyCode = fmt.Sprintf(`@%d
-D=A
-@SP
-A=M
-M=D
-@SP
-M=M+1
-`, aw.Arg2)
-			return assemblyCode
-		case "argument":
-			assemblyCode = fmt.Sprintf(`@ARG
-D=M
-@%d
-A=D+A
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-`, aw.Arg2)
-			return assemblyCode
-		case "local":
-			assemblyCode = fmt.Sprintf(`@LCL
-D=M
-@%d
-A=D+A
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-`, aw.Arg2)
-			return assemblyCode
-		case "this":
-			assemblyCode = fmt.Sprintf(`@THIS
-D=M
-@%d
-A=D+A
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-`, aw.Arg2)
-			return assemblyCode
-		case "that":
-			assemblyCode = fmt.Sprintf(`@THAT
-D=M
-@%d
-A=D+A
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
+		switch {
+		case aw.Arg1 == "constant" && (aw.Arg2 == 0 || aw.Arg2 == 1):
+			return fmt.Sprintf(`@SP
+AM=M+1
+A=A-1
+M=%d
 `, aw.Arg2)
-			return assemblyCode
-		case "temp":
-			assemblyCode = fmt.Sprintf(`@5
-D=A
-@%d
-A=D+A
+		case aw.Arg1 == "constant":
+			return fmt.Sprintf("@%d\nD=A\n", aw.Arg2) + pushD
+		case isPointer && aw.Arg2 == 0:
+			return fmt.Sprintf("@%s\nA=M\nD=M\n", pointer) + pushD
+		case isPointer:
+			return fmt.Sprintf(`@%s
 D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-`, aw.Arg2)
-			return assemblyCode
-		case "pointer":
-			assemblyCode = fmt.Sprintf(`@3
-D=A
 @%d
 A=D+A
 D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-`, aw.Arg2)
-			return assemblyCode
-		case "static":
-			assemblyCode = fmt.Sprintf(`@%s.%d
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-`, aw.Filename, aw.Arg2)
-			return assemblyCode
+`, pointer, aw.Arg2) + pushD
+		case address != "":
+			return fmt.Sprintf("@%s\nD=M\n", address) + pushD
 		}
 	} else if aw.CommandType == "C_POP" {
-		switch aw.Arg1 {
-		case "argument":
-			assemblyCode = fmt.Sprintf(`@SP
-M=M-1
-A=M
-D=M
-@ARG
-A=M
-D=D+A
-@%d
-D=D+A
-@SP
-A=M
-A=D-M
-D=D-A
-M=D
-`, aw.Arg2)
-			return assemblyCode
-		case "local":
-			assemblyCode = fmt.Sprintf(`@SP
-M=M-1
-A=M
-D=M
-@LCL
-A=M
-D=D+A
+		switch {
+		case isPointer && aw.Arg2 <= 6:
+			// steps A up to the address, no longer than computing it
+			return popD + fmt.Sprintf("@%s\nA=M\n", pointer) + strings.Repeat("A=A+1\n", aw.Arg2) + "M=D\n"
+		case isPointer:
+			// D holds value+address, A=D-value gives the address and D-A the value back
+			return popD + fmt.Sprintf(`@%s
+D=D+M
 @%d
 D=D+A
 @SP
@@ -282,83 +148,9 @@ A=M
 A=D-M
 D=D-A
 M=D
-`, aw.Arg2)
-			return assemblyCode
-		case "this":
-			assemblyCode = fmt.Sprintf(`@SP
-M=M-1
-A=M
-D=M
-@THIS
-A=M
-D=D+A
-@%d
-D=D+A
-@SP
-A=M
-A=D-M
-D=D-A
-M=D
-`, aw.Arg2)
-			return assemblyCode
-		case "that":
-			assemblyCode = fmt.Sprintf(`@SP
-M=M-1
-A=M
-D=M
-@THAT
-A=M
-D=D+A
-@%d
-D=D+A
-@SP
-A=M
-A=D-M
-D=D-A
-M=D
-`, aw.Arg2)
-			return assemblyCode
-		case "temp":
-			assemblyCode = fmt.Sprintf(`@SP
-M=M-1
-A=M
-D=M
-@5
-D=D+A
-@%d
-D=D+A
-@SP
-A=M
-A=D-M
-D=D-A
-M=D
-`, aw.Arg2)
-			return assemblyCode
-		case "pointer":
-			assemblyCode = fmt.Sprintf(`@SP
-M=M-1
-A=M
-D=M
-@3
-D=D+A
-@%d
-D=D+A
-@SP
-A=M
-A=D-M
-D=D-A
-M=D
-`, aw.Arg2)
-			return assemblyCode
-		case "static":
-			assemblyCode = fmt.Sprintf(`@SP
-M=M-1
-A=M
-D=M
-@%s.%d
-M=D
-`, aw.Filename, aw.Arg2)
-			return assemblyCode
+`, pointer, aw.Arg2)
+		case address != "":
+			return popD + fmt.Sprintf("@%s\nM=D\n", address)
 		}
 	}
 	return ""
@@ -372,17 +164,13 @@ func (aw *AssemblyWriter) WriteLabel() string {
 
 func (aw *AssemblyWriter) WriteGoto() string {
 	assemblyCode := fmt.Sprintf(`@%s$%s
-0;JMP	
+0;JMP
 `, aw.FunctionName, aw.Arg1)
 	return assemblyCode
 }
 
 func (aw *AssemblyWriter) WriteIf() string {
-	assemblyCode := fmt.Sprintf(`@SP
-M=M-1
-A=M
-D=M
-@%s$%s
+	assemblyCode := popD + fmt.Sprintf(`@%s$%s
 D;JNE
 `, aw.FunctionName, aw.Arg1)
 	return assemblyCode
@@ -391,83 +179,102 @@ D;JNE
 func (aw *AssemblyWriter) WriteFunction() string {
 	assemblyCode := fmt.Sprintf(`(%s)
 `, aw.Arg1)
-
 	for val := 0; val < aw.Arg2; val++ {
-		if val == 0 {
-			assemblyCode += `@LCL
-A=M
-M=0
-@SP
-A=M
+		assemblyCode += `@SP
+AM=M+1
+A=A-1
 M=0
-@SP
-M=M+1
 `
-		} else {
-			assemblyCode += fmt.Sprintf(`@LCL
-D=M
-@%d
-A=D+A
-M=0
-@SP
-A=M
-M=0
-@SP
-M=M+1
-`, aw.Arg2)
-		}
 	}
-
 	return assemblyCode
 }
 
 func (aw *AssemblyWriter) WriteReturn() string {
+	return `@$RETURN
+0;JMP
+`
+}
 
-	restoreMemSegment := func(memorySegment string) string {
-		var decrementValue string
-		switch memorySegment {
-		case "RET":
-			decrementValue = "5"
-		case "LCL":
-			decrementValue = "4"
-		case "ARG":
-			decrementValue = "3"
-		case "THIS":
-			decrementValue = "2"
-		case "THAT":
-			decrementValue = "1"
-		}
+// WriteCall passes the number of arguments in R13 and the function in R14 to the call routine,
+// with the return address in D.
+func (aw *AssemblyWriter) WriteCall(equalityCheckCount int) (string, int) {
+	returnLabel := fmt.Sprintf("RETURN.%s.%d", aw.Arg1, equalityCheckCount)
+	assemblyCode := fmt.Sprintf(`@%d
+D=A
+@R13
+M=D
+@%s
+D=A
+@R14
+M=D
+@%s
+D=A
+@$CALL
+0;JMP
+(%s)
+`, aw.Arg2, aw.Arg1, returnLabel, returnLabel)
+	return assemblyCode, 1
+}
 
-		var assemblyCode string
-		if memorySegment == "RET" {
-			assemblyCode = fmt.Sprintf(`@R14
+// WriteInit sets the stack pointer and calls Sys.init, followed by the routines the commands
+// jump to.
+func (aw *AssemblyWriter) WriteInit() string {
+	setSp := `@256
+D=A
+@0
+M=D
+`
+	callInit, _ := aw.WriteCall(0)
+	return setSp + callInit + callRoutine() + returnRoutine() + comparisonRoutine("eq") +
+		comparisonRoutine("gt") + comparisonRoutine("lt")
+}
+
+// callRoutine saves the caller's frame, return address first, then repositions ARG and LCL and
+// jumps to the function.
+func callRoutine() string {
+	assemblyCode := "($CALL)\n" + pushD
+	for _, variable := range []string{"LCL", "ARG", "THIS", "THAT"} {
+		assemblyCode += fmt.Sprintf("@%s\nD=M\n", variable) + pushD
+	}
+	return assemblyCode + `@R13
 D=M
-@%s
-A=D-A
+@5
+D=D+A
+@SP
+D=M-D
+@ARG
+M=D
+@SP
 D=M
-@R15
-M=D		
-`, decrementValue)
-		} else {
-			assemblyCode = fmt.Sprintf(`@R14
+@LCL
+M=D
+@R14
+A=M
+0;JMP
+`
+}
+
+// returnRoutine keeps the frame in R14 and the return address in R15, moves the return value to
+// the caller's stack and restores its frame.
+func returnRoutine() string {
+	restoreMemSegment := func(memorySegment string, decrementValue int) string {
+		return fmt.Sprintf(`@R14
 D=M
-@%s
+@%d
 A=D-A
 D=M
 @%s
-M=D		
+M=D
 `, decrementValue, memorySegment)
-		}
-
-		return assemblyCode
 	}
 
-	setFrame := `@LCL
+	setFrame := `($RETURN)
+@LCL
 D=M
 @R14
 M=D
 `
-	setRet := restoreMemSegment("RET")
+	setRet := restoreMemSegment("R15", 5)
 	popToArg := `@SP
 A=M-1
 D=M
@@ -478,76 +285,78 @@ M=D
 	restoreSp := `@ARG
 D=M+1
 @SP
-M=D	
+M=D
 `
-	restoreThat := restoreMemSegment("THAT")
-	restoreThis := restoreMemSegment("THIS")
-	restoreArg := restoreMemSegment("ARG")
-	restoreLcl := restoreMemSegment("LCL")
+	restoreThat := restoreMemSegment("THAT", 1)
+	restoreThis := restoreMemSegment("THIS", 2)
+	restoreArg := restoreMemSegment("ARG", 3)
+	restoreLcl := restoreMemSegment("LCL", 4)
 	jumpToRet := `@R15
 A=M
 0;JMP
 `
-
 	return setFrame + setRet + popToArg + restoreSp + restoreThat + restoreThis + restoreArg + restoreLcl + jumpToRet
 }
 
-func (aw *AssemblyWriter) WriteCall(equalityCheckCount int) (string, int) {
-	pushVariable := func(variable string) string {
-		return fmt.Sprintf(`@%s
-D=M
-@SP
-A=M
+// comparisonRoutine replaces the two values x and y on top of the stack by true when the
+// comparison holds and false otherwise, then returns to the address it was given in D, kept in
+// R15. The comparison tests the sign of x-y, which overflows when x and y have different signs;
+// gt and lt then test x|1 instead, which has the sign x-y should have and is never 0.
+func comparisonRoutine(command string) string {
+	name := strings.ToUpper(command)
+	difference := `A=A-1
+D=M-D
+`
+	if command != "eq" {
+		difference = fmt.Sprintf(`@R13
 M=D
 @SP
-M=M+1
-`, variable)
-	}
-
-	pushReturn := fmt.Sprintf(`@RETURN.%s.%d
-D=A
-@SP
-A=M
-M=D
+A=M-1
+D=M
+@$%[1]s.NEGATIVE
+D;JLT
+@R13
+D=M
+@$%[1]s.SIGNS
+D;JLT
+@$%[1]s.SUBTRACT
+0;JMP
+($%[1]s.NEGATIVE)
+@R13
+D=M
+@$%[1]s.SUBTRACT
+D;JLT
+($%[1]s.SIGNS)
 @SP
-M=M+1
-`, aw.Arg1, equalityCheckCount)
-	pushLcl := pushVariable("LCL")
-	pushArg := pushVariable("ARG")
-	pushThis := pushVariable("THIS")
-	pushThat := pushVariable("THAT")
-
-	repositionArgVal := fmt.Sprintf("%d", aw.Arg2+5)
-	repositionArg := fmt.Sprintf(`@SP
+A=M-1
 D=M
-@%s
-D=D-A
-@ARG
-M=D
-`, repositionArgVal)
-
-	repositionLcl := `@SP
+@1
+D=D|A
+@$%[1]s.TEST
+0;JMP
+($%[1]s.SUBTRACT)
+@SP
+A=M-1
 D=M
-@LCL
-M=D
-`
-
-	gotoFunc := fmt.Sprintf(`@%s
-0;JMP	
-`, aw.Arg1)
-
-	returnLabel := fmt.Sprintf("(RETURN.%s.%d)\n", aw.Arg1, equalityCheckCount)
-
-	return pushReturn + pushLcl + pushArg + pushThis + pushThat + repositionArg + repositionLcl + gotoFunc + returnLabel, 1
-}
-
-func (aw *AssemblyWriter) WriteInit() string {
-	setSp := `@256
-D=A
-@0
+@R13
+D=D-M
+($%[1]s.TEST)
+`, name)
+	}
+	return fmt.Sprintf(`($%s)
+@R15
 M=D
-`
-	callInit, _ := aw.WriteCall(0)
-
-	return setSp + callInit
+`, name) + popD + difference + fmt.Sprintf(`@SP
+A=M-1
+M=-1
+@$%[1]s.END
+D;%[2]s
+@SP
+A=M-1
+M=0
+($%[1]s.END)
+@R15
+A=M
+0;JMP
+`, name, comparisons[command])
 }
@@ -0,0 +1,217 @@
+package translater
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"example.com/assembler"
+	"example.com/cpu"
+)
+
+// run translates the VM files, assembles them and runs the machine code until it halts.
+func run(t *testing.T, files map[string]string) *cpu.Computer {
+	t.Helper()
+	var asm, hack bytes.Buffer
+	program, err := NewProgram(&asm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Sys", "Main"} {
+		if source, ok := files[name]; ok {
+			if err := program.Translate(name, strings.NewReader(source)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := assembler.Assemble(&asm, &hack); err != nil {
+		t.Fatal(err)
+	}
+	rom, err := cpu.ReadHack(&hack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cpu.New(rom)
+	if err := c.Run(100000); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Halted() {
+		t.Fatal("The program did not halt")
+	}
+	return c
+}
+
+// sysInit is a Sys.init that runs commands then halts. Its statics are the first variables of
+// the program, static i is at RAM[16+i] when they are popped in order.
+func sysInit(commands string) string {
+	return fmt.Sprintf("function Sys.init 0\n%s\nlabel END\ngoto END\n", commands)
+}
+
+// pushValue pushes any 16 bit value, constants are between 0 and 32767.
+func pushValue(v int16) string {
+	switch {
+	case v == -32768:
+		return "push constant 32767\nneg\npush constant 1\nsub"
+	case v < 0:
+		return fmt.Sprintf("push constant %d\nneg", -v)
+	default:
+		return fmt.Sprintf("push constant %d", v)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	operations := []struct {
+		x, y int16
+		op   string
+		want int16
+	}{
+		{7, 5, "add", 12},
+		{32767, 1, "add", -32768},
+		{5, 7, "sub", -2},
+		{12, 10, "and", 8},
+		{12, 10, "or", 14},
+		{5, 5, "eq", -1},
+		{5, 6, "eq", 0},
+		{3, 2, "gt", -1},
+		{2, 3, "gt", 0},
+		{-2, -1, "lt", -1},
+		{32767, -1, "gt", -1},
+		{-1, 32767, "gt", 0},
+		{32767, -32768, "gt", -1},
+		{-32768, -32768, "gt", 0},
+		{-32768, 1, "lt", -1},
+		{1, -32768, "lt", 0},
+		{32767, -32768, "lt", 0},
+		{-32768, 32767, "lt", -1},
+	}
+	for _, o := range operations {
+		c := run(t, map[string]string{"Sys": sysInit(pushValue(o.x) + "\n" + pushValue(o.y) + "\n" + o.op + "\npop static 0")})
+		if got := c.RAM[16]; got != o.want {
+			t.Errorf("%d %s %d was incorrect, got: %d, wanted: %d", o.x, o.op, o.y, got, o.want)
+		}
+	}
+	unary := []struct {
+		x    int16
+		op   string
+		want int16
+	}{
+		{5, "neg", -5},
+		{-32768, "neg", -32768},
+		{0, "not", -1},
+		{-1, "not", 0},
+	}
+	for _, o := range unary {
+		c := run(t, map[string]string{"Sys": sysInit(pushValue(o.x) + "\n" + o.op + "\npop static 0")})
+		if got := c.RAM[16]; got != o.want {
+			t.Errorf("%s %d was incorrect, got: %d, wanted: %d", o.op, o.x, got, o.want)
+		}
+	}
+}
+
+func TestSegments(t *testing.T) {
+	c := run(t, map[string]string{"Sys": sysInit(`push constant 3000
+pop pointer 0
+push constant 4000
+pop pointer 1
+push constant 11
+pop this 2
+push constant 12
+pop that 3
+push constant 13
+pop temp 6
+push this 2
+push that 3
+add
+pop static 0
+push temp 6
+pop static 1
+push pointer 1
+pop static 2`)})
+	memory := []struct {
+		address int
+		want    int16
+	}{
+		{3, 3000},
+		{4, 4000},
+		{3002, 11},
+		{4003, 12},
+		{11, 13},
+		{16, 23},
+		{17, 13},
+		{18, 4000},
+	}
+	for _, m := range memory {
+		if got := c.RAM[m.address]; got != m.want {
+			t.Errorf("RAM[%d] was incorrect, got: %d, wanted: %d", m.address, got, m.want)
+		}
+	}
+}
+
+// TestCallReturn calls a function that changes THIS and THAT and a recursive one, the frame of
+// Sys.init must be restored after each return.
+func TestCallReturn(t *testing.T) {
+	main := `function Main.diff 2
+push constant 1
+pop pointer 0
+push constant 2
+pop pointer 1
+push argument 0
+push argument 1
+sub
+pop local 1
+push local 0
+push local 1
+add
+return
+function Main.sum 0
+push argument 0
+push constant 0
+eq
+if-goto BASE
+push argument 0
+push argument 0
+push constant 1
+sub
+call Main.sum 1
+add
+return
+label BASE
+push constant 0
+return
+`
+	c := run(t, map[string]string{"Main": main, "Sys": sysInit(`push constant 3000
+pop pointer 0
+push constant 4000
+pop pointer 1
+push constant 7
+push constant 5
+call Main.diff 2
+pop static 0
+push pointer 0
+pop static 1
+push pointer 1
+pop static 2
+push constant 10
+call Main.sum 1
+pop static 3`)})
+	memory := []struct {
+		name    string
+		address int
+		want    int16
+	}{
+		{"Main.diff(7, 5)", 16, 2},
+		{"THIS", 17, 3000},
+		{"THAT", 18, 4000},
+		{"Main.sum(10)", 19, 55},
+		// the bootstrap calls Sys.init with no arguments from SP 256
+		{"SP", 0, 261},
+		{"LCL", 1, 261},
+		{"ARG", 2, 256},
+	}
+	for _, m := range memory {
+		if got := c.RAM[m.address]; got != m.want {
+			t.Errorf("%s was incorrect, got: %d, wanted: %d", m.name, got, m.want)
+		}
+	}
+}